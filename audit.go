@@ -0,0 +1,199 @@
+package hsts
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// An AuditRecord is a change of the state of a Transport, as written to an
+// AuditLog.
+type AuditRecord struct {
+	Seq    uint64    `json:"seq"` // from 1, increasing by 1
+	Time   time.Time `json:"time"`
+	Tenant string    `json:"tenant,omitempty"` // see WithTenant
+	Host   string    `json:"host"`
+	Event  string    `json:"event"`           // e.g. learned new, updated, renewed, knocked out, added, applied, expired, evicted
+	Entry  *Entry    `json:"entry,omitempty"` // the new entry, nil if removed
+	Prev   string    `json:"prev"`            // hash of the previous record, empty for the first
+	Hash   string    `json:"hash"`            // see AuditLog
+}
+
+// hash returns the hash of a record: the hex-encoded SHA-256 of the hash of
+// the previous record, a newline, and the record as JSON without its hash.
+func (r AuditRecord) hash() (string, error) {
+	r.Hash = ""
+	b, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	io.WriteString(h, r.Prev)
+	h.Write([]byte{'\n'})
+	h.Write(b)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// An AuditLog is an append-only file of the changes of the state of
+// Transports, see WithAuditLog, to prove when their transport security
+// posture changed and why. Records are JSON, one per line, each chained to
+// the previous one by its hash so that modifying, removing or reordering
+// records is evident, see VerifyAuditLog. The last record must be kept
+// elsewhere too (e.g. sent to a log server) to also detect truncation.
+// Records are written as changes happen, without syncing the file.
+type AuditLog struct {
+	m    sync.Mutex // protects all below
+	f    *os.File
+	seq  uint64
+	prev string
+	err  error // first failure to write
+}
+
+// OpenAuditLog opens an audit log file to append to, creating it if it does
+// not exist, continuing the chain of its last record otherwise.
+// The caller should call Close when finished.
+func OpenAuditLog(path string) (*AuditLog, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	l := &AuditLog{f: f}
+	var last []byte
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+			last = append(last[:0], line...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("hsts: audit log %v: %w", path, err)
+	}
+	if last != nil {
+		var r AuditRecord
+		if err := json.Unmarshal(last, &r); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("hsts: audit log %v: last record: %w", path, err)
+		}
+		l.seq, l.prev = r.Seq, r.Hash
+	}
+	return l, nil
+}
+
+// append appends a record to the log, completing its sequence and hashes.
+func (l *AuditLog) append(r AuditRecord) error {
+	l.m.Lock()
+	defer l.m.Unlock()
+	if l.err != nil {
+		return l.err
+	}
+	r.Seq, r.Prev = l.seq+1, l.prev
+	hash, err := r.hash()
+	if err != nil {
+		return err
+	}
+	r.Hash = hash
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if _, err := l.f.Write(append(b, '\n')); err != nil {
+		l.err = fmt.Errorf("hsts: audit log: %w", err)
+		return l.err
+	}
+	l.seq, l.prev = r.Seq, r.Hash
+	return nil
+}
+
+// Close closes the file. It returns the first failure to write a record, if
+// any, after which none were written.
+func (l *AuditLog) Close() error {
+	l.m.Lock()
+	defer l.m.Unlock()
+	if err := l.f.Close(); l.err == nil {
+		l.err = err
+	}
+	return l.err
+}
+
+// VerifyAuditLog reads an audit log and verifies its chain of hashes, that
+// records follow each other in sequence from the first (record 1, without a
+// previous hash), and returns an error telling the first record which does
+// not.
+func VerifyAuditLog(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	var seq uint64
+	var prev string
+	for line := 1; scanner.Scan(); line++ {
+		b := bytes.TrimSpace(scanner.Bytes())
+		if len(b) == 0 {
+			continue
+		}
+		var rec AuditRecord
+		if err := json.Unmarshal(b, &rec); err != nil {
+			return fmt.Errorf("hsts: audit log line %d: %w", line, err)
+		}
+		if rec.Seq != seq+1 || rec.Prev != prev {
+			if seq == 0 {
+				return fmt.Errorf("hsts: audit log line %d: record %d is not the first", line, rec.Seq)
+			}
+			return fmt.Errorf("hsts: audit log line %d: record %d does not follow record %d", line, rec.Seq, seq)
+		}
+		hash, err := rec.hash()
+		if err != nil {
+			return fmt.Errorf("hsts: audit log line %d: %w", line, err)
+		}
+		if hash != rec.Hash {
+			return fmt.Errorf("hsts: audit log line %d: record %d was modified", line, rec.Seq)
+		}
+		seq, prev = rec.Seq, rec.Hash
+	}
+	return scanner.Err()
+}
+
+// WithAuditLog appends every change of the dynamic state to an audit log:
+// policies learned (from headers or DNS HTTPS records, see Origin), updated,
+// renewed, knocked out (max-age=0), added (see AddHosts), applied (see Apply),
+// expired or evicted. Policies read from, or no longer in, the Storage (see
+// WithStorage) are not recorded: the Transport which wrote them is. Failures
+// to write are logged, and returned by Close.
+func WithAuditLog(l *AuditLog) Option {
+	return func(t *Transport) {
+		t.auditLog = l
+	}
+}
+
+// auditChanged records the new directive of a host, if auditing.
+func (t *Transport) auditChanged(host, event string, d directive) {
+	if t.auditLog == nil {
+		return
+	}
+	e := newEntry(host, d)
+	t.auditAppend(AuditRecord{Time: t.now(), Tenant: t.tenant, Host: host, Event: event, Entry: &e})
+}
+
+// auditRemoved records the removal of hosts, if auditing.
+func (t *Transport) auditRemoved(hosts []string, event string) {
+	if t.auditLog == nil {
+		return
+	}
+	now := t.now()
+	for _, host := range hosts {
+		t.auditAppend(AuditRecord{Time: now, Tenant: t.tenant, Host: host, Event: event})
+	}
+}
+
+func (t *Transport) auditAppend(r AuditRecord) {
+	if err := t.auditLog.append(r); err != nil && t.logger != nil {
+		t.logger.Error("hsts: audit failed", "host", r.Host, "event", r.Event, "error", err)
+	}
+}
@@ -0,0 +1,125 @@
+package hsts
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readAudit reads the records of an audit log.
+func readAudit(t *testing.T, path string) []AuditRecord {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var records []AuditRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, r)
+	}
+	return records
+}
+
+func TestAuditLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := OpenAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := New(&fakeTransport{}, WithAuditLog(l), WithMaxEntries(2))
+	resp, err := (&http.Client{Transport: transport}).Get("https://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if err := transport.AddHosts([]HostPolicy{
+		{Host: "a.example.org", Policy: Policy{MaxAge: time.Hour}},
+		{Host: "b.example.org", Policy: Policy{MaxAge: time.Hour}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if !transport.Apply(Change{Host: "b.example.org", Removed: true}) {
+		t.Fatal("removal not applied")
+	}
+	transport.Tenant("alice").Apply(Change{Host: "example.net", Entry: Entry{Host: "example.net", Received: time.Now(), Policy: Policy{MaxAge: time.Hour}}})
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	records := readAudit(t, path)
+	var events []string
+	for _, r := range records {
+		events = append(events, r.Event)
+	}
+	if want := []string{"learned new", "evicted", "added", "added", "applied", "applied"}; !reflect.DeepEqual(events, want) {
+		t.Fatalf("got events %v; want %v", events, want)
+	}
+	if r := records[0]; r.Seq != 1 || r.Prev != "" || r.Host != "example.com" || r.Entry == nil || r.Entry.Origin.Source != SourceHeader {
+		t.Errorf("got first record %+v", r)
+	}
+	if r := records[4]; r.Host != "b.example.org" || r.Entry != nil {
+		t.Errorf("got removal %+v", r)
+	}
+	if r := records[5]; r.Tenant != "alice" || r.Host != "example.net" {
+		t.Errorf("got record of tenant %+v", r)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyAuditLog(strings.NewReader(string(b))); err != nil {
+		t.Errorf("VerifyAuditLog() = %v", err)
+	}
+
+	// Opened again, it continues the chain.
+	l, err = OpenAuditLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport = New(&multipleTransport{values: []string{"max-age=0"}}, WithAuditLog(l))
+	transport.AddHosts([]HostPolicy{{Host: "c.example.org", Policy: Policy{MaxAge: time.Hour}}})
+	resp, err = (&http.Client{Transport: transport}).Get("https://c.example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	l.Close()
+	records = readAudit(t, path)
+	if r := records[6]; r.Seq != 7 || r.Prev != records[5].Hash {
+		t.Errorf("got record %+v after reopening; want following %+v", r, records[5])
+	}
+	if r := records[len(records)-1]; r.Seq != 8 || r.Event != "knocked out" || r.Host != "c.example.org" {
+		t.Errorf("got last record %+v; want c.example.org knocked out", r)
+	}
+	b, err = os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyAuditLog(strings.NewReader(string(b))); err != nil {
+		t.Errorf("VerifyAuditLog() after reopening = %v", err)
+	}
+
+	// Tampering is evident.
+	lines := strings.SplitAfter(string(b), "\n")
+	for name, log := range map[string]string{
+		"modified":  strings.Replace(string(b), "a.example.org", "z.example.org", 1),
+		"removed":   lines[0] + strings.Join(lines[2:], ""),
+		"reordered": lines[1] + lines[0] + strings.Join(lines[2:], ""),
+		"truncated": strings.Join(lines[2:], ""), // leading records removed
+	} {
+		if err := VerifyAuditLog(strings.NewReader(log)); err == nil {
+			t.Errorf("VerifyAuditLog() of a log with a record %s succeeded; want error", name)
+		}
+	}
+}
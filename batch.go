@@ -0,0 +1,114 @@
+package hsts
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// A HostPolicy is a policy for a host, see AddHosts.
+type HostPolicy struct {
+	Host string
+	Policy
+}
+
+// A BatchStorage is a Storage which can also store many entries at once,
+// see AddHosts.
+type BatchStorage interface {
+	Storage
+
+	// PutBatch stores entries, replacing any for their hosts.
+	PutBatch(ctx context.Context, entries []Entry) error
+}
+
+// batchStorageTimeout bounds writing policies added to a Storage.
+const batchStorageTimeout = time.Minute
+
+// AddHosts adds policies for hosts as if received from them now, e.g. to
+// seed many internal domains at once. Unlike learned policies, they are not
+// restricted by options (see WithLearnAllow) but local hosts are still not
+// upgraded (see WithLocalExclusion). Hosts are validated first: if one is
+// invalid, e.g. an IP address or with a max-age which is not positive, none
+// is added. Each shard (see WithShards) is then locked once, and the policies
+// are written to the Storage in one batch if it is a BatchStorage, otherwise
+// one by one. The error of the Storage, a *StorageError, is returned after
+// adding in memory.
+func (t *Transport) AddHosts(hosts []HostPolicy) error {
+	type add struct {
+		host string
+		d    directive
+	}
+	now := t.now()
+	adds := make([][]add, len(t.shards))
+	for _, h := range hosts {
+		host := canonicalize(h.Host)
+		if host == "" || isIP(host) {
+			return fmt.Errorf("hsts: cannot add host %q", h.Host)
+		}
+		p := h.Policy
+		if p.MaxAge < time.Second {
+			return fmt.Errorf("hsts: cannot add %v with max-age %v", host, p.MaxAge)
+		}
+		if p.MaxAge > maxMaxAge {
+			p.MaxAge = maxMaxAge
+		}
+		p.Extensions = copyExtensions(p.Extensions)
+		i := shardIndex(host, len(t.shards))
+		adds[i] = append(adds[i], add{host, t.policyDirective(host, p, now, Origin{Source: SourceAdded})})
+	}
+
+	var evicted []Entry
+	for i, shardAdds := range adds {
+		s := t.shards[i]
+		s.m.Lock()
+		for _, a := range shardAdds {
+			evicted = append(evicted, t.setLocked(s, a.host, a.d, now)...)
+		}
+		s.m.Unlock()
+	}
+	t.evicted(evicted)
+	t.store.invalidateAll()
+
+	entries := make([]Entry, 0, len(hosts))
+	for _, shardAdds := range adds {
+		for _, a := range shardAdds {
+			t.count(&t.counters.added)
+			t.notifyChanged(a.host, a.d)
+			t.auditChanged(a.host, "added", a.d)
+			entries = append(entries, newEntry(a.host, a.d))
+		}
+	}
+	return t.writeBatch(entries)
+}
+
+// writeBatch writes entries added to the Storage, if any.
+func (t *Transport) writeBatch(entries []Entry) error {
+	storage := t.store.storage
+	if storage == nil || len(entries) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), batchStorageTimeout)
+	defer cancel()
+	if b, ok := storage.(BatchStorage); ok {
+		if err := b.PutBatch(ctx, entries); err != nil {
+			return t.storageFailed("put batch", "", err)
+		}
+		now := t.now()
+		for _, e := range entries {
+			t.store.cache.note(e.Host, now, true)
+		}
+		return nil
+	}
+	var err error
+	for _, e := range entries {
+		if putErr := storage.Put(ctx, e); putErr != nil {
+			putErr = t.storageFailed("put", e.Host, putErr)
+			if err == nil {
+				err = putErr
+			}
+			continue
+		}
+		t.store.cache.note(e.Host, t.now(), true)
+	}
+	return err
+}
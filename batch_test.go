@@ -0,0 +1,116 @@
+package hsts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// batchStorage is a fakeStorage counting batches.
+type batchStorage struct {
+	fakeStorage
+	batches int
+}
+
+func (s *batchStorage) PutBatch(ctx context.Context, entries []Entry) error {
+	s.batches++
+	for _, e := range entries {
+		if err := s.Put(ctx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestAddHosts(t *testing.T) {
+	transport := New(&fakeTransport{}, WithShards(4), WithLearnDeny("internal.example"))
+	var changes int
+	transport.State().Subscribe(func(Change) { changes++ })
+
+	// A miss is not remembered across adds.
+	transport.lookup("a.internal.example", time.Now())
+	var hosts []HostPolicy
+	for i := 0; i < 100; i++ {
+		hosts = append(hosts, HostPolicy{Host: fmt.Sprintf("Host%d.Internal.Example.", i), Policy: Policy{MaxAge: time.Hour}})
+	}
+	hosts = append(hosts, HostPolicy{Host: "internal.example", Policy: Policy{MaxAge: time.Hour, IncludeSubDomains: true}})
+	if err := transport.AddHosts(hosts); err != nil {
+		t.Fatal(err)
+	}
+	if n := transport.size(); n != 101 {
+		t.Errorf("%v entries; want 101", n)
+	}
+	if changes != 101 || transport.Stats().Added != 101 {
+		t.Errorf("%v changes and %v added; want 101", changes, transport.Stats().Added)
+	}
+	if e, ok := transport.Lookup("host1.internal.example"); !ok || e.Host != "host1.internal.example" || e.IncludeSubDomains {
+		t.Errorf("Lookup(host1.internal.example) = %+v, %v; want host1.internal.example", e, ok)
+	}
+	if e, ok := transport.Lookup("a.internal.example"); !ok || e.Host != "internal.example" {
+		t.Errorf("Lookup(a.internal.example) = %+v, %v; want internal.example", e, ok)
+	}
+	resp, err := (&http.Client{Transport: transport}).Get("http://sub.internal.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Request.URL.Scheme != "https" {
+		t.Errorf("sent as %v; want upgraded", resp.Request.URL)
+	}
+
+	for _, h := range []HostPolicy{
+		{Host: "127.0.0.1", Policy: Policy{MaxAge: time.Hour}},
+		{Host: "", Policy: Policy{MaxAge: time.Hour}},
+		{Host: "example.com"},
+	} {
+		if err := transport.AddHosts([]HostPolicy{{Host: "valid.com", Policy: Policy{MaxAge: time.Hour}}, h}); err == nil {
+			t.Errorf("AddHosts(%+v) succeeded; want error", h)
+		}
+	}
+	if _, ok := transport.Lookup("valid.com"); ok {
+		t.Error("valid.com added along an invalid host")
+	}
+}
+
+func TestAddHostsStorage(t *testing.T) {
+	hosts := []HostPolicy{{Host: "a.com", Policy: Policy{MaxAge: time.Hour}}, {Host: "b.com", Policy: Policy{MaxAge: time.Hour}}}
+	batch := &batchStorage{}
+	if err := New(nil, WithStorage(batch)).AddHosts(hosts); err != nil {
+		t.Fatal(err)
+	}
+	if batch.batches != 1 || len(batch.entries) != 2 {
+		t.Errorf("%v batches of %v entries; want 1 of 2", batch.batches, len(batch.entries))
+	}
+
+	storage := &fakeStorage{}
+	transport := New(nil, WithStorage(storage))
+	if err := transport.AddHosts(hosts); err != nil {
+		t.Fatal(err)
+	}
+	if len(storage.entries) != 2 {
+		t.Errorf("storage has %v; want a.com and b.com", storage.entries)
+	}
+	storage.err = fmt.Errorf("down")
+	if err := transport.AddHosts([]HostPolicy{{Host: "c.com", Policy: Policy{MaxAge: time.Hour}}}); !errors.Is(err, storage.err) || !errors.Is(err, ErrStorage) {
+		t.Errorf("AddHosts() = %v; want a storage error wrapping %v", err, storage.err)
+	}
+	storage.err = nil
+	if _, ok := transport.Lookup("c.com"); !ok {
+		t.Error("c.com not added when the storage failed")
+	}
+}
+
+func BenchmarkAddHosts(b *testing.B) {
+	hosts := make([]HostPolicy, 10000)
+	for i := range hosts {
+		hosts[i] = HostPolicy{Host: fmt.Sprintf("host%d.internal.example", i), Policy: Policy{MaxAge: time.Hour}}
+	}
+	for i := 0; i < b.N; i++ {
+		if err := New(nil).AddHosts(hosts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package hsts
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"sort"
+)
+
+// chromiumEntry is an entry of Chromium's transport_security_state_static.json.
+type chromiumEntry struct {
+	Name              string `json:"name"`
+	Policy            string `json:"policy,omitempty"`
+	Mode              string `json:"mode"`
+	IncludeSubDomains bool   `json:"include_subdomains,omitempty"`
+}
+
+// ExportChromium writes dynamic entries in the format of Chromium's static
+// list (transport_security_state_static.json), e.g. to prepare preload
+// submissions or internal browser policies from what clients observed, such
+// as the Entries of State. Policy is that of each entry, e.g. "custom", left
+// out if empty. Preloaded entries are left out, as they are already listed.
+// It writes a JSON object with one entry per line, sorted by name, to copy
+// to the list:
+//
+//	{"entries": [
+//	  {"name":"example.com","policy":"custom","mode":"force-https","include_subdomains":true}
+//	]}
+func ExportChromium(w io.Writer, entries []Entry, policy string) error {
+	var list []chromiumEntry
+	for _, e := range entries {
+		if e.Preloaded {
+			continue
+		}
+		list = append(list, chromiumEntry{
+			Name:              e.Host,
+			Policy:            policy,
+			Mode:              "force-https",
+			IncludeSubDomains: e.IncludeSubDomains,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+
+	b := bufio.NewWriter(w)
+	b.WriteString(`{"entries": [`)
+	for i, e := range list {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString("\n  ")
+		b.Write(line)
+	}
+	b.WriteString("\n]}\n")
+	return b.Flush()
+}
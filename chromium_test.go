@@ -0,0 +1,46 @@
+package hsts
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestExportChromium(t *testing.T) {
+	now := time.Now()
+	entries := []Entry{
+		newEntry("z.example.com", newDirective(now, time.Hour, 0)),
+		newEntry("example.com", newDirective(now, time.Hour, flagIncludeSubDomains|flagPreload)),
+		{Host: "preloaded.com", Preloaded: true},
+	}
+	var b bytes.Buffer
+	if err := ExportChromium(&b, entries, "custom"); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"entries": [
+  {"name":"example.com","policy":"custom","mode":"force-https","include_subdomains":true},
+  {"name":"z.example.com","policy":"custom","mode":"force-https"}
+]}
+`
+	if got := b.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	var list struct {
+		Entries []chromiumEntry `json:"entries"`
+	}
+	if err := json.Unmarshal(b.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Entries) != 2 {
+		t.Errorf("parsed %+v; want 2 entries", list.Entries)
+	}
+
+	b.Reset()
+	if err := ExportChromium(&b, nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.String(), "{\"entries\": [\n]}\n"; got != want {
+		t.Errorf("empty export %q; want %q", got, want)
+	}
+}
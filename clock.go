@@ -0,0 +1,72 @@
+package hsts
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// defaultMaxDateSkew is how far from the local clock the Date of a response
+// may be to be used by default, see WithMaxDateSkew.
+const defaultMaxDateSkew = 5 * time.Minute
+
+// WithServerDate sets whether policies are received at the time of the Date
+// header of responses (section 7.1.1.2 of RFC 7231), plus their Age if
+// cached, rather than at the local time. Policies then expire max-age after
+// the server sent them rather than after they were cached. It is disabled by
+// default.
+//
+// The local time is still used when either header is missing or invalid, or
+// when the Date is more than a few minutes away from the local clock (see
+// WithMaxDateSkew): a
+// server with a wrong clock could otherwise extend a policy well past its
+// max-age, or have it expire before it is even learned. A Date ahead of the
+// local clock is taken as the local time, so that a policy never expires
+// later than max-age from now.
+//
+// Either way a policy expires at an absolute instant, kept in the state and
+// its Storage, not after a duration: the time spent suspended counts, and
+// jumps of the local clock move expiry no further than they move the clock.
+func WithServerDate(enable bool) Option {
+	return func(t *Transport) {
+		t.serverDate = enable
+	}
+}
+
+// WithMaxDateSkew sets how far behind the local clock the Date of a response
+// may be to be used, see WithServerDate. It is 5 minutes by default, and it
+// panics if not positive. A Date ahead of the local clock is never used.
+func WithMaxDateSkew(d time.Duration) Option {
+	if d <= 0 {
+		panic(fmt.Sprintf("hsts: invalid max date skew %v", d))
+	}
+	return func(t *Transport) {
+		t.maxDateSkew = d
+	}
+}
+
+// received returns when a response was received, see WithServerDate.
+func (t *Transport) received(resp *http.Response) time.Time {
+	now := t.now()
+	if !t.serverDate {
+		return now
+	}
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return now
+	}
+	if age := resp.Header.Get("Age"); age != "" {
+		secs, err := strconv.ParseUint(age, 10, 32)
+		if err != nil {
+			return now
+		}
+		date = date.Add(time.Duration(secs) * time.Second)
+	}
+	// Ahead never extends past max-age from now, too far behind loses the
+	// policy, either way a clock is wrong.
+	if skew := now.Sub(date); skew < 0 || skew > t.maxDateSkew {
+		return now
+	}
+	return date
+}
@@ -0,0 +1,104 @@
+package hsts
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// dateTransport answers HTTPS requests with a policy and headers.
+type dateTransport struct {
+	headers string
+	policy  string // max-age=3600 if empty
+}
+
+func (f *dateTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	policy := f.policy
+	if policy == "" {
+		policy = "max-age=3600"
+	}
+	return secureReply(req, "HTTP/1.1 200 OK\r\n"+
+		"Strict-Transport-Security: "+policy+"\r\n"+f.headers+"\r\n")
+}
+
+func TestServerDate(t *testing.T) {
+	local := time.Date(2024, 6, 1, 12, 2, 0, 0, time.UTC)
+	date := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	on := []Option{WithServerDate(true)}
+	lenient := []Option{WithServerDate(true), WithMaxDateSkew(3 * time.Hour)}
+	for _, tt := range []struct {
+		name    string
+		headers string
+		opts    []Option
+		want    time.Time
+	}{
+		{"date", "Date: Sat, 01 Jun 2024 12:00:00 GMT\r\n", on, date},
+		{"cached", "Date: Sat, 01 Jun 2024 12:00:00 GMT\r\nAge: 60\r\n", on, date.Add(time.Minute)},
+		{"no date", "", on, local},
+		{"invalid date", "Date: yesterday\r\n", on, local},
+		{"invalid age", "Date: Sat, 01 Jun 2024 12:00:00 GMT\r\nAge: -1\r\n", on, local},
+		{"ahead", "Date: Sat, 01 Jun 2024 12:03:00 GMT\r\n", on, local},
+		{"far ahead", "Date: Sat, 01 Jun 2224 12:00:00 GMT\r\n", on, local},
+		{"far behind", "Date: Sat, 01 Jun 2024 10:00:00 GMT\r\n", on, local},
+		{"behind", "Date: Sat, 01 Jun 2024 11:50:00 GMT\r\n", on, local},
+		{"behind within max skew", "Date: Sat, 01 Jun 2024 11:50:00 GMT\r\n", lenient, date.Add(-10 * time.Minute)},
+		{"half an hour behind within max skew", "Date: Sat, 01 Jun 2024 11:30:00 GMT\r\n", lenient, date.Add(-30 * time.Minute)},
+		{"ahead with max skew", "Date: Sat, 01 Jun 2024 12:03:00 GMT\r\n", lenient, local},
+		{"disabled by default", "Date: Sat, 01 Jun 2024 12:00:00 GMT\r\n", nil, local},
+	} {
+		opts := append([]Option{WithClock(func() time.Time { return local })}, tt.opts...)
+		transport := New(&dateTransport{headers: tt.headers}, opts...)
+		req, err := http.NewRequest("GET", "https://example.com", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		e, ok := transport.Lookup("example.com")
+		if !ok {
+			t.Errorf("%v: not learned", tt.name)
+			continue
+		}
+		if !e.Received.Equal(tt.want) || !e.Expires().Equal(tt.want.Add(time.Hour)) {
+			t.Errorf("%v: got received %v, expires %v; want received %v", tt.name, e.Received, e.Expires(), tt.want)
+		}
+	}
+}
+
+func TestMaxDateSkewInvalid(t *testing.T) {
+	for _, d := range []time.Duration{0, -time.Minute} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("WithMaxDateSkew(%v) did not panic", d)
+				}
+			}()
+			WithMaxDateSkew(d)
+		}()
+	}
+}
+
+func TestServerDateMaxMaxAge(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	transport := New(&dateTransport{headers: "Date: Sat, 01 Jun 2024 12:04:00 GMT\r\n", policy: "max-age=99999999999"},
+		WithServerDate(true), WithClock(func() time.Time { return now }))
+	req, err := http.NewRequest("GET", "https://example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	e, ok := transport.Lookup("example.com")
+	if !ok {
+		t.Fatal("not learned")
+	}
+	if limit := now.Add(maxMaxAge); e.Expires().After(limit) {
+		t.Errorf("expires %v; want at most %v", e.Expires(), limit)
+	}
+}
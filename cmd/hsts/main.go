@@ -0,0 +1,221 @@
+// Binary hsts looks up and checks HTTP Strict Transport Security.
+//
+// Usage:
+//
+//	hsts lookup <host>  tells whether a host is preloaded and its policy
+//	hsts check <url>    fetches a URL and evaluates its Strict-Transport-Security header
+//	hsts lint <header>  lists findings about a Strict-Transport-Security header value,
+//	    or that of a URL (starting with http:// or https://), failing on errors
+//	hsts update [dir]   regenerates the preload list of the hsts package in dir
+//	hsts state <file> [-format jsonl|csv|binary]
+//	    writes the policies of a state file (see hsts.OpenStateFile) in a format
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/StalkR/hsts"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: hsts lookup <host> | check <url> | lint <header|url> | update [dir] | state <file> [-format jsonl|csv|binary]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	var err error
+	switch flag.Arg(0) {
+	case "lookup":
+		if flag.NArg() != 2 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		err = lookup(os.Stdout, flag.Arg(1))
+	case "check":
+		if flag.NArg() != 2 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		err = check(os.Stdout, &http.Client{Timeout: 30 * time.Second}, flag.Arg(1))
+	case "lint":
+		if flag.NArg() != 2 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		err = lint(os.Stdout, &http.Client{Timeout: 30 * time.Second}, flag.Arg(1))
+	case "update":
+		dir := "."
+		if flag.NArg() > 1 {
+			dir = flag.Arg(1)
+		}
+		err = update(dir)
+	case "state":
+		fs := flag.NewFlagSet("state", flag.ExitOnError)
+		format := fs.String("format", "jsonl", "Output format: jsonl, csv or binary.")
+		fs.Parse(flag.Args()[1:])
+		if fs.NArg() < 1 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		path := fs.Arg(0)
+		fs.Parse(fs.Args()[1:]) // flags may also follow the file
+		if fs.NArg() != 0 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		err = state(os.Stdout, path, *format)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "hsts:", err)
+		os.Exit(1)
+	}
+}
+
+// lookup tells whether a host is preloaded and the policy that applies.
+func lookup(w io.Writer, host string) error {
+	e, ok := hsts.New(nil).Lookup(host)
+	if !ok {
+		fmt.Fprintf(w, "%v: not a known HSTS host\n", host)
+		return nil
+	}
+	fmt.Fprintf(w, "%v: preloaded", host)
+	if e.Host != strings.ToLower(strings.TrimSuffix(host, ".")) {
+		fmt.Fprintf(w, " by superdomain %v", e.Host)
+	}
+	if e.IncludeSubDomains {
+		fmt.Fprint(w, ", including subdomains")
+	}
+	fmt.Fprintln(w)
+	return nil
+}
+
+// check fetches a URL without following redirects and evaluates its
+// Strict-Transport-Security header.
+func check(w io.Writer, client *http.Client, url string) error {
+	noRedirect := *client
+	noRedirect.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	resp, err := noRedirect.Get(url)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	fmt.Fprintf(w, "%v: %v\n", url, resp.Status)
+	if location := resp.Header.Get("Location"); location != "" {
+		fmt.Fprintf(w, "redirects to %v\n", location)
+	}
+	values := resp.Header.Values("Strict-Transport-Security")
+	if len(values) == 0 {
+		fmt.Fprintln(w, "no Strict-Transport-Security header")
+		return nil
+	}
+	if resp.TLS == nil {
+		fmt.Fprintln(w, "warning: header received over plaintext, browsers ignore it")
+	}
+	if len(values) > 1 {
+		fmt.Fprintf(w, "warning: %d headers, browsers only use the first\n", len(values))
+	}
+	header := values[0]
+	fmt.Fprintf(w, "header: %v\n", header)
+	if err := hsts.ValidateHeader(header); err != nil {
+		fmt.Fprintf(w, "warning: %v\n", err)
+	}
+	p, err := hsts.ParseHeader(header)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "policy: %v (max-age %v)\n", p, p.MaxAge)
+	if p.MaxAge == 0 {
+		fmt.Fprintln(w, "max-age=0 removes the policy")
+	}
+	if _, err := p.Header(); err != nil {
+		fmt.Fprintf(w, "warning: %v\n", err)
+	}
+	return nil
+}
+
+// lint lists the findings about a Strict-Transport-Security header value, or
+// that of a URL fetched without following redirects, and fails on errors.
+func lint(w io.Writer, client *http.Client, arg string) error {
+	var findings []hsts.Finding
+	if strings.HasPrefix(arg, "http://") || strings.HasPrefix(arg, "https://") {
+		noRedirect := *client
+		noRedirect.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+		resp, err := noRedirect.Get(arg)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		findings = hsts.LintResponse(resp)
+	} else {
+		findings = hsts.LintHeader(arg)
+	}
+	errs := 0
+	for _, f := range findings {
+		fmt.Fprintln(w, f)
+		if f.Severity == hsts.SeverityError {
+			errs++
+		}
+	}
+	if errs > 0 {
+		return fmt.Errorf("%d errors", errs)
+	}
+	return nil
+}
+
+// update regenerates the preload list of the hsts package in a checkout of
+// its repository, as go generate does.
+func update(dir string) error {
+	if _, err := os.Stat(dir + "/generate/preload.go"); err != nil {
+		return errors.New("update needs a checkout of the hsts repository")
+	}
+	cmd := exec.Command("go", "generate", ".")
+	cmd.Dir = dir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// formats are the formats of the state subcommand by name.
+var formats = map[string]hsts.Format{
+	"jsonl":  hsts.FormatJSONLines,
+	"csv":    hsts.FormatCSV,
+	"binary": hsts.FormatBinary,
+}
+
+// state writes the policies of a state file in a format, those which have
+// not expired.
+func state(w io.Writer, path, format string) error {
+	f, ok := formats[format]
+	if !ok {
+		return fmt.Errorf("unknown format %q: want jsonl, csv or binary", format)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var s hsts.StateSnapshot
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("%v: %v", path, err)
+	}
+	t := hsts.New(nil)
+	for _, e := range s.Entries {
+		t.Apply(hsts.Change{Host: e.Host, Entry: e})
+	}
+	return t.ExportState(w, f)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/StalkR/hsts"
+)
+
+func TestLookup(t *testing.T) {
+	var b strings.Builder
+	if err := lookup(&b, "example.invalid"); err != nil {
+		t.Fatal(err)
+	}
+	if want := "example.invalid: not a known HSTS host\n"; b.String() != want {
+		t.Errorf("got %q; want %q", b.String(), want)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Strict-Transport-Security", "max-age=3600; preload")
+	}))
+	defer server.Close()
+
+	var b strings.Builder
+	if err := check(&b, server.Client(), server.URL); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"200 OK",
+		"header: max-age=3600; preload",
+		"policy: max-age=3600; preload (max-age 1h0m0s)",
+		"warning: hsts: preload requires includeSubDomains",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("output %q missing %q", b.String(), want)
+		}
+	}
+	if strings.Contains(b.String(), "plaintext") {
+		t.Errorf("output %q warns about plaintext over TLS", b.String())
+	}
+}
+
+func TestLint(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Strict-Transport-Security", "max-age=3600")
+	}))
+	defer server.Close()
+
+	var b strings.Builder
+	if err := lint(&b, server.Client(), server.URL); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"warning: max_age.too_low", "warning: include_subdomains.missing"} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("output %q missing %q", b.String(), want)
+		}
+	}
+
+	b.Reset()
+	if err := lint(&b, server.Client(), "max-age=1; max-age=2"); err == nil {
+		t.Errorf("lint() got no error for a duplicate directive")
+	}
+	if want := `error: directive.duplicate: directive "max-age=2": duplicate directive`; !strings.Contains(b.String(), want) {
+		t.Errorf("output %q missing %q", b.String(), want)
+	}
+}
+
+func TestState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	storage, err := hsts.OpenStateFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := time.Now().Truncate(time.Second)
+	for _, e := range []hsts.Entry{
+		{Host: "b.example.com", Received: received, Origin: hsts.Origin{Source: hsts.SourceHeader}, Policy: hsts.Policy{MaxAge: time.Hour}},
+		{Host: "a.example.com", Received: received, Policy: hsts.Policy{MaxAge: 2 * time.Hour, IncludeSubDomains: true}},
+		{Host: "expired.example.com", Received: received.Add(-2 * time.Hour), Policy: hsts.Policy{MaxAge: time.Hour}},
+	} {
+		if err := storage.Put(context.Background(), e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := storage.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var b strings.Builder
+	if err := state(&b, path, "csv"); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[1], "a.example.com,unknown,7200,true,") || !strings.HasPrefix(lines[2], "b.example.com,header,3600,false,") {
+		t.Errorf("got %q; want a.example.com then b.example.com", b.String())
+	}
+	if err := state(&b, path, "xml"); err == nil {
+		t.Error("state() got no error for an unknown format")
+	}
+	if err := state(&b, filepath.Join(t.TempDir(), "missing.json"), "jsonl"); err == nil {
+		t.Error("state() got no error for a missing file")
+	}
+}
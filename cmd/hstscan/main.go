@@ -0,0 +1,73 @@
+// Binary hstscan reports the HSTS posture of many domains, read one per line
+// from files or standard input, as JSON Lines or CSV.
+//
+// Usage:
+//
+//	hstscan [-c concurrency] [-r rate] [-t timeout] [-f json|csv] [file ...]
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/StalkR/hsts/scanner"
+)
+
+var (
+	concurrency = flag.Int("c", 10, "Number of domains probed at once.")
+	rate        = flag.Float64("r", 0, "Maximum number of probes started per second, 0 for unlimited.")
+	timeout     = flag.Duration("t", 0, "Timeout of each probe, 10s if 0.")
+	format      = flag.String("f", "json", "Output format: json (JSON Lines) or csv.")
+)
+
+func main() {
+	flag.Parse()
+	write := scanner.WriteJSON
+	switch *format {
+	case "json":
+	case "csv":
+		write = scanner.WriteCSV
+	default:
+		log.Fatalf("unknown format %q", *format)
+	}
+
+	var domains []string
+	if flag.NArg() == 0 {
+		domains = readDomains(os.Stdin)
+	}
+	for _, name := range flag.Args() {
+		f, err := os.Open(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		domains = append(domains, readDomains(f)...)
+		f.Close()
+	}
+
+	s := &scanner.Scanner{Concurrency: *concurrency, Rate: *rate, Timeout: *timeout}
+	if err := write(os.Stdout, s.Scan(context.Background(), domains)); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// readDomains reads domains one per line, ignoring blank lines and # comments.
+func readDomains(r io.Reader) []string {
+	var domains []string
+	lines := bufio.NewScanner(r)
+	for lines.Scan() {
+		line := strings.TrimSpace(lines.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		domains = append(domains, line)
+	}
+	if err := lines.Err(); err != nil {
+		log.Fatal(err)
+	}
+	return domains
+}
@@ -0,0 +1,21 @@
+module github.com/StalkR/hsts/cmd/hstsvet
+
+go 1.22.0
+
+require (
+	github.com/StalkR/hsts/hstsvet v0.0.0-00010101000000-000000000000
+	golang.org/x/tools v0.26.0
+)
+
+require (
+	github.com/StalkR/hsts v0.0.0-00010101000000-000000000000 // indirect
+	golang.org/x/mod v0.21.0 // indirect
+	golang.org/x/net v0.33.0 // indirect
+	golang.org/x/sync v0.10.0 // indirect
+	golang.org/x/text v0.21.0 // indirect
+)
+
+replace (
+	github.com/StalkR/hsts => ../../
+	github.com/StalkR/hsts/hstsvet => ../../hstsvet
+)
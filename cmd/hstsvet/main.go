@@ -0,0 +1,14 @@
+// Binary hstsvet reports plaintext URLs of hosts in the HSTS preload list,
+// see package hstsvet. It runs alone or as a vet tool:
+//
+//	go vet -vettool=$(which hstsvet) ./...
+package main
+
+import (
+	"github.com/StalkR/hsts/hstsvet"
+	"golang.org/x/tools/go/analysis/singlechecker"
+)
+
+func main() {
+	singlechecker.Main(hstsvet.Analyzer)
+}
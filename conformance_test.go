@@ -0,0 +1,14 @@
+package hsts
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/StalkR/hsts/hststest"
+)
+
+func TestConformance(t *testing.T) {
+	hststest.Conformance(t, func(rt http.RoundTripper) http.RoundTripper {
+		return New(rt)
+	})
+}
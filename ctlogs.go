@@ -0,0 +1,6 @@
+package hsts
+
+// Automatically generated with go generate.
+
+// Certificate Transparency logs trusted by Chromium, DER public keys.
+var embeddedCTLogs = []string{}
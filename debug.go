@@ -0,0 +1,177 @@
+package hsts
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxDebugEntries is the maximum number of dynamic entries a DebugHandler shows.
+const maxDebugEntries = 1000
+
+// DebugHandler returns a handler showing what the Transport knows and did,
+// like Chrome's net-internals#hsts page, to mount under an internal admin mux.
+// Parameter host looks up a host, and q only lists learned hosts containing it.
+// Decisions kept WithDecisionLog are listed, only those about the host looked
+// up if any, or about hosts containing q.
+// It serves HTML, or JSON with parameter format=json or when accepted.
+func (t *Transport) DebugHandler() http.Handler {
+	return http.HandlerFunc(t.serveDebug)
+}
+
+// debugEntry is an Entry as shown by a DebugHandler.
+type debugEntry struct {
+	Host              string            `json:"host"`
+	Source            string            `json:"source"` // preload or dynamic
+	MaxAge            int64             `json:"max_age,omitempty"`
+	IncludeSubDomains bool              `json:"include_subdomains"`
+	Preload           bool              `json:"preload,omitempty"`
+	LongLived         bool              `json:"long_lived,omitempty"`
+	Received          *time.Time        `json:"received,omitempty"`
+	Expires           *time.Time        `json:"expires,omitempty"`
+	Extensions        map[string]string `json:"extensions,omitempty"`
+	LearnedFrom       string            `json:"learned_from,omitempty"` // source of a dynamic entry, see Origin
+	URL               string            `json:"url,omitempty"`
+	Addr              string            `json:"addr,omitempty"`
+}
+
+func newDebugEntry(e Entry) *debugEntry {
+	d := &debugEntry{
+		Host:              e.Host,
+		Source:            "dynamic",
+		IncludeSubDomains: e.IncludeSubDomains,
+		Preload:           e.Preload,
+		LongLived:         e.LongLived,
+		Extensions:        e.Extensions,
+	}
+	if e.Preloaded {
+		d.Source = "preload"
+		return d
+	}
+	d.MaxAge = int64(e.MaxAge / time.Second)
+	d.Received = &e.Received
+	d.LearnedFrom = e.Origin.Source.String()
+	d.URL = e.Origin.URL
+	d.Addr = e.Origin.Addr
+	if expires := e.Expires(); !expires.IsZero() {
+		d.Expires = &expires
+	}
+	return d
+}
+
+// debugPage is what a DebugHandler shows.
+type debugPage struct {
+	Host      string        `json:"host,omitempty"`   // looked up
+	Lookup    *debugEntry   `json:"lookup,omitempty"` // nil if not found
+	Query     string        `json:"q,omitempty"`
+	Entries   []*debugEntry `json:"entries"`
+	Truncated bool          `json:"truncated,omitempty"` // more than maxDebugEntries
+	Stats     Stats         `json:"stats"`
+	Decisions []Decision    `json:"decisions,omitempty"` // see WithDecisionLog
+}
+
+func (t *Transport) serveDebug(w http.ResponseWriter, r *http.Request) {
+	p := debugPage{
+		Host:    strings.TrimSpace(r.FormValue("host")),
+		Query:   strings.ToLower(strings.TrimSpace(r.FormValue("q"))),
+		Entries: []*debugEntry{},
+		Stats:   t.Stats(),
+	}
+	if p.Host != "" {
+		if e, ok := t.Lookup(p.Host); ok {
+			p.Lookup = newDebugEntry(e)
+		}
+	}
+	for _, e := range t.entries(t.now()) {
+		if !strings.Contains(e.Host, p.Query) {
+			continue
+		}
+		if len(p.Entries) == maxDebugEntries {
+			p.Truncated = true
+			break
+		}
+		p.Entries = append(p.Entries, newDebugEntry(e))
+	}
+	host := canonicalize(p.Host)
+	for _, d := range t.Decisions() {
+		if host != "" && d.Host == host || host == "" && strings.Contains(d.Host, p.Query) {
+			p.Decisions = append(p.Decisions, d)
+		}
+	}
+
+	if r.FormValue("format") == "json" || strings.HasPrefix(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(p)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	debugTemplate.Execute(w, p)
+}
+
+var debugTemplate = template.Must(template.New("debug").Parse(`<!DOCTYPE html>
+<html>
+<head><title>HSTS</title></head>
+<body>
+<h1>HSTS</h1>
+<form>
+<input name="host" value="{{.Host}}" placeholder="host">
+<input type="submit" value="Look up">
+</form>
+{{if .Host}}
+{{with .Lookup}}
+<p>{{$.Host}} is covered by {{.Host}} ({{.Source}}{{if .IncludeSubDomains}}, includeSubDomains{{end}}{{with .Expires}}, expires {{.}}{{end}}).</p>
+{{else}}
+<p>{{.Host}} is not a known HSTS host.</p>
+{{end}}
+{{end}}
+
+<h2>Stats</h2>
+<table>
+<tr><td>Preloaded hosts</td><td>{{.Stats.Preloaded}}</td></tr>
+<tr><td>Dynamic hosts</td><td>{{.Stats.Dynamic}}</td></tr>
+<tr><td>Upgrades by preloaded policies</td><td>{{.Stats.UpgradesPreloaded}}</td></tr>
+<tr><td>Upgrades by dynamic policies</td><td>{{.Stats.UpgradesDynamic}}</td></tr>
+{{range $source, $n := .Stats.UpgradesBySource}}<tr><td>Upgrades by {{$source}} policies</td><td>{{$n}}</td></tr>
+{{end}}<tr><td>Bypassed</td><td>{{.Stats.Bypassed}}</td></tr>
+<tr><td>Fallbacks to plaintext</td><td>{{.Stats.Fallbacks}}</td></tr>
+<tr><td>Learned</td><td>{{.Stats.Learned}}</td></tr>
+<tr><td>Added</td><td>{{.Stats.Added}}</td></tr>
+<tr><td>Expired</td><td>{{.Stats.Expired}}</td></tr>
+<tr><td>Knock-outs</td><td>{{.Stats.KnockOuts}}</td></tr>
+<tr><td>Coalesced</td><td>{{.Stats.Coalesced}}</td></tr>
+<tr><td>Evicted</td><td>{{.Stats.Evicted}}</td></tr>
+<tr><td>Storage errors</td><td>{{.Stats.StorageErrors}}</td></tr>
+<tr><td>Lookup hits</td><td>{{.Stats.LookupHits}}</td></tr>
+<tr><td>Lookup misses</td><td>{{.Stats.LookupMisses}}</td></tr>
+</table>
+
+<h2>Most upgraded hosts</h2>
+<table>
+<tr><th>Host</th><th>Upgrades</th></tr>
+{{range .Stats.TopUpgraded}}<tr><td>{{.Host}}</td><td>{{.Count}}</td></tr>
+{{end}}</table>
+
+<h2>Dynamic entries</h2>
+<form>
+<input name="q" value="{{.Query}}" placeholder="filter">
+<input type="submit" value="Filter">
+</form>
+<table>
+<tr><th>Host</th><th>max-age</th><th>includeSubDomains</th><th>preload</th><th>Received</th><th>Expires</th><th>Learned from</th></tr>
+{{range .Entries}}<tr><td>{{.Host}}</td><td>{{.MaxAge}}</td><td>{{.IncludeSubDomains}}</td><td>{{.Preload}}</td><td>{{with .Received}}{{.}}{{end}}</td><td>{{with .Expires}}{{.}}{{else}}never{{end}}</td><td>{{.LearnedFrom}}{{with .URL}} {{.}}{{end}}{{with .Addr}} ({{.}}){{end}}</td></tr>
+{{end}}</table>
+{{if .Truncated}}<p>Only the first {{len .Entries}} entries are shown.</p>{{end}}
+{{with .Decisions}}
+<h2>Recent decisions</h2>
+<table>
+<tr><th>Time</th><th>URL</th><th>Action</th><th>Reason</th></tr>
+{{range .}}<tr><td>{{.Time}}</td><td>{{.URL}}</td><td>{{.Action}}</td><td>{{.Reason}}</td></tr>
+{{end}}</table>
+{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,49 @@
+package hsts
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDebugHandler(t *testing.T) {
+	transport := New(&fakeTransport{})
+	transport.put("example.com", newDirective(time.Now(), time.Hour, flagIncludeSubDomains))
+	transport.put("other.org", newDirective(time.Now(), time.Hour, 0))
+	transport.put("old.org", newDirective(time.Now().Add(-2*time.Hour), time.Hour, 0))
+	h := transport.DebugHandler()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/?format=json&host=Sub.Example.com&q=org", nil))
+	var p debugPage
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Lookup == nil || p.Lookup.Host != "example.com" || p.Lookup.Source != "dynamic" || p.Lookup.MaxAge != 3600 || p.Lookup.Expires == nil {
+		t.Errorf("got lookup %+v; want dynamic example.com", p.Lookup)
+	}
+	if len(p.Entries) != 1 || p.Entries[0].Host != "other.org" {
+		t.Errorf("got entries %+v; want only other.org", p.Entries)
+	}
+	if p.Stats.Dynamic != 3 {
+		t.Errorf("got stats %+v", p.Stats)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/?host=<b>x</b>", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("got content type %v; want HTML", ct)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{"not a known HSTS host", "<td>example.com</td>", "&lt;b&gt;x&lt;/b&gt;"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("HTML missing %q", want)
+		}
+	}
+	if rec.Code != http.StatusOK {
+		t.Errorf("got status %v", rec.Code)
+	}
+}
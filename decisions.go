@@ -0,0 +1,140 @@
+package hsts
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// An Action is what a Transport decided about a request or response, see
+// Decision.
+type Action int
+
+const (
+	// ActionUpgrade is a plaintext request upgraded to HTTPS.
+	ActionUpgrade Action = iota
+
+	// ActionSkip is a plaintext request not upgraded.
+	ActionSkip
+
+	// ActionFail is a plaintext request failed instead of upgraded, see
+	// Upgrade.Err.
+	ActionFail
+
+	// ActionLearn is a Strict-Transport-Security header changing the state.
+	ActionLearn
+
+	// ActionIgnore is a Strict-Transport-Security header ignored.
+	ActionIgnore
+)
+
+var actionNames = [...]string{"upgrade", "skip", "fail", "learn", "ignore"}
+
+func (a Action) String() string {
+	if a < 0 || int(a) >= len(actionNames) {
+		return fmt.Sprintf("Action(%d)", int(a))
+	}
+	return actionNames[a]
+}
+
+// MarshalText marshals an action as its name, for JSON.
+func (a Action) MarshalText() ([]byte, error) {
+	if a < 0 || int(a) >= len(actionNames) {
+		return nil, fmt.Errorf("hsts: invalid action %d", int(a))
+	}
+	return []byte(actionNames[a]), nil
+}
+
+// A Decision is what a Transport decided about a request or its response,
+// and why, as kept WithDecisionLog.
+type Decision struct {
+	Time   time.Time `json:"time"`
+	Host   string    `json:"host"` // of the request
+	URL    string    `json:"url"`  // of the request, without credentials, query and fragment
+	Action Action    `json:"action"`
+	Reason string    `json:"reason"` // e.g. no policy, expired, IP literal, learned new, knocked out
+}
+
+// WithDecisionLog keeps the last n decisions of the Transport in memory:
+// plaintext requests upgraded or not, and Strict-Transport-Security headers
+// learned or ignored, with why, to answer why a request was not upgraded.
+// They are returned by Decisions and shown by DebugHandler. It is 0 by
+// default, which keeps none.
+func WithDecisionLog(n int) Option {
+	return func(t *Transport) {
+		t.decisionLogSize = n
+	}
+}
+
+// A decisionLog is a ring buffer of the last decisions.
+type decisionLog struct {
+	m         sync.Mutex // protects all below
+	decisions []Decision
+	next      int // where the next decision goes
+	full      bool
+}
+
+func newDecisionLog(size int) *decisionLog {
+	if size <= 0 {
+		return nil
+	}
+	return &decisionLog{decisions: make([]Decision, size)}
+}
+
+func (l *decisionLog) add(d Decision) {
+	l.m.Lock()
+	defer l.m.Unlock()
+	l.decisions[l.next] = d
+	l.next++
+	if l.next == len(l.decisions) {
+		l.next = 0
+		l.full = true
+	}
+}
+
+// all returns the decisions, oldest first.
+func (l *decisionLog) all() []Decision {
+	if l == nil {
+		return nil
+	}
+	l.m.Lock()
+	defer l.m.Unlock()
+	if !l.full {
+		return append([]Decision(nil), l.decisions[:l.next]...)
+	}
+	all := make([]Decision, 0, len(l.decisions))
+	all = append(all, l.decisions[l.next:]...)
+	return append(all, l.decisions[:l.next]...)
+}
+
+// Decisions returns the last decisions of the Transport, oldest first, or
+// nil unless kept WithDecisionLog.
+func (t *Transport) Decisions() []Decision {
+	return t.decisionLog.all()
+}
+
+// decide logs a decision about a request, if keeping them.
+func (t *Transport) decide(req *http.Request, host string, action Action, reason string) {
+	if t.decisionLog == nil {
+		return
+	}
+	t.decisionLog.add(Decision{
+		Time:   t.now(),
+		Host:   host,
+		URL:    originURL(req.URL),
+		Action: action,
+		Reason: reason,
+	})
+}
+
+// upgradeReason tells why a request was upgraded.
+func upgradeReason(up Upgrade) string {
+	switch {
+	case up.HTTPSRecord:
+		return "DNS HTTPS record"
+	case up.Preloaded:
+		return "preloaded policy of " + up.Host
+	}
+	return "learned policy of " + up.Host
+}
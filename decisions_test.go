@@ -0,0 +1,63 @@
+package hsts
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecisionLog(t *testing.T) {
+	transport := New(&fakeTransport{}, WithDecisionLog(3))
+	transport.put("old.example", newDirective(time.Now().Add(-2*time.Hour), time.Hour, 0))
+	var got []string
+	for _, url := range []string{
+		"http://127.0.0.1/",
+		"http://localhost/",
+		"http://example.com/",
+		"http://old.example/",
+		"https://example.com/?token=secret",
+		"https://example.com/",
+		"http://sub.example.com/",
+	} {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		decisions := transport.Decisions()
+		d := decisions[len(decisions)-1]
+		got = append(got, d.Host+" "+d.URL+" "+d.Action.String()+": "+d.Reason)
+	}
+	want := []string{
+		"127.0.0.1 http://127.0.0.1/ skip: IP literal",
+		"localhost http://localhost/ skip: local host excluded",
+		"example.com http://example.com/ skip: no policy",
+		"old.example http://old.example/ skip: expired",
+		"example.com https://example.com/ learn: learned new",
+		"example.com https://example.com/ ignore: coalesced",
+		"sub.example.com http://sub.example.com/ upgrade: learned policy of example.com",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got decisions\n%v\nwant\n%v", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if n := len(transport.Decisions()); n != 3 {
+		t.Errorf("kept %v decisions; want the last 3", n)
+	}
+
+	w := httptest.NewRecorder()
+	transport.DebugHandler().ServeHTTP(w, httptest.NewRequest("GET", "/?host=sub.example.com", nil))
+	if body := w.Body.String(); !strings.Contains(body, "learned policy of example.com") || strings.Contains(body, "coalesced") {
+		t.Errorf("debug page does not show the decisions about sub.example.com only:\n%v", body)
+	}
+
+	if New(nil).Decisions() != nil {
+		t.Error("decisions kept by default")
+	}
+}
@@ -0,0 +1,41 @@
+package hsts
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// A PlaintextError is returned by dials refused by DialContext.
+type PlaintextError struct {
+	Addr string // dialed
+	Host string // known HSTS host whose policy applies
+}
+
+func (e *PlaintextError) Error() string {
+	return fmt.Sprintf("hsts: plaintext connection to %v refused, %v is a known HSTS host", e.Addr, e.Host)
+}
+
+// DialContext wraps a dial function to refuse TCP connections to port 80 of
+// known HSTS hosts, as seen by state (e.g. Transport.State), so that code
+// bypassing the Transport cannot talk plaintext HTTP to them either.
+// Dials fail with a *PlaintextError. If dial is nil, a net.Dialer is used.
+// It can be set as the DialContext of an http.Transport, or a net.Dialer's
+// used anywhere else.
+func DialContext(state StateReader, dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if dial == nil {
+		var d net.Dialer
+		dial = d.DialContext
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if strings.HasPrefix(network, "tcp") {
+			if host, port, err := net.SplitHostPort(addr); err == nil && (port == "80" || port == "http") {
+				if e, ok := state.Lookup(host); ok {
+					return nil, &PlaintextError{Addr: addr, Host: e.Host}
+				}
+			}
+		}
+		return dial(ctx, network, addr)
+	}
+}
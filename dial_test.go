@@ -0,0 +1,40 @@
+package hsts
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestDialContext(t *testing.T) {
+	transport := New(nil)
+	transport.add("example.com", newDirective(transport.now(), time.Hour, flagIncludeSubDomains))
+	var dialed []string
+	dial := DialContext(transport.State(), func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed = append(dialed, addr)
+		return nil, errors.New("fake")
+	})
+	for _, tt := range []struct {
+		network, addr string
+		refused       bool
+	}{
+		{"tcp", "example.com:80", true},
+		{"tcp4", "sub.example.com:http", true},
+		{"tcp", "Example.COM.:80", true},
+		{"tcp", "example.com:443", false},
+		{"tcp", "example.net:80", false},
+		{"udp", "example.com:80", false},
+	} {
+		dialed = nil
+		_, err := dial(context.Background(), tt.network, tt.addr)
+		var plaintext *PlaintextError
+		if refused := errors.As(err, &plaintext); refused != tt.refused || (len(dialed) == 0) != tt.refused {
+			t.Errorf("dial(%v, %v) got error %v, dialed %v; want refused %v", tt.network, tt.addr, err, dialed, tt.refused)
+		}
+		if plaintext != nil && plaintext.Host != "example.com" {
+			t.Errorf("dial(%v, %v) got host %v; want example.com", tt.network, tt.addr, plaintext.Host)
+		}
+	}
+}
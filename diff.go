@@ -0,0 +1,88 @@
+package hsts
+
+import (
+	"sort"
+	"time"
+)
+
+// A StateSnapshot is the dynamic entries of a Transport at a time, e.g. to
+// save daily and compare with DiffStates. It can be marshaled to JSON.
+type StateSnapshot struct {
+	Time    time.Time
+	Entries []Entry // sorted by host
+}
+
+// Snapshot returns the dynamic entries of the Transport which have not
+// expired, as of now.
+func (t *Transport) Snapshot() StateSnapshot {
+	now := t.now()
+	return StateSnapshot{Time: now, Entries: t.entries(now)}
+}
+
+// A Diff is how the dynamic entries of a state differ from another, see
+// DiffStates.
+type Diff struct {
+	Added   []Entry       // hosts only in the new state
+	Removed []Entry       // hosts only in the old state, removed or expired
+	Changed []EntryChange // hosts in both, with another max-age or includeSubDomains
+}
+
+// An EntryChange is a change to the policy of a host between two states.
+type EntryChange struct {
+	Host     string
+	Old, New Entry
+}
+
+// Weakened tells whether the policy was weakened: its max-age is shorter,
+// or it no longer includes subdomains.
+func (c EntryChange) Weakened() bool {
+	return c.New.MaxAge < c.Old.MaxAge || (c.Old.IncludeSubDomains && !c.New.IncludeSubDomains)
+}
+
+// Empty tells whether the states do not differ.
+func (d Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Weakened returns the changes which weakened a policy, see
+// EntryChange.Weakened. Along with Removed, they are what to alert on.
+func (d Diff) Weakened() []EntryChange {
+	var weakened []EntryChange
+	for _, c := range d.Changed {
+		if c.Weakened() {
+			weakened = append(weakened, c)
+		}
+	}
+	return weakened
+}
+
+// DiffStates reports how the dynamic entries of state b differ from those
+// of an older state a, sorted by host. Policies only renewed, received again
+// the same, are not changed.
+func DiffStates(a, b StateSnapshot) Diff {
+	old := make(map[string]Entry, len(a.Entries))
+	for _, e := range a.Entries {
+		old[e.Host] = e
+	}
+	var d Diff
+	seen := make(map[string]bool, len(b.Entries))
+	for _, e := range b.Entries {
+		seen[e.Host] = true
+		o, ok := old[e.Host]
+		switch {
+		case !ok:
+			d.Added = append(d.Added, e)
+		case o.MaxAge != e.MaxAge || o.IncludeSubDomains != e.IncludeSubDomains:
+			d.Changed = append(d.Changed, EntryChange{Host: e.Host, Old: o, New: e})
+		}
+	}
+	for _, e := range a.Entries {
+		if !seen[e.Host] {
+			d.Removed = append(d.Removed, e)
+		}
+	}
+	sort.Slice(d.Added, func(i, j int) bool { return d.Added[i].Host < d.Added[j].Host })
+	sort.Slice(d.Removed, func(i, j int) bool { return d.Removed[i].Host < d.Removed[j].Host })
+	sort.Slice(d.Changed, func(i, j int) bool { return d.Changed[i].Host < d.Changed[j].Host })
+	return d
+}
@@ -0,0 +1,71 @@
+package hsts
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiffStates(t *testing.T) {
+	now := time.Now()
+	day := now.Add(24 * time.Hour)
+	transport := New(nil, WithClock(func() time.Time { return now }))
+	transport.add("same.com", newDirective(now, 48*time.Hour, 0))
+	transport.add("renewed.com", newDirective(now, 48*time.Hour, 0))
+	transport.add("shortened.com", newDirective(now, 48*time.Hour, flagIncludeSubDomains))
+	transport.add("dropped.com", newDirective(now, 48*time.Hour, flagIncludeSubDomains))
+	transport.add("longer.com", newDirective(now, 48*time.Hour, 0))
+	transport.add("removed.com", newDirective(now, 48*time.Hour, 0))
+	transport.add("expired.com", newDirective(now, time.Hour, 0))
+	a := transport.Snapshot()
+
+	// A snapshot saved and loaded compares the same.
+	b, err := json.Marshal(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var loaded StateSnapshot
+	if err := json.Unmarshal(b, &loaded); err != nil {
+		t.Fatal(err)
+	}
+	if d := DiffStates(loaded, a); !d.Empty() {
+		t.Errorf("diff with itself is %+v; want empty", d)
+	}
+
+	now = day
+	transport.add("renewed.com", newDirective(now, 48*time.Hour, 0))
+	transport.add("shortened.com", newDirective(now, time.Hour, flagIncludeSubDomains))
+	transport.add("dropped.com", newDirective(now, 48*time.Hour, 0))
+	transport.add("longer.com", newDirective(now, 96*time.Hour, 0))
+	transport.add("removed.com", directive{})
+	transport.add("added.com", newDirective(now, time.Hour, 0))
+	d := DiffStates(a, transport.Snapshot())
+
+	hosts := func(entries []Entry) []string {
+		var hosts []string
+		for _, e := range entries {
+			hosts = append(hosts, e.Host)
+		}
+		return hosts
+	}
+	if got, want := hosts(d.Added), []string{"added.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("added %v; want %v", got, want)
+	}
+	if got, want := hosts(d.Removed), []string{"expired.com", "removed.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("removed %v; want %v", got, want)
+	}
+	var changed, weakened []string
+	for _, c := range d.Changed {
+		changed = append(changed, c.Host)
+	}
+	for _, c := range d.Weakened() {
+		weakened = append(weakened, c.Host)
+	}
+	if want := []string{"dropped.com", "longer.com", "shortened.com"}; !reflect.DeepEqual(changed, want) {
+		t.Errorf("changed %v; want %v", changed, want)
+	}
+	if want := []string{"dropped.com", "shortened.com"}; !reflect.DeepEqual(weakened, want) {
+		t.Errorf("weakened %v; want %v", weakened, want)
+	}
+}
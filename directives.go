@@ -1,94 +1,373 @@
 package hsts
 
 import (
+	"fmt"
 	"strconv"
 	"strings"
 	"time"
 )
 
 // A directive stores HSTS state information for a given host.
+// There may be many so it is compact and stored by value: times are in
+// seconds and booleans are flags.
 type directive struct {
-	received          time.Time
-	maxAge            time.Duration
-	includeSubDomains bool
+	expires int64  // Unix time in seconds, 0 if preloaded
+	maxAge  uint32 // in seconds, fits maxMaxAge
+	flags   uint8  // see flagIncludeSubDomains etc.
+	meta    *meta  // extensions and origin, nil if neither
 }
 
-// parse parses a Strict-Transport-Security header as specified in section 6.1.
-// Section 6.1 requirements 4 & 5 say to ignore non-conformance so no error is returned.
-func parse(header string) *directive {
-	// Use a map as a set to check for unicity (6.1 requirement 2).
-	directives := make(map[string]struct{})
+// Flags of a directive.
+const (
+	flagIncludeSubDomains = 1 << iota
+	flagPreload           // requested preload
+	flagLongLived         // does not expire, see WithLongLivedPreload
+	flagTombstone         // preloaded host removed, see tombstone
+)
+
+// newDirective creates a dynamic directive received at a time.
+func newDirective(received time.Time, maxAge time.Duration, flags uint8) directive {
+	secs := int64(maxAge / time.Second)
+	return directive{expires: received.Unix() + secs, maxAge: uint32(secs), flags: flags}
+}
+
+func (d directive) includeSubDomains() bool { return d.flags&flagIncludeSubDomains != 0 }
+func (d directive) preload() bool           { return d.flags&flagPreload != 0 }
+func (d directive) longLived() bool         { return d.flags&flagLongLived != 0 }
+
+// preloaded tells whether a directive comes from the preload list.
+func (d directive) preloaded() bool {
+	return d.expires == 0
+}
+
+// received returns when a dynamic directive was received, to the second.
+func (d directive) received() time.Time {
+	if d.preloaded() {
+		return time.Time{}
+	}
+	return time.Unix(d.expires-int64(d.maxAge), 0)
+}
 
-	// Known directives.
+// age returns the max-age of a directive.
+func (d directive) age() time.Duration {
+	return time.Duration(d.maxAge) * time.Second
+}
+
+// expired tells whether a directive has expired.
+// Preloaded and long-lived directives do not expire.
+func (d directive) expired(now time.Time) bool {
+	return !d.preloaded() && !d.longLived() && now.Unix() > d.expires
+}
+
+// maxMaxAge is the maximum max-age, to which larger values are clamped.
+// It avoids overflowing time.Duration (about 292 years).
+const maxMaxAge = 100 * 365 * 24 * time.Hour
+
+// parseMaxAge parses a max-age value, which section 6.1.1 defines as
+// delta-seconds (1*DIGIT) so signs, spaces or anything but digits do not conform.
+func parseMaxAge(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	for _, c := range value {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+	}
+	secs, err := strconv.ParseUint(value, 10, 64)
+	if err != nil || secs > uint64(maxMaxAge/time.Second) {
+		return maxMaxAge, true // only digits so it can only be out of range
+	}
+	return time.Duration(secs) * time.Second, true
+}
+
+// Limits of the extensions kept from a header, others are ignored.
+const (
+	maxExtensions      = 16
+	maxExtensionLength = 256 // of names and values
+)
+
+// A HeaderError describes why a Strict-Transport-Security header was rejected.
+type HeaderError struct {
+	Header    string // the header value
+	Directive string // the offending directive, if any
+	Reason    string
+}
+
+func (e *HeaderError) Error() string {
+	if e.Directive != "" {
+		return fmt.Sprintf("hsts: invalid header %q: directive %q: %s", e.Header, e.Directive, e.Reason)
+	}
+	return fmt.Sprintf("hsts: invalid header %q: %s", e.Header, e.Reason)
+}
+
+// ParseHeader parses a Strict-Transport-Security header value like a browser,
+// ignoring non-conforming directives and values (section 6.1 requirements 4 & 5).
+// An error is only returned if no valid max-age directive is left.
+// Use ValidateHeader to check strict conformance.
+func ParseHeader(header string) (Policy, error) {
+	return parse(header, nil)
+}
+
+// ValidateHeader strictly validates a Strict-Transport-Security header against
+// the grammar of section 6.1, instead of ignoring non-conformance like browsers do.
+// The returned error, if any, is a *HeaderError telling why it was rejected.
+// Use LintHeader to get all non-conformances at once, and advice.
+func ValidateHeader(header string) error {
+	var err error
+	parse(header, func(directive, code, reason string) {
+		if err == nil {
+			err = &HeaderError{Header: header, Directive: directive, Reason: reason}
+		}
+	})
+	return err
+}
+
+// parse parses a Strict-Transport-Security header as specified in section 6.1.
+// Section 6.1 requirements 4 & 5 say to ignore non-conformance so an error is
+// only returned when no valid max-age directive is left.
+// If report is not nil, it is called for each non-conformance with the
+// offending directive, a code and the reason, for ValidateHeader and LintHeader.
+func parse(header string, report func(directive, code, reason string)) (Policy, error) {
+	// Known directives, and whether they were seen to check for unicity
+	// (6.1 requirement 2).
 	var maxAge time.Duration
-	var includeSubDomains bool
+	var hasMaxAge, seenMaxAge bool
+	var includeSubDomains, seenIncludeSubDomains bool
+	var preload, seenPreload bool
+
+	// Unknown directives: name -> value, and the set of names seen.
+	// They are only allocated when needed since headers rarely have any.
+	var extensions map[string]string
+	var names map[string]struct{}
+
+	// seen tells whether a directive was seen already, and marks it seen.
+	seen := func(name string) bool {
+		var b *bool
+		switch name {
+		case "max-age":
+			b = &seenMaxAge
+		case "includesubdomains":
+			b = &seenIncludeSubDomains
+		case "preload":
+			b = &seenPreload
+		default:
+			_, ok := names[name]
+			if names == nil {
+				names = make(map[string]struct{})
+			}
+			names[name] = struct{}{}
+			return ok
+		}
+		ok := *b
+		*b = true
+		return ok
+	}
+
+	strict := report != nil
+	invalid := func(directive, code, reason string) {
+		report(strings.TrimSpace(directive), code, reason)
+	}
 
 	// Section 6.1 defines the grammar as:
 	//   Strict-Transport-Security = [ directive ]  *( ";" [ directive ] )
 	//   directive                 = directive-name [ "=" directive-value ]
 	//   directive-name            = token
 	//   directive-value           = token | quoted-string
-	for _, directive := range strings.Split(header, ";") {
-		var name, value string
+	for rest, more := header, true; more; {
+		var directive string
+		directive, rest, more = next(rest)
 
 		// Grammar says directive value is optional.
-		if strings.Contains(directive, "=") {
-			nv := strings.SplitN(directive, "=", 2)
-			name = nv[0]
-			value = nv[1]
-		} else {
-			name = directive
+		name, value := directive, ""
+		i := strings.IndexByte(directive, '=')
+		hasValue := i >= 0
+		if hasValue {
+			name, value = directive[:i], directive[i+1:]
+		}
+
+		if strict {
+			// Whitespace is only allowed around directives.
+			if hasValue && (strings.TrimRight(name, " \t") != name || strings.TrimLeft(value, " \t") != value) {
+				invalid(directive, CodeSyntax, "whitespace around =")
+			}
 		}
 
 		name = strings.TrimSpace(name)
 		value = strings.TrimSpace(value)
 
-		name = strings.ToLower(name) // Section 6.1 requirement 3.
+		if name == "" && !hasValue {
+			continue // Grammar says directives are optional.
+		}
+		if strict && !isToken(name) {
+			invalid(directive, CodeSyntax, "directive name is not a token")
+		}
+
+		name = lowerName(name) // Section 6.1 requirement 3.
 
-		if _, ok := directives[name]; ok {
+		if seen(name) {
 			// Section 6.1 requirement 2 says directives must appear only once
 			// and requirements 4 & 5 say to ignore directives that do not conform
 			// so we ignore duplicates.
+			if strict {
+				invalid(directive, CodeDuplicate, "duplicate directive")
+			}
 			continue
 		}
-		directives[name] = struct{}{}
 
 		// Grammar says directive value can be be a quoted string.
-		if strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) {
-			v, err := strconv.Unquote(value)
-			if err != nil {
+		quoted := strings.HasPrefix(value, `"`)
+		if quoted {
+			v, ok := unquote(value)
+			if !ok {
 				// Section 6.1 requirement 4 says to ignore non-conforming values.
+				if strict {
+					invalid(directive, CodeSyntax, "invalid quoted-string")
+				}
 				continue
 			}
 			value = v
+		} else if strict && hasValue && !isToken(value) {
+			invalid(directive, CodeSyntax, "directive value is not a token or quoted-string")
+			continue
 		}
 
 		switch name { // Note it's been lowercased
 		case "max-age":
-			secs, err := strconv.Atoi(value)
-			if err != nil {
+			d, ok := parseMaxAge(value)
+			if !ok {
 				// Section 6.1 requirement 4 says to ignore non-conforming values.
+				if strict {
+					invalid(directive, CodeMaxAgeInvalid, "max-age is not delta-seconds")
+				}
 				continue
 			}
-			maxAge = time.Duration(secs) * time.Second
+			maxAge = d
+			hasMaxAge = true
 		case "includesubdomains":
-			if value != "" {
+			if hasValue {
 				// Section 6.1 requirement 4 says to ignore non-conforming values.
+				if strict {
+					invalid(directive, CodeUnexpectedValue, "includeSubDomains has no value")
+				}
 				continue
 			}
 			includeSubDomains = true
+		case "preload":
+			// Not in RFC 6797, it requests inclusion in the preload list
+			// (https://hstspreload.org) and has no value either.
+			if hasValue {
+				if strict {
+					invalid(directive, CodeUnexpectedValue, "preload has no value")
+				}
+				continue
+			}
+			preload = true
+		default:
+			// Section 6.1 requirements 4 & 5 say to ignore non-conforming
+			// directives, which could not be rendered back either.
+			if !isToken(name) || (hasValue && !quoted && !isToken(value)) {
+				continue
+			}
+			// Extensions are kept in the state of hosts and headers are
+			// controlled by servers, so they are bounded.
+			if len(extensions) == maxExtensions || len(name) > maxExtensionLength || len(value) > maxExtensionLength {
+				continue
+			}
+			if extensions == nil {
+				extensions = make(map[string]string)
+			}
+			extensions[name] = value
 		}
 	}
 
 	// Section 6.1.1 says the max-age directive is required and section 6.1
 	// requirements 4 & 5 say to ignore non-conformance, so we ignore all of it.
-	if _, ok := directives["max-age"]; !ok {
-		return nil
+	if !hasMaxAge {
+		if strict {
+			invalid("", CodeMaxAgeMissing, "missing max-age directive")
+		}
+		return Policy{}, &HeaderError{Header: header, Reason: "missing max-age directive"}
 	}
 
-	return &directive{
-		received:          time.Now(),
-		maxAge:            maxAge,
-		includeSubDomains: includeSubDomains,
+	return Policy{
+		MaxAge:            maxAge,
+		IncludeSubDomains: includeSubDomains,
+		Preload:           preload,
+		Extensions:        extensions,
+	}, nil
+}
+
+// lowerName lowercases a directive name, without allocating for known ones.
+func lowerName(name string) string {
+	for _, known := range []string{"max-age", "includesubdomains", "preload"} {
+		if strings.EqualFold(name, known) {
+			return known
+		}
+	}
+	return strings.ToLower(name)
+}
+
+// next returns the first directive of a header split on ";" except within
+// quoted-strings, the rest of the header, and whether there is more after it.
+func next(header string) (directive, rest string, more bool) {
+	quoted := false
+	for i := 0; i < len(header); i++ {
+		switch c := header[i]; {
+		case quoted && c == '\\':
+			i++ // quoted-pair
+		case c == '"':
+			quoted = !quoted
+		case !quoted && c == ';':
+			return header[:i], header[i+1:], true
+		}
+	}
+	return header, "", false
+}
+
+// isToken tells whether s is a token as defined in RFC 7230 section 3.2.6.
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case '0' <= c && c <= '9', 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z':
+		case strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// unquote unquotes a quoted-string as defined in RFC 7230 section 3.2.6.
+func unquote(s string) (string, bool) {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return "", false
+	}
+	var b strings.Builder
+	b.Grow(len(s) - 2)
+	for i := 1; i < len(s)-1; i++ {
+		c := s[i]
+		switch {
+		case c == '\\':
+			i++
+			if i == len(s)-1 {
+				return "", false // escaped closing quote
+			}
+			if e := s[i]; e < ' ' && e != '\t' || e == 0x7f {
+				return "", false // quoted-pair of a control character
+			}
+			b.WriteByte(s[i])
+		case c == '"':
+			return "", false // unescaped quote inside
+		case c < ' ' && c != '\t', c == 0x7f:
+			return "", false // control character
+		default:
+			b.WriteByte(c)
+		}
 	}
+	return b.String(), true
 }
@@ -1,16 +1,21 @@
 package hsts
 
 import (
+	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
+	"unsafe"
 )
 
-func TestDirectives(t *testing.T) {
+func TestParseHeader(t *testing.T) {
 	for _, tt := range []struct {
 		parse             string
 		invalid           bool
 		maxAge            time.Duration
 		includeSubDomains bool
+		preload           bool
 	}{
 		// completely valid
 		{
@@ -40,6 +45,12 @@ func TestDirectives(t *testing.T) {
 			maxAge:            1234 * time.Second,
 			includeSubDomains: true,
 		},
+		{
+			parse:             "max-age=31536000; includeSubDomains; preload",
+			maxAge:            31536000 * time.Second,
+			includeSubDomains: true,
+			preload:           true,
+		},
 
 		// valid with invalid directives ignored
 		{ // ignore the second value
@@ -52,6 +63,24 @@ func TestDirectives(t *testing.T) {
 			includeSubDomains: true,
 		},
 
+		{ // clamp very large values
+			parse:  "max-age=99999999999999",
+			maxAge: maxMaxAge,
+		},
+		{ // leading zeros are digits too
+			parse:  "max-age=0042",
+			maxAge: 42 * time.Second,
+		},
+
+		{ // preload has no value
+			parse:  "max-age=1234; preload=yes",
+			maxAge: 1234 * time.Second,
+		},
+		{ // quoted-string can contain separators and quoted-pairs
+			parse:  `foo="a;b\"c"; max-age=1234`,
+			maxAge: 1234 * time.Second,
+		},
+
 		// plain invalid
 		{
 			parse:   `max-age='1234'`,
@@ -61,20 +90,160 @@ func TestDirectives(t *testing.T) {
 			parse:   "includeSubDomains",
 			invalid: true, // required max-age directive missing
 		},
+		{
+			parse:   "max-age=-1",
+			invalid: true, // sign not allowed
+		},
+		{
+			parse:   "max-age=+1234",
+			invalid: true, // sign not allowed
+		},
+		{
+			parse:   "max-age=12a4",
+			invalid: true, // non-digit
+		},
+		{
+			parse:   "max-age=1 234",
+			invalid: true, // non-digit
+		},
+		{
+			parse:   "max-age=",
+			invalid: true, // empty
+		},
+		{
+			parse:   "max-age=abc; max-age=1234",
+			invalid: true, // first is invalid, second is a duplicate
+		},
 	} {
-		d := parse(tt.parse)
-		if d == nil {
+		p, err := ParseHeader(tt.parse)
+		if err != nil {
 			if !tt.invalid {
-				t.Errorf("parse(%v) returned invalid but wanted valid", tt.parse)
+				t.Errorf("ParseHeader(%v) returned invalid but wanted valid: %v", tt.parse, err)
 			}
 			continue
 		}
-		if d.maxAge != tt.maxAge {
-			t.Errorf("parse(%v) got max age %d; want %d", tt.parse, d.maxAge, tt.maxAge)
+		if tt.invalid {
+			t.Errorf("ParseHeader(%v) returned valid but wanted invalid", tt.parse)
+			continue
 		}
-		if d.includeSubDomains != tt.includeSubDomains {
-			t.Errorf("parse(%v) got includeSubDomains %v; want %v", tt.parse,
-				d.includeSubDomains, tt.includeSubDomains)
+		if p.MaxAge != tt.maxAge {
+			t.Errorf("ParseHeader(%v) got max age %d; want %d", tt.parse, p.MaxAge, tt.maxAge)
 		}
+		if p.IncludeSubDomains != tt.includeSubDomains {
+			t.Errorf("ParseHeader(%v) got includeSubDomains %v; want %v", tt.parse,
+				p.IncludeSubDomains, tt.includeSubDomains)
+		}
+		if p.Preload != tt.preload {
+			t.Errorf("ParseHeader(%v) got preload %v; want %v", tt.parse, p.Preload, tt.preload)
+		}
+	}
+}
+
+func TestParseHeaderExtensions(t *testing.T) {
+	p, err := ParseHeader(`max-age=1234; Foo=bar; baz; qux="a;b"; preload`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"foo": "bar", "baz": "", "qux": "a;b"}
+	if len(p.Extensions) != len(want) {
+		t.Fatalf("got extensions %v; want %v", p.Extensions, want)
+	}
+	for k, v := range want {
+		if got, ok := p.Extensions[k]; !ok || got != v {
+			t.Errorf("extension %v got %q; want %q", k, got, v)
+		}
+	}
+	if p, _ := ParseHeader("max-age=1234"); p.Extensions != nil {
+		t.Errorf("got extensions %v; want none", p.Extensions)
+	}
+}
+
+func TestValidateHeader(t *testing.T) {
+	for _, tt := range []struct {
+		header string
+		valid  bool
+	}{
+		{"max-age=1234", true},
+		{`max-age="1234"`, true},
+		{" max-age=1234 ; includeSubDomains ; preload ", true},
+		{"max-age=1234;;includeSubDomains", true}, // empty directives are allowed
+		{`max-age=1234; ext="quoted; \"value\""`, true},
+		{"max-age=1234; ext=token", true},
+
+		{"", false},
+		{"includeSubDomains", false},          // missing max-age
+		{"max-age = 1234", false},             // whitespace around =
+		{"max-age= 1234", false},              // whitespace around =
+		{"max-age=1234; max-age=1234", false}, // duplicate
+		{"max-age=-1", false},                 // not delta-seconds
+		{`max-age="12 34"`, false},            // not delta-seconds
+		{"max-age=1234; includeSubDomains=", false},
+		{"max-age=1234; preload=1", false},
+		{"max-age=1234; ext=a b", false},    // value not a token
+		{"max-age=1234; ext=\"open", false}, // unterminated quoted-string
+		{"max-age=1234; e@t", false},        // name not a token
+		{"max-age=1234; =value", false},     // no name
+		{"max-age=1234, includeSubDomains", false},
+	} {
+		err := ValidateHeader(tt.header)
+		if (err == nil) != tt.valid {
+			t.Errorf("ValidateHeader(%q) got error %v; want valid %v", tt.header, err, tt.valid)
+		}
+		if err != nil {
+			if _, ok := err.(*HeaderError); !ok {
+				t.Errorf("ValidateHeader(%q) got error type %T; want *HeaderError", tt.header, err)
+			}
+		}
+	}
+}
+
+func TestDirective(t *testing.T) {
+	if size := unsafe.Sizeof(directive{}); size > 24 {
+		t.Errorf("directive is %v bytes; want at most 24", size)
+	}
+	received := time.Unix(1000, 0)
+	d := newDirective(received, maxMaxAge, flagIncludeSubDomains|flagPreload)
+	if !d.received().Equal(received) || d.age() != maxMaxAge || !d.includeSubDomains() || !d.preload() || d.longLived() {
+		t.Errorf("got %+v", d)
+	}
+	if d.preloaded() || d.expired(received.Add(maxMaxAge)) || !d.expired(received.Add(maxMaxAge+time.Second)) {
+		t.Errorf("got wrong expiry for %+v", d)
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseHeader(`max-age=31536000; includeSubDomains; preload; report-uri="https://example.com/r"`); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestParseHeaderExtensionsBounded(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("max-age=1234")
+	for i := 0; i < 2*maxExtensions; i++ {
+		fmt.Fprintf(&b, "; ext%d=%d", i, i)
+	}
+	fmt.Fprintf(&b, "; long=%s; %s", strings.Repeat("a", maxExtensionLength+1), strings.Repeat("b", maxExtensionLength+1))
+	p, err := ParseHeader(b.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Extensions) != maxExtensions {
+		t.Errorf("got %d extensions; want %d", len(p.Extensions), maxExtensions)
+	}
+	if _, ok := p.Extensions["long"]; ok {
+		t.Error("got a long extension value; want it ignored")
+	}
+
+	// Non-conforming extensions are ignored.
+	p, err = ParseHeader("max-age=1234; e@t=1; ext=a b; ok=1; q=\"\\\r\"")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"ok": "1"}; !reflect.DeepEqual(p.Extensions, want) {
+		t.Errorf("got extensions %q; want %q", p.Extensions, want)
 	}
 }
@@ -0,0 +1,60 @@
+package hsts
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Environment variables read by FromEnv.
+const (
+	envStateFile      = "HSTS_STATE_FILE"
+	envDisablePreload = "HSTS_DISABLE_PRELOAD"
+	envMode           = "HSTS_MODE"
+)
+
+// FromEnv returns an option configuring a Transport from environment
+// variables, so that operators can tune programs which opt in without
+// changing their code:
+//
+//   - HSTS_STATE_FILE keeps learned policies in a file (see OpenStateFile
+//     and WithStorage), written a second after changes as it is never
+//     closed.
+//   - HSTS_DISABLE_PRELOAD, a boolean (see strconv.ParseBool), turns the
+//     preload list off (see WithPreloadList).
+//   - HSTS_MODE is enforce (the default) or report, which only observes
+//     (see WithObserveOnly).
+//
+// Variables unset or empty leave the defaults, or the options before it, as
+// is. Invalid values are errors, and so is a state file which cannot be read.
+func FromEnv() (Option, error) {
+	var opts []Option
+	if path := os.Getenv(envStateFile); path != "" {
+		storage, err := OpenStateFile(path)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithStorage(storage))
+	}
+	if v := os.Getenv(envDisablePreload); v != "" {
+		disable, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("hsts: invalid %v %q", envDisablePreload, v)
+		}
+		opts = append(opts, WithPreloadList(!disable))
+	}
+	switch v := os.Getenv(envMode); v {
+	case "":
+	case "enforce":
+		opts = append(opts, WithObserveOnly(false))
+	case "report":
+		opts = append(opts, WithObserveOnly(true))
+	default:
+		return nil, fmt.Errorf("hsts: invalid %v %q, want enforce or report", envMode, v)
+	}
+	return func(t *Transport) {
+		for _, opt := range opts {
+			opt(t)
+		}
+	}, nil
+}
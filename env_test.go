@@ -0,0 +1,94 @@
+package hsts
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFromEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hsts.json")
+	t.Setenv("HSTS_STATE_FILE", path)
+	t.Setenv("HSTS_DISABLE_PRELOAD", "true")
+	t.Setenv("HSTS_MODE", "enforce")
+	opt, err := FromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := New(&fakeTransport{}, opt)
+	if _, ok := transport.Lookup("accounts.google.com"); ok {
+		t.Error("preload list applies with HSTS_DISABLE_PRELOAD")
+	}
+	if n := transport.Stats().Preloaded; n != 0 {
+		t.Errorf("got %v preloaded hosts; want 0", n)
+	}
+	req, err := http.NewRequest("GET", "https://example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	for deadline := time.Now().Add(5 * stateFileDelay); ; time.Sleep(10 * time.Millisecond) {
+		_, err := os.Stat(path)
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("state file not written: %v", err)
+		}
+	}
+
+	// The state file survives restarts.
+	opt, err = FromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, ok := New(nil, opt).Lookup("sub.example.com"); !ok || e.Host != "example.com" || e.Origin.Source != SourceHeader {
+		t.Errorf("restarted Lookup(sub.example.com) = %+v, %v; want example.com", e, ok)
+	}
+
+	t.Setenv("HSTS_MODE", "report")
+	opt, err = FromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transport := New(nil, opt); !transport.observeOnly {
+		t.Error("not observing only with HSTS_MODE=report")
+	}
+
+	for _, tt := range []struct{ name, value string }{
+		{"HSTS_MODE", "block"},
+		{"HSTS_DISABLE_PRELOAD", "maybe"},
+	} {
+		t.Setenv(tt.name, tt.value)
+		if _, err := FromEnv(); err == nil {
+			t.Errorf("FromEnv() with %v=%v succeeded; want error", tt.name, tt.value)
+		}
+		t.Setenv(tt.name, "")
+	}
+	if err := os.WriteFile(path, []byte("not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FromEnv(); err == nil {
+		t.Error("FromEnv() with an invalid state file succeeded; want error")
+	}
+}
+
+func TestFromEnvUnset(t *testing.T) {
+	for _, name := range []string{"HSTS_STATE_FILE", "HSTS_DISABLE_PRELOAD", "HSTS_MODE"} {
+		t.Setenv(name, "")
+	}
+	opt, err := FromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := New(nil, WithObserveOnly(true), opt)
+	if transport.storage != nil || transport.noPreload || !transport.observeOnly {
+		t.Error("FromEnv changed options without variables")
+	}
+}
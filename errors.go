@@ -0,0 +1,67 @@
+package hsts
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors of the failure modes of the package, to test with errors.Is: the
+// errors returned are more specific, e.g. a *TLSError is an ErrTLS.
+var (
+	// ErrBlocked is an insecure request refused, e.g. a plaintext dial
+	// (*PlaintextError) or an upgraded request the proxy cannot take
+	// (*ProxyError).
+	ErrBlocked = errors.New("hsts: insecure request blocked")
+
+	// ErrTLS is a TLS connection to an HSTS host failing checks, e.g. of
+	// version (*TLSError) or SCTs (*SCTError).
+	ErrTLS = errors.New("hsts: TLS failure on an HSTS host")
+
+	// ErrBodyNotReplayable is a request body which cannot be sent again,
+	// e.g. to fall back to plaintext (see WithHTTPFallback).
+	ErrBodyNotReplayable = errors.New("hsts: request body cannot be sent again")
+
+	// ErrStorage is a failure of a Storage (*StorageError).
+	ErrStorage = errors.New("hsts: storage failed")
+
+	// ErrInvalidHeader is a Strict-Transport-Security header rejected
+	// (*HeaderError), e.g. by ValidateHeader.
+	ErrInvalidHeader = errors.New("hsts: invalid header")
+)
+
+func (e *PlaintextError) Is(target error) bool { return target == ErrBlocked }
+func (e *TLSError) Is(target error) bool       { return target == ErrTLS }
+func (e *SCTError) Is(target error) bool       { return target == ErrTLS }
+func (e *HeaderError) Is(target error) bool    { return target == ErrInvalidHeader }
+
+// A ProxyError is returned by a Transport checking proxies (see
+// WithProxyCheck) when the proxy of a request upgraded cannot be found.
+type ProxyError struct {
+	URL string // upgraded
+	Err error  // of the Proxy function
+}
+
+func (e *ProxyError) Error() string {
+	return fmt.Sprintf("hsts: cannot proxy upgraded %v: %v", e.URL, e.Err)
+}
+
+func (e *ProxyError) Unwrap() error        { return e.Err }
+func (e *ProxyError) Is(target error) bool { return target == ErrBlocked }
+
+// A StorageError is a failure of a Storage, see WithStorage. It is returned
+// by AddHosts, and logged otherwise.
+type StorageError struct {
+	Op   string // get, put, put batch or delete
+	Host string // empty for batches
+	Err  error
+}
+
+func (e *StorageError) Error() string {
+	if e.Host == "" {
+		return fmt.Sprintf("hsts: storage %v: %v", e.Op, e.Err)
+	}
+	return fmt.Sprintf("hsts: storage %v %v: %v", e.Op, e.Host, e.Err)
+}
+
+func (e *StorageError) Unwrap() error        { return e.Err }
+func (e *StorageError) Is(target error) bool { return target == ErrStorage }
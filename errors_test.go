@@ -0,0 +1,41 @@
+package hsts
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestErrors(t *testing.T) {
+	down := errors.New("down")
+	for _, tt := range []struct {
+		err  error
+		want error
+	}{
+		{&PlaintextError{Addr: "example.com:80", Host: "example.com"}, ErrBlocked},
+		{&ProxyError{URL: "https://example.com", Err: down}, ErrBlocked},
+		{&TLSError{Host: "example.com"}, ErrTLS},
+		{&SCTError{Host: "example.com"}, ErrTLS},
+		{&StorageError{Op: "get", Host: "example.com", Err: down}, ErrStorage},
+		{&HeaderError{Header: "max-age", Reason: "no value"}, ErrInvalidHeader},
+		{ValidateHeader("max-age=1; max-age=2"), ErrInvalidHeader},
+	} {
+		wrapped := fmt.Errorf("wrapped: %w", tt.err)
+		if !errors.Is(wrapped, tt.want) {
+			t.Errorf("%v is not %v", tt.err, tt.want)
+		}
+		for _, other := range []error{ErrBlocked, ErrTLS, ErrBodyNotReplayable, ErrStorage, ErrInvalidHeader} {
+			if other != tt.want && errors.Is(tt.err, other) {
+				t.Errorf("%v is also %v", tt.err, other)
+			}
+		}
+	}
+	for _, err := range []error{&ProxyError{Err: down}, &StorageError{Err: down}} {
+		if !errors.Is(err, down) {
+			t.Errorf("%v does not wrap its error", err)
+		}
+	}
+	if got, want := (&StorageError{Op: "put batch", Err: down}).Error(), "hsts: storage put batch: down"; got != want {
+		t.Errorf("Error() = %q; want %q", got, want)
+	}
+}
@@ -0,0 +1,171 @@
+package hsts
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// A Candidate is a dynamic entry which may be evicted, see Eviction.
+type Candidate struct {
+	Entry
+	LastUsed time.Time // last lookup matching it, or when learned
+	Uses     int64     // lookups matching it
+}
+
+// An Eviction scores the entries to evict when the state is full, see
+// WithMaxEntries: the lowest score is evicted first.
+type Eviction func(c Candidate) float64
+
+// LeastRecentlyUsed evicts the entries not used for the longest time. It is
+// the default Eviction, suited to proxies whose clients keep to a few hosts.
+func LeastRecentlyUsed(c Candidate) float64 {
+	return float64(c.LastUsed.UnixNano())
+}
+
+// LeastFrequentlyUsed evicts the entries used the least, suited to crawlers
+// which only see most hosts once.
+func LeastFrequentlyUsed(c Candidate) float64 {
+	return float64(c.Uses)
+}
+
+// SoonestExpiry evicts the entries expiring first, which would be lost
+// soonest anyway. Long-lived entries are evicted last.
+func SoonestExpiry(c Candidate) float64 {
+	expires := c.Expires()
+	if expires.IsZero() {
+		return math.Inf(1)
+	}
+	return float64(expires.Unix())
+}
+
+// WithMaxEntries bounds the number of dynamic entries: when full, learning a
+// new host evicts another one, chosen WithEviction. Hosts are spread over the
+// shards (see WithShards), each with its share, so the bound is approximate.
+// It is 0 by default, which leaves the state unbounded, and is ignored
+// WithStore.
+func WithMaxEntries(n int) Option {
+	return func(t *Transport) {
+		t.maxEntries = n
+	}
+}
+
+// WithEviction sets how entries are chosen for eviction, see WithMaxEntries.
+// Expired entries are evicted first, then the lowest scores among a sample
+// of entries, approximating the policy as Redis does. It is
+// LeastRecentlyUsed by default, and ignored WithStore.
+func WithEviction(e Eviction) Option {
+	return func(t *Transport) {
+		t.eviction = e
+	}
+}
+
+// WithEvictionHook sets a function called with entries evicted, see
+// WithMaxEntries. The hook must not block.
+func WithEvictionHook(hook func(Entry)) Option {
+	return func(t *Transport) {
+		t.evictionHook = hook
+	}
+}
+
+// usage is how much a dynamic entry is used, tracked when the state is bounded.
+type usage struct {
+	last  int64 // Unix time in nanoseconds of the last use, updated atomically
+	count int64 // updated atomically
+}
+
+func newUsage(now time.Time) *usage {
+	return &usage{last: now.UnixNano()}
+}
+
+// use notes a use of the entry of a host, if tracked.
+func (t *Transport) use(host string, now time.Time) {
+	if t.store.shardLimit == 0 {
+		return
+	}
+	s := t.shard(host)
+	s.m.RLock()
+	u := s.uses[host] // nil if preloaded
+	s.m.RUnlock()
+	if u != nil {
+		atomic.StoreInt64(&u.last, now.UnixNano())
+		atomic.AddInt64(&u.count, 1)
+	}
+}
+
+// evictionSamples is how many entries are compared to choose one to evict.
+const evictionSamples = 16
+
+// bound bounds the entries of a store, see WithMaxEntries.
+func (s *Store) bound(maxEntries int, eviction Eviction) {
+	if maxEntries <= 0 {
+		return
+	}
+	s.shardLimit = (maxEntries + len(s.shards) - 1) / len(s.shards)
+	s.eviction = eviction
+	if s.eviction == nil {
+		s.eviction = LeastRecentlyUsed
+	}
+	for _, sh := range s.shards {
+		sh.uses = make(map[string]*usage)
+	}
+}
+
+// evict makes room in a full shard, whose lock must be held, for an entry to
+// add. It returns the entries evicted.
+func (s *Store) evict(sh *shard, now time.Time) []Entry {
+	var evicted []Entry
+	for len(sh.state) >= s.shardLimit {
+		var host string
+		var lowest float64
+		sampled := 0
+		for h, d := range sh.state {
+			if d.removed() {
+				continue // tombstones hide preloaded hosts, which must stay removed
+			}
+			if d.expired(now) {
+				host = h
+				break
+			}
+			c := Candidate{Entry: newEntry(h, d)}
+			if u := sh.uses[h]; u != nil {
+				c.LastUsed = time.Unix(0, atomic.LoadInt64(&u.last))
+				c.Uses = atomic.LoadInt64(&u.count)
+			}
+			if score := s.eviction(c); host == "" || score < lowest {
+				host, lowest = h, score
+			}
+			if sampled++; sampled == evictionSamples {
+				break
+			}
+		}
+		if host == "" {
+			break // only tombstones
+		}
+		evicted = append(evicted, newEntry(host, sh.state[host]))
+		sh.delete(host)
+	}
+	return evicted
+}
+
+// evicted counts, logs and notifies about entries evicted.
+func (t *Transport) evicted(entries []Entry) {
+	if len(entries) == 0 {
+		return
+	}
+	notify, now := t.store.subscribers.any(), t.now().Truncate(time.Second)
+	for _, e := range entries {
+		t.count(&t.counters.evicted)
+		if t.logger != nil {
+			t.logger.Debug("hsts: policy evicted", "host", e.Host)
+		}
+		if t.evictionHook != nil {
+			t.evictionHook(e)
+		}
+		t.store.cache.forget(e.Host) // read again from the Storage if needed
+		t.auditRemoved([]string{e.Host}, "evicted")
+		if notify {
+			t.store.subscribers.notify(Change{Host: e.Host, Entry: Entry{Host: e.Host, Received: now}, Removed: true, Evicted: true})
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package hsts
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestEviction(t *testing.T) {
+	start := time.Now()
+	for _, tt := range []struct {
+		name     string
+		eviction Eviction
+		evicted  string
+	}{
+		{"default", nil, "bb.com"},
+		{"LRU", LeastRecentlyUsed, "bb.com"},
+		{"LFU", LeastFrequentlyUsed, "c.com"},
+		{"soonest expiry", SoonestExpiry, "a.com"},
+		{"custom", func(c Candidate) float64 { return -float64(len(c.Host)) }, "bb.com"},
+	} {
+		now := start
+		var hooked []string
+		transport := New(nil, WithMaxEntries(3), WithEviction(tt.eviction), WithClock(func() time.Time { return now }),
+			WithEvictionHook(func(e Entry) { hooked = append(hooked, e.Host) }))
+		var removed []string
+		transport.State().Subscribe(func(c Change) {
+			if c.Removed && c.Evicted {
+				removed = append(removed, c.Host)
+			}
+		})
+		transport.add("a.com", newDirective(now, time.Hour, 0))
+		transport.add("bb.com", newDirective(now, 3*time.Hour, 0))
+		transport.add("c.com", newDirective(now, 2*time.Hour, 0))
+		// bb.com is used the least recently, c.com the least.
+		for _, host := range []string{"bb.com", "bb.com", "a.com", "c.com", "a.com"} {
+			now = now.Add(time.Second)
+			transport.lookup(host, now)
+		}
+
+		transport.add("a.com", newDirective(now, 90*time.Minute, 0)) // update, no eviction
+		transport.add("d.com", newDirective(now, time.Hour, 0))
+		var hosts []string
+		for _, e := range transport.entries(now) {
+			hosts = append(hosts, e.Host)
+		}
+		want := []string{"a.com", "bb.com", "c.com", "d.com"}
+		for i, host := range want {
+			if host == tt.evicted {
+				want = append(want[:i:i], want[i+1:]...)
+				break
+			}
+		}
+		if !reflect.DeepEqual(hosts, want) {
+			t.Errorf("%v: entries %v; want %v", tt.name, hosts, want)
+		}
+		if want := []string{tt.evicted}; !reflect.DeepEqual(hooked, want) || !reflect.DeepEqual(removed, want) {
+			t.Errorf("%v: hooked %v and removed %v; want %v", tt.name, hooked, removed, want)
+		}
+		if got := transport.Stats().Evicted; got != 1 {
+			t.Errorf("%v: evicted %v; want 1", tt.name, got)
+		}
+	}
+}
+
+func TestEvictionExpiredFirst(t *testing.T) {
+	now := time.Now()
+	transport := New(nil, WithMaxEntries(2), WithEviction(SoonestExpiry))
+	transport.add("old.com", newDirective(now.Add(-2*time.Hour), time.Hour, 0))
+	transport.add("long.com", newDirective(now, 2*time.Hour, 0))
+	transport.add("new.com", newDirective(now, 3*time.Hour, 0))
+	var hosts []string
+	for _, shard := range transport.shards {
+		for host := range shard.state {
+			hosts = append(hosts, host)
+		}
+	}
+	sort.Strings(hosts)
+	if want := []string{"long.com", "new.com"}; !reflect.DeepEqual(hosts, want) {
+		t.Errorf("state %v; want %v", hosts, want)
+	}
+}
+
+func TestEvictionShards(t *testing.T) {
+	now := time.Now()
+	transport := New(nil, WithMaxEntries(100), WithShards(4))
+	for i := 0; i < 1000; i++ {
+		transport.add(fmt.Sprintf("h%d.com", i), newDirective(now, time.Hour, 0))
+	}
+	// Each shard holds its share, 25.
+	if n := transport.size(); n > 100 {
+		t.Errorf("%v entries; want at most 100", n)
+	}
+	if got := transport.Stats().Evicted; got < 900 {
+		t.Errorf("evicted %v; want at least 900", got)
+	}
+	// Usage is forgotten with the entries.
+	for _, shard := range transport.shards {
+		if len(shard.uses) != len(shard.state) {
+			t.Errorf("shard tracks usage of %v entries; want %v", len(shard.uses), len(shard.state))
+		}
+	}
+}
+
+func TestUnbounded(t *testing.T) {
+	transport := New(nil)
+	transport.add("example.com", newDirective(time.Now(), time.Hour, 0))
+	transport.lookup("example.com", time.Now())
+	if transport.shards[0].uses != nil {
+		t.Error("unbounded state tracks usage")
+	}
+}
@@ -0,0 +1,412 @@
+package hsts
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// A Format is a machine-readable format of the state, see ExportState.
+type Format int
+
+const (
+	// FormatJSONLines is a JSON object per entry, one per line, with fields
+	// host, source, max_age (in seconds), include_subdomains, preload,
+	// long_lived, received, expires (left out if long-lived), url, addr,
+	// uses and last_used (left out if not counted).
+	FormatJSONLines Format = iota
+
+	// FormatCSV is a header line then a line per entry, with the fields of
+	// FormatJSONLines in that order, times in RFC 3339 or empty, and uses
+	// empty if not counted.
+	FormatCSV
+
+	// FormatBinary is compact: "HSTS", version 1 as a byte and the number of
+	// entries as a uvarint, then for each entry its host as a uvarint length
+	// and bytes, source as a byte (see Source), flags as a byte (1 for
+	// includeSubDomains, 2 for preload, 4 for long-lived, 8 if uses are
+	// counted), max-age in seconds, received, expiry and last use in Unix
+	// seconds (0 if none) as varints, url and addr like host, and uses as a
+	// uvarint (0 if not counted).
+	FormatBinary
+)
+
+// exportedEntry is an entry as exported, see FormatJSONLines.
+type exportedEntry struct {
+	Host              string     `json:"host"`
+	Source            Source     `json:"source"`
+	MaxAge            int64      `json:"max_age"`
+	IncludeSubDomains bool       `json:"include_subdomains"`
+	Preload           bool       `json:"preload"`
+	LongLived         bool       `json:"long_lived"`
+	Received          time.Time  `json:"received"`
+	Expires           *time.Time `json:"expires,omitempty"`
+	URL               string     `json:"url"`
+	Addr              string     `json:"addr"`
+	Uses              *int64     `json:"uses,omitempty"`
+	LastUsed          *time.Time `json:"last_used,omitempty"`
+}
+
+// entry returns the entry exported.
+func (e exportedEntry) entry() (Entry, error) {
+	if e.Host == "" {
+		return Entry{}, errors.New("entry without a host")
+	}
+	if e.MaxAge < 0 || e.MaxAge > int64(maxMaxAge/time.Second) {
+		return Entry{}, fmt.Errorf("%v: invalid max-age %d", e.Host, e.MaxAge)
+	}
+	if int(e.Source) < 0 || int(e.Source) >= len(sourceNames) {
+		return Entry{}, fmt.Errorf("%v: invalid source %d", e.Host, int(e.Source))
+	}
+	return Entry{
+		Host:      e.Host,
+		LongLived: e.LongLived,
+		Received:  e.Received,
+		Origin:    Origin{Source: e.Source, URL: e.URL, Addr: e.Addr},
+		Policy: Policy{
+			MaxAge:            time.Duration(e.MaxAge) * time.Second,
+			IncludeSubDomains: e.IncludeSubDomains,
+			Preload:           e.Preload,
+		},
+	}, nil
+}
+
+// ExportState writes the dynamic entries of the Transport in a format for
+// analysis tools, sorted by host, with where each comes from (see Origin),
+// when it expires, and how many lookups matched it and when last. Lookups
+// are only counted when the state is bounded (see WithMaxEntries), otherwise
+// uses are left out as unknown. Preloaded entries, the same for all, are left
+// out. See ImportState to read them back.
+func (t *Transport) ExportState(w io.Writer, f Format) error {
+	counted := t.store.shardLimit != 0
+	var entries []exportedEntry
+	for _, c := range t.candidates(t.now()) {
+		e := exportedEntry{
+			Host:              c.Host,
+			Source:            c.Origin.Source,
+			MaxAge:            int64(c.MaxAge / time.Second),
+			IncludeSubDomains: c.IncludeSubDomains,
+			Preload:           c.Preload,
+			LongLived:         c.LongLived,
+			Received:          c.Received,
+			URL:               c.Origin.URL,
+			Addr:              c.Origin.Addr,
+		}
+		if expires := c.Expires(); !expires.IsZero() {
+			e.Expires = &expires
+		}
+		if counted {
+			uses, last := c.Uses, c.LastUsed
+			e.Uses, e.LastUsed = &uses, &last
+		}
+		entries = append(entries, e)
+	}
+	b := bufio.NewWriter(w)
+	var err error
+	switch f {
+	case FormatJSONLines:
+		err = exportJSONLines(b, entries)
+	case FormatCSV:
+		err = exportCSV(b, entries)
+	case FormatBinary:
+		err = exportBinary(b, entries)
+	default:
+		return fmt.Errorf("hsts: unknown format %d", int(f))
+	}
+	if err != nil {
+		return err
+	}
+	return b.Flush()
+}
+
+// ImportState reads entries written by ExportState in a format and applies
+// them like changes made elsewhere (see Apply): options restricting learning
+// still apply, and an entry only replaces a more recent one. Expiry and uses
+// are ignored, expiry follows from when the entries were received. It fails
+// on the first invalid entry, after applying those before.
+func (t *Transport) ImportState(r io.Reader, f Format) error {
+	apply := func(e exportedEntry) error {
+		entry, err := e.entry()
+		if err != nil {
+			return err
+		}
+		t.Apply(Change{Host: entry.Host, Entry: entry})
+		return nil
+	}
+	var err error
+	switch f {
+	case FormatJSONLines:
+		err = importJSONLines(r, apply)
+	case FormatCSV:
+		err = importCSV(r, apply)
+	case FormatBinary:
+		err = importBinary(bufio.NewReader(r), apply)
+	default:
+		return fmt.Errorf("hsts: unknown format %d", int(f))
+	}
+	if err != nil {
+		return fmt.Errorf("hsts: import: %w", err)
+	}
+	return nil
+}
+
+func exportJSONLines(w io.Writer, entries []exportedEntry) error {
+	enc := json.NewEncoder(w)
+	for _, e := range entries {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func importJSONLines(r io.Reader, apply func(exportedEntry) error) error {
+	dec := json.NewDecoder(r)
+	for {
+		var e exportedEntry
+		if err := dec.Decode(&e); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := apply(e); err != nil {
+			return err
+		}
+	}
+}
+
+// csvHeader is the header line of FormatCSV.
+var csvHeader = []string{"host", "source", "max_age", "include_subdomains", "preload", "long_lived", "received", "expires", "url", "addr", "uses", "last_used"}
+
+func exportCSV(w io.Writer, entries []exportedEntry) error {
+	cw := csv.NewWriter(w)
+	cw.Write(csvHeader)
+	rfc3339 := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339)
+	}
+	for _, e := range entries {
+		var uses string
+		if e.Uses != nil {
+			uses = strconv.FormatInt(*e.Uses, 10)
+		}
+		cw.Write([]string{
+			e.Host,
+			e.Source.String(),
+			strconv.FormatInt(e.MaxAge, 10),
+			strconv.FormatBool(e.IncludeSubDomains),
+			strconv.FormatBool(e.Preload),
+			strconv.FormatBool(e.LongLived),
+			rfc3339(&e.Received),
+			rfc3339(e.Expires),
+			e.URL,
+			e.Addr,
+			uses,
+			rfc3339(e.LastUsed),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func importCSV(r io.Reader, apply func(exportedEntry) error) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = len(csvHeader)
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if header[0] != csvHeader[0] {
+		return errors.New("missing CSV header")
+	}
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		e := exportedEntry{Host: record[0], URL: record[8], Addr: record[9]}
+		if err := e.Source.UnmarshalText([]byte(record[1])); err != nil {
+			return err
+		}
+		if e.MaxAge, err = strconv.ParseInt(record[2], 10, 64); err != nil {
+			return err
+		}
+		for i, b := range []*bool{&e.IncludeSubDomains, &e.Preload, &e.LongLived} {
+			if *b, err = strconv.ParseBool(record[3+i]); err != nil {
+				return err
+			}
+		}
+		if e.Received, err = time.Parse(time.RFC3339, record[6]); err != nil {
+			return err
+		}
+		if err := apply(e); err != nil {
+			return err
+		}
+	}
+}
+
+// binaryVersion is the version of FormatBinary.
+const binaryVersion = 1
+
+// Flags of entries in FormatBinary.
+const (
+	binaryIncludeSubDomains = 1 << iota
+	binaryPreload
+	binaryLongLived
+	binaryCounted
+)
+
+func exportBinary(w io.Writer, entries []exportedEntry) error {
+	b := append([]byte("HSTS"), binaryVersion)
+	b = binary.AppendUvarint(b, uint64(len(entries)))
+	unix := func(t *time.Time) int64 {
+		if t == nil || t.IsZero() {
+			return 0
+		}
+		return t.Unix()
+	}
+	for _, e := range entries {
+		b = binary.AppendUvarint(b, uint64(len(e.Host)))
+		b = append(b, e.Host...)
+		var flags byte
+		if e.IncludeSubDomains {
+			flags |= binaryIncludeSubDomains
+		}
+		if e.Preload {
+			flags |= binaryPreload
+		}
+		if e.LongLived {
+			flags |= binaryLongLived
+		}
+		var uses int64
+		if e.Uses != nil {
+			flags |= binaryCounted
+			uses = *e.Uses
+		}
+		b = append(b, byte(e.Source), flags)
+		b = binary.AppendVarint(b, e.MaxAge)
+		b = binary.AppendVarint(b, unix(&e.Received))
+		b = binary.AppendVarint(b, unix(e.Expires))
+		b = binary.AppendVarint(b, unix(e.LastUsed))
+		b = binary.AppendUvarint(b, uint64(len(e.URL)))
+		b = append(b, e.URL...)
+		b = binary.AppendUvarint(b, uint64(len(e.Addr)))
+		b = append(b, e.Addr...)
+		b = binary.AppendUvarint(b, uint64(uses))
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+// maxBinaryString is the maximum length of strings read from FormatBinary.
+const maxBinaryString = 1 << 16
+
+func importBinary(r *bufio.Reader, apply func(exportedEntry) error) error {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return err
+	}
+	if string(header[:4]) != "HSTS" || header[4] != binaryVersion {
+		return errors.New("not the binary format, version 1")
+	}
+	str := func() (string, error) {
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return "", err
+		}
+		if n > maxBinaryString {
+			return "", fmt.Errorf("string of %d bytes", n)
+		}
+		b := make([]byte, n)
+		_, err = io.ReadFull(r, b)
+		return string(b), err
+	}
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return err
+	}
+	for i := uint64(0); i < n; i++ {
+		var e exportedEntry
+		if e.Host, err = str(); err != nil {
+			return unexpected(err)
+		}
+		source, err := r.ReadByte()
+		if err != nil {
+			return unexpected(err)
+		}
+		flags, err := r.ReadByte()
+		if err != nil {
+			return unexpected(err)
+		}
+		e.Source = Source(source)
+		e.IncludeSubDomains = flags&binaryIncludeSubDomains != 0
+		e.Preload = flags&binaryPreload != 0
+		e.LongLived = flags&binaryLongLived != 0
+		var times [4]int64 // max-age, received, expiry and last use
+		for j := range times {
+			if times[j], err = binary.ReadVarint(r); err != nil {
+				return unexpected(err)
+			}
+		}
+		e.MaxAge, e.Received = times[0], time.Unix(times[1], 0)
+		if e.URL, err = str(); err != nil {
+			return unexpected(err)
+		}
+		if e.Addr, err = str(); err != nil {
+			return unexpected(err)
+		}
+		if _, err := binary.ReadUvarint(r); err != nil {
+			return unexpected(err)
+		}
+		if err := apply(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unexpected returns io.ErrUnexpectedEOF for io.EOF in the middle of data.
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// candidates returns the dynamic entries with their usage, sorted by host.
+func (t *Transport) candidates(now time.Time) []Candidate {
+	var candidates []Candidate
+	for _, s := range t.shards {
+		s.m.RLock()
+		for host, d := range s.state {
+			if d.removed() || d.expired(now) {
+				continue
+			}
+			c := Candidate{Entry: newEntry(host, d)}
+			if u := s.uses[host]; u != nil {
+				c.LastUsed = time.Unix(0, atomic.LoadInt64(&u.last))
+				c.Uses = atomic.LoadInt64(&u.count)
+			}
+			candidates = append(candidates, c)
+		}
+		s.m.RUnlock()
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].Host < candidates[j].Host })
+	return candidates
+}
@@ -0,0 +1,215 @@
+package hsts
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func exportTransport(t *testing.T) *Transport {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	transport := New(&fakeTransport{}, WithMaxEntries(10), WithClock(func() time.Time { return now }))
+	resp, err := (&http.Client{Transport: transport}).Get("https://example.com/path?q=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if err := transport.AddHosts([]HostPolicy{{Host: "added.example.org", Policy: Policy{MaxAge: 2 * time.Hour, Preload: true}}}); err != nil {
+		t.Fatal(err)
+	}
+	transport.Lookup("sub.example.com")
+	transport.Lookup("example.com")
+	return transport
+}
+
+func TestExportJSONLines(t *testing.T) {
+	var b bytes.Buffer
+	if err := exportTransport(t).ExportState(&b, FormatJSONLines); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines; want 2:\n%s", len(lines), b.String())
+	}
+	var got []map[string]interface{}
+	for _, line := range lines {
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, m)
+	}
+	want := []map[string]interface{}{{
+		"host": "added.example.org", "source": "added", "max_age": 7200.0,
+		"include_subdomains": false, "preload": true, "long_lived": false,
+		"received": "2024-01-02T03:04:05Z", "expires": "2024-01-02T05:04:05Z",
+		"url": "", "addr": "", "uses": 0.0, "last_used": "2024-01-02T03:04:05Z",
+	}, {
+		"host": "example.com", "source": "header", "max_age": 3600.0,
+		"include_subdomains": true, "preload": false, "long_lived": false,
+		"received": "2024-01-02T03:04:05Z", "expires": "2024-01-02T04:04:05Z",
+		"url": "https://example.com/path", "addr": "", "uses": 2.0, "last_used": "2024-01-02T03:04:05Z",
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v; want %v", got, want)
+	}
+}
+
+func TestExportCSV(t *testing.T) {
+	var b bytes.Buffer
+	if err := exportTransport(t).ExportState(&b, FormatCSV); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&b).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"host", "source", "max_age", "include_subdomains", "preload", "long_lived", "received", "expires", "url", "addr", "uses", "last_used"},
+		{"added.example.org", "added", "7200", "false", "true", "false", "2024-01-02T03:04:05Z", "2024-01-02T05:04:05Z", "", "", "0", "2024-01-02T03:04:05Z"},
+		{"example.com", "header", "3600", "true", "false", "false", "2024-01-02T03:04:05Z", "2024-01-02T04:04:05Z", "https://example.com/path", "", "2", "2024-01-02T03:04:05Z"},
+	}
+	if !reflect.DeepEqual(records, want) {
+		t.Errorf("got %q; want %q", records, want)
+	}
+}
+
+// binaryEntry is an entry decoded from FormatBinary.
+type binaryEntry struct {
+	Host                                string
+	Source                              Source
+	Flags                               byte
+	MaxAge, Received, Expires, LastUsed int64
+	URL, Addr                           string
+	Uses                                uint64
+}
+
+// decodeBinary decodes FormatBinary as documented.
+func decodeBinary(t *testing.T, b []byte) []binaryEntry {
+	if !bytes.HasPrefix(b, []byte("HSTS\x01")) {
+		t.Fatalf("missing header: %q", b)
+	}
+	r := bytes.NewReader(b[5:])
+	uvarint := func() uint64 {
+		v, err := binary.ReadUvarint(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	varint := func() int64 {
+		v, err := binary.ReadVarint(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	str := func() string {
+		s := make([]byte, uvarint())
+		if _, err := r.Read(s); err != nil && len(s) > 0 {
+			t.Fatal(err)
+		}
+		return string(s)
+	}
+	byt := func() byte {
+		c, err := r.ReadByte()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	entries := make([]binaryEntry, uvarint())
+	for i := range entries {
+		e := &entries[i]
+		e.Host = str()
+		e.Source = Source(byt())
+		e.Flags = byt()
+		e.MaxAge, e.Received, e.Expires, e.LastUsed = varint(), varint(), varint(), varint()
+		e.URL, e.Addr = str(), str()
+		e.Uses = uvarint()
+	}
+	if r.Len() != 0 {
+		t.Errorf("%d bytes left", r.Len())
+	}
+	return entries
+}
+
+func TestExportBinary(t *testing.T) {
+	var b bytes.Buffer
+	if err := exportTransport(t).ExportState(&b, FormatBinary); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC).Unix()
+	want := []binaryEntry{
+		{Host: "added.example.org", Source: SourceAdded, Flags: 2 | 8, MaxAge: 7200, Received: now, Expires: now + 7200, LastUsed: now},
+		{Host: "example.com", Source: SourceHeader, Flags: 1 | 8, MaxAge: 3600, Received: now, Expires: now + 3600, LastUsed: now, URL: "https://example.com/path", Uses: 2},
+	}
+	if got := decodeBinary(t, b.Bytes()); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v; want %+v", got, want)
+	}
+}
+
+func TestExportUnknownFormat(t *testing.T) {
+	if err := New(nil).ExportState(&bytes.Buffer{}, Format(42)); err == nil {
+		t.Error("ExportState() with an unknown format succeeded; want error")
+	}
+	// Uses are not counted unless bounded.
+	transport := New(&fakeTransport{})
+	transport.put("example.com", newDirective(time.Now(), time.Hour, 0))
+	transport.Lookup("example.com")
+	var b bytes.Buffer
+	if err := transport.ExportState(&b, FormatJSONLines); err != nil {
+		t.Fatal(err)
+	}
+	if s := b.String(); strings.Contains(s, "uses") || strings.Contains(s, "last_used") {
+		t.Errorf("got %s; want no uses", s)
+	}
+}
+
+func TestImportState(t *testing.T) {
+	for _, f := range []Format{FormatJSONLines, FormatCSV, FormatBinary} {
+		var exported bytes.Buffer
+		if err := exportTransport(t).ExportState(&exported, f); err != nil {
+			t.Fatal(err)
+		}
+		now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+		transport := New(&fakeTransport{}, WithMaxEntries(10), WithClock(func() time.Time { return now }))
+		if err := transport.ImportState(bytes.NewReader(exported.Bytes()), f); err != nil {
+			t.Fatalf("format %d: %v", f, err)
+		}
+		// Uses are not imported, otherwise it round-trips.
+		got, want := transport.candidates(now), exportTransport(t).candidates(now)
+		for i := range want {
+			want[i].Uses = 0
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("format %d: imported %+v; want %+v", f, got, want)
+		}
+
+		// A truncated CSV row may still be a valid one.
+		if f == FormatCSV {
+			continue
+		}
+		if err := New(nil).ImportState(bytes.NewReader(exported.Bytes()[:exported.Len()-3]), f); err == nil {
+			t.Errorf("format %d: ImportState() of truncated data succeeded; want error", f)
+		}
+	}
+	for f, data := range map[Format]string{
+		FormatJSONLines: `{"host":"example.com","max_age":-1}`,
+		FormatCSV:       "host,source\nexample.com,header\n",
+		FormatBinary:    "HSTS\x02",
+	} {
+		if err := New(nil).ImportState(strings.NewReader(data), f); err == nil {
+			t.Errorf("format %d: ImportState(%q) succeeded; want error", f, data)
+		}
+	}
+	if err := New(nil).ImportState(strings.NewReader(""), Format(42)); err == nil {
+		t.Error("ImportState() with an unknown format succeeded; want error")
+	}
+}
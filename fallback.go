@@ -0,0 +1,62 @@
+package hsts
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// WithHTTPFallback makes the Transport fall back to plaintext HTTP when a
+// request upgraded by a learned policy fails, e.g. because the host no longer
+// serves HTTPS. This is NOT conformant: section 8.3 requires failing, and an
+// active attacker can force the fallback by blocking HTTPS. It is for
+// crawlers which prefer degraded fetches to lost pages. Preloaded hosts still
+// fail, as do hosts upgraded for DNS HTTPS records (see WithHTTPSRecords).
+//
+// Such requests are sent upgraded in place (see WithInPlaceUpgrades) so that
+// the failure is known. If their body cannot be sent again, the failure is
+// returned as an ErrBodyNotReplayable too. Only failures of the wrapped
+// transport fall back, not those of TLS checks (ErrTLS, see WithMinTLSVersion,
+// and WithRequireSCTs). The hook, if not nil, is called with the
+// failure in Err before the fallback is sent; it must not block. Fallbacks
+// are counted in Stats. It is disabled by default.
+func WithHTTPFallback(enable bool, hook func(Upgrade)) Option {
+	return func(t *Transport) {
+		t.httpFallback = enable
+		t.fallbackHook = hook
+	}
+}
+
+// mayFallBack tells whether an upgraded request may fall back to plaintext.
+func (t *Transport) mayFallBack(up Upgrade) bool {
+	return t.httpFallback && !up.Preloaded && !up.HTTPSRecord
+}
+
+// roundTripFallback sends a request upgraded in place, and sends it again as
+// is if that fails, see WithHTTPFallback.
+func (t *Transport) roundTripFallback(req *http.Request, up Upgrade) (*http.Response, error) {
+	resp, err := t.roundTripUpgraded(req, up)
+	if err == nil || errors.Is(err, ErrTLS) {
+		return resp, err
+	}
+	plain := req.Clone(req.Context())
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return nil, fmt.Errorf("hsts: cannot fall back to plaintext: %w: %w", ErrBodyNotReplayable, err)
+		}
+		body, bodyErr := req.GetBody()
+		if bodyErr != nil {
+			return nil, fmt.Errorf("hsts: cannot fall back to plaintext: %w: %v: %w", ErrBodyNotReplayable, bodyErr, err)
+		}
+		plain.Body = body
+	}
+	t.count(&t.counters.fallbacks)
+	up.Err = err
+	if t.fallbackHook != nil {
+		t.fallbackHook(up)
+	}
+	if t.logger != nil {
+		t.logger.WarnContext(req.Context(), "hsts: falling back to plaintext", "url", req.URL.String(), "error", err)
+	}
+	return t.roundTrip(plain)
+}
@@ -0,0 +1,78 @@
+package hsts
+
+import (
+	"crypto/tls"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// downTransport fails HTTPS requests, or answers them without TLS if
+// insecure, and echoes plaintext ones.
+type downTransport struct {
+	insecure bool
+}
+
+func (f *downTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == "https" && !f.insecure {
+		return nil, errors.New("connection refused")
+	}
+	return (&echoTransport{}).RoundTrip(req)
+}
+
+func TestHTTPFallback(t *testing.T) {
+	var fallbacks []Upgrade
+	transport := New(&downTransport{}, WithHTTPFallback(true, func(up Upgrade) {
+		fallbacks = append(fallbacks, up)
+	}))
+	transport.put("example.com", newDirective(time.Now(), time.Hour, 0))
+	client := &http.Client{Transport: transport}
+
+	resp, err := client.Post("http://example.com/form", "text/plain", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := resp.Request.URL.String(); got != "http://example.com/form" || string(b) != "hello" {
+		t.Errorf("got request to %v with body %q; want plaintext with hello", got, b)
+	}
+	if len(fallbacks) != 1 || fallbacks[0].Err == nil || fallbacks[0].URL.String() != "https://example.com/form" {
+		t.Errorf("hook got %+v; want one failed upgrade", fallbacks)
+	}
+	if n := transport.Stats().Fallbacks; n != 1 {
+		t.Errorf("got %v fallbacks; want 1", n)
+	}
+
+	// A body which cannot be sent again is not.
+	if _, err := client.Post("http://example.com/form", "text/plain", onlyReader{strings.NewReader("hello")}); !errors.Is(err, ErrBodyNotReplayable) {
+		t.Errorf("got error %v with a body not replayable; want ErrBodyNotReplayable", err)
+	}
+
+	// Nor when TLS checks fail.
+	transport = New(&downTransport{insecure: true}, WithHTTPFallback(true, nil), WithMinTLSVersion(tls.VersionTLS12))
+	transport.put("example.com", newDirective(time.Now(), time.Hour, 0))
+	client.Transport = transport
+	_, err = client.Get("http://example.com/")
+	var tlsErr *TLSError
+	if !errors.As(err, &tlsErr) {
+		t.Errorf("got error %v; want a *TLSError", err)
+	}
+
+	// Nor by default.
+	transport = New(&downTransport{})
+	transport.put("example.com", newDirective(time.Now(), time.Hour, 0))
+	client.Transport = transport
+	if _, err := client.Get("http://example.com/"); err == nil {
+		t.Error("fell back by default")
+	}
+	if n := transport.Stats().Fallbacks; n != 0 {
+		t.Errorf("got %v fallbacks by default; want 0", n)
+	}
+}
@@ -0,0 +1,74 @@
+package hsts
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Headers come from responses, so the parser must handle anything a server
+// sends. Seeds are in testdata/fuzz.
+
+func FuzzParseHeader(f *testing.F) {
+	for _, seed := range []string{
+		"max-age=31536000; includeSubDomains; preload",
+		`max-age="1234"; ext="quoted; \"value\""`,
+		"max-age=99999999999999999999999",
+		"max-age=1234;;;",
+		strings.Repeat("a=b;", 10000) + "max-age=1",
+		"max-age=1; q=\"" + strings.Repeat(`\"`, 10000),
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, header string) {
+		p, err := ParseHeader(header)
+		validErr := ValidateHeader(header)
+		LintHeader(header)
+		if err != nil {
+			if validErr == nil {
+				t.Fatalf("ValidateHeader(%q) accepted what ParseHeader rejected: %v", header, err)
+			}
+			return
+		}
+		if p.MaxAge < 0 || p.MaxAge > maxMaxAge {
+			t.Fatalf("ParseHeader(%q) got max-age %v out of range", header, p.MaxAge)
+		}
+		// What is parsed renders as a valid header parsing the same.
+		s := p.String()
+		if err := ValidateHeader(s); err != nil {
+			t.Fatalf("ParseHeader(%q) rendered as invalid %q: %v", header, s, err)
+		}
+		again, err := ParseHeader(s)
+		if err != nil || !reflect.DeepEqual(again, p) {
+			t.Fatalf("ParseHeader(%q) = %+v rendered as %q parsing as %+v, %v", header, p, s, again, err)
+		}
+	})
+}
+
+func FuzzCanonicalize(f *testing.F) {
+	for _, seed := range []string{
+		"Example.COM.",
+		"example.com:8080",
+		"[::1]:443",
+		"[::1",
+		"bücher.example",
+		"xn--bcher-kva.example",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, host string) {
+		c := canonicalize(host)
+		if strings.ContainsAny(c, "[]") && !strings.ContainsAny(host, "[]") {
+			t.Fatalf("canonicalize(%q) = %q added brackets", host, c)
+		}
+		if isASCII(c) && c != strings.ToLower(c) {
+			t.Fatalf("canonicalize(%q) = %q not lowercase", host, c)
+		}
+		// Only a single trailing dot is removed, names with more are invalid.
+		if again := canonicalizeName(c); again != c && !strings.HasSuffix(c, ".") {
+			t.Fatalf("canonicalizeName(canonicalize(%q)) = %q; want idempotent %q", host, again, c)
+		}
+		// Lookups never panic either.
+		New(nil).Lookup(host)
+	})
+}
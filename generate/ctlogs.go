@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+)
+
+const ctLogsURL = "https://www.gstatic.com/ct/log_list/v3/log_list.json"
+
+// ctLogsMain generates the Go file for the trusted Certificate Transparency logs.
+func ctLogsMain() error {
+	b, err := download(ctLogsURL)
+	if err != nil {
+		return err
+	}
+	logs, err := parseCTLogs(bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(*out, generateCTLogs(logs), 0660)
+}
+
+// A ctLog is a Certificate Transparency log.
+type ctLog struct {
+	Description string
+	Key         []byte // DER public key
+}
+
+// parseCTLogs parses Google's list of logs to return those trusted, which are
+// usable, qualified or read-only, sorted by description.
+func parseCTLogs(r io.Reader) ([]ctLog, error) {
+	var list struct {
+		Operators []struct {
+			Logs []struct {
+				Description string                     `json:"description"`
+				Key         string                     `json:"key"`
+				State       map[string]json.RawMessage `json:"state"`
+			} `json:"logs"`
+		} `json:"operators"`
+	}
+	if err := json.NewDecoder(r).Decode(&list); err != nil {
+		return nil, err
+	}
+	var logs []ctLog
+	for _, op := range list.Operators {
+		for _, l := range op.Logs {
+			_, usable := l.State["usable"]
+			_, qualified := l.State["qualified"]
+			_, readOnly := l.State["readonly"]
+			if !usable && !qualified && !readOnly {
+				continue
+			}
+			key, err := base64.StdEncoding.DecodeString(l.Key)
+			if err != nil {
+				return nil, fmt.Errorf("log %v: invalid key: %v", l.Description, err)
+			}
+			logs = append(logs, ctLog{Description: l.Description, Key: key})
+		}
+	}
+	if len(logs) == 0 {
+		return nil, errors.New("no trusted logs")
+	}
+	sort.Slice(logs, func(i, j int) bool { return logs[i].Description < logs[j].Description })
+	return logs, nil
+}
+
+// generateCTLogs generates the Go file for the trusted Certificate
+// Transparency logs.
+func generateCTLogs(logs []ctLog) []byte {
+	var b bytes.Buffer
+	if *tags != "" {
+		fmt.Fprintf(&b, "//go:build %s\n", *tags)
+		fmt.Fprintf(&b, "// +build %s\n", *tags)
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "package %s\n", *pkg)
+	b.WriteString("\n")
+	b.WriteString("// Automatically generated with go generate.\n")
+	b.WriteString("\n")
+	b.WriteString("// Certificate Transparency logs trusted by Chromium, DER public keys.\n")
+	fmt.Fprintf(&b, "var %sCTLogs = []string{\n", *varname)
+	for _, l := range logs {
+		fmt.Fprintf(&b, "%+q, // %s\n", l.Key, l.Description)
+	}
+	b.WriteString("}\n")
+	return b.Bytes()
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseCTLogs(t *testing.T) {
+	f, err := os.Open("testdata/log_list.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	logs, err := parseCTLogs(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, l := range logs {
+		got = append(got, l.Description)
+		if _, err := x509.ParsePKIXPublicKey(l.Key); err != nil {
+			t.Errorf("log %v: %v", l.Description, err)
+		}
+	}
+	// Sorted, trusted only.
+	want := []string{"Test 'Read-only' log", "Test 'Usable' log"}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("parseCTLogs() got %v; want %v", got, want)
+	}
+}
+
+func TestParseCTLogsInvalid(t *testing.T) {
+	for _, s := range []string{
+		`{"operators": []}`,
+		`{"operators": [{"logs": [{"key": "!", "state": {"usable": {}}}]}]}`,
+		`not json`,
+	} {
+		if _, err := parseCTLogs(strings.NewReader(s)); err == nil {
+			t.Errorf("parseCTLogs(%v) got no error", s)
+		}
+	}
+}
+
+func TestGenerateCTLogs(t *testing.T) {
+	b := string(generateCTLogs([]ctLog{{Description: "Test log", Key: []byte{0, 'a'}}}))
+	for _, want := range []string{
+		"package hsts\n",
+		"var preloadCTLogs = []string{\n\"\\x00a\", // Test log\n}\n",
+	} {
+		if !strings.Contains(b, want) {
+			t.Errorf("generateCTLogs() missing %q in\n%s", want, b)
+		}
+	}
+}
+
+// TestLiveCTLogs tests that we can still generate the logs, to catch
+// if anything changes on Google side. Run with -live.
+func TestLiveCTLogs(t *testing.T) {
+	if !*live {
+		t.Skip("use -live to test against the live list of logs")
+	}
+	b, err := download(ctLogsURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs, err := parseCTLogs(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(logs) < 5 {
+		t.Errorf("too few logs: %v", len(logs))
+	}
+}
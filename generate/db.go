@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// dbMain generates the Go file for the database of all entries.
+func dbMain() error {
+	if len(srcs) > 0 {
+		entries, err := getSources(srcs)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(*out, generateDB(entries), 0660)
+	}
+	js, err := download(preloadURL)
+	if err != nil {
+		return err
+	}
+	entries, err := parseAll(bytes.NewReader(js))
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(*out, generateDB(entries), 0660)
+}
+
+// parseAll parses Chromium's JSON with comments to return all entries, not
+// only those forcing HTTPS, sorted by name.
+func parseAll(r io.Reader) ([]entry, error) {
+	js, err := removeComments(r)
+	if err != nil {
+		return nil, err
+	}
+	var tss transportSecurityState
+	if err := json.Unmarshal(js, &tss); err != nil {
+		return nil, err
+	}
+	set := make(map[string]entry) // the last duplicate wins, like sites
+	for _, e := range tss.Entries {
+		if err := checkEntry(e); err != nil {
+			return nil, err
+		}
+		set[e.Name] = e
+	}
+	return sorted(set)
+}
+
+// generateDB generates the Go file for the database of all entries.
+// Like the preload list, entries are lines of a single constant, in sorted
+// order so that they can be searched in place, with tab-separated fields:
+// name, policy, mode, flags (s for include_subdomains, p for
+// include_subdomains_for_pinning), pinset and, if generated from -src, the
+// comma-separated sources listing the entry.
+func generateDB(entries []entry) []byte {
+	var b bytes.Buffer
+	if *tags != "" {
+		fmt.Fprintf(&b, "//go:build %s\n", *tags)
+		fmt.Fprintf(&b, "// +build %s\n", *tags)
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "package %s\n", *pkg)
+	b.WriteString("\n")
+	b.WriteString("// Automatically generated with go generate.\n")
+	b.WriteString("\n")
+	b.WriteString("// Entries, one per line in sorted order: name, policy, mode, flags, pinset and\n")
+	b.WriteString("// sources if any, separated by tabs.\n")
+	fmt.Fprintf(&b, "const %sEntries = `\n", *varname)
+	for _, e := range entries {
+		var flags string
+		if e.IncludeSubDomains {
+			flags += "s"
+		}
+		if e.IncludeSubDomainsForPinning {
+			flags += "p"
+		}
+		fmt.Fprintf(&b, "%s\t%s\t%s\t%s\t%s", e.Name, e.Policy, e.Mode, flags, e.Pins)
+		if len(e.Sources) > 0 {
+			fmt.Fprintf(&b, "\t%s", strings.Join(e.Sources, ","))
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("`\n")
+	return b.Bytes()
+}
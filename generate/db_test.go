@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseAll(t *testing.T) {
+	f, err := os.Open("testdata/transport_security_state_static.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	entries, err := parseAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Name)
+	}
+	// Sorted, unique, pins only included.
+	want := []string{"accounts.google.com", "dev", "example.com", "google", "login.yahoo.com", "pinningtest.appspot.com", "pins-only.example.net", "pins-only.example.org"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("parseAll() got %v; want %v", got, want)
+	}
+	if _, err := parseAll(strings.NewReader(`{"entries": [{"name": "a\tb"}]}`)); err == nil {
+		t.Error("parseAll() of a name with a tab succeeded; want error")
+	}
+}
+
+func TestGenerateDB(t *testing.T) {
+	*pkg, *varname = "hstsdb", "db"
+	defer func() { *pkg, *varname = "hsts", "preload" }()
+	b := string(generateDB([]entry{
+		{Name: "example.com", Policy: "custom", Mode: "force-https", IncludeSubDomains: true, Pins: "test", IncludeSubDomainsForPinning: true},
+		{Name: "example.org", Policy: "bulk-18-weeks", Mode: "force-https"},
+	}))
+	for _, want := range []string{
+		"package hstsdb\n",
+		"const dbEntries = `\nexample.com\tcustom\tforce-https\tsp\ttest\nexample.org\tbulk-18-weeks\tforce-https\t\t\n`\n",
+	} {
+		if !strings.Contains(b, want) {
+			t.Errorf("generateDB() missing %q in\n%s", want, b)
+		}
+	}
+}
+
+func TestGenerateDBChromium(t *testing.T) {
+	*pkg, *varname = "hstsdb", "db"
+	defer func() { *pkg, *varname = "hsts", "preload" }()
+	f, err := os.Open("testdata/transport_security_state_static.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	entries, err := parseAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := string(generateDB(entries))
+	for _, want := range []string{
+		"\naccounts.google.com\tgoogle\tforce-https\ts\tgoogle\n", // pinned
+		"\ndev\tpublic-suffix\tforce-https\ts\t\n",                // policy
+		"\npinningtest.appspot.com\ttest\t\ts\ttest\n",            // pinned only, not forcing HTTPS
+		"\npins-only.example.net\tcustom\t\tp\ttest\n",            // pins including subdomains
+	} {
+		if !strings.Contains(b, want) {
+			t.Errorf("generateDB() missing %q in\n%s", want, b)
+		}
+	}
+}
+
+// TestLiveDB tests that the entries still have the metadata of the database.
+// Run with -live.
+func TestLiveDB(t *testing.T) {
+	if !*live {
+		t.Skip("use -live to test against the live Chromium list")
+	}
+	js, err := download(preloadURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := parseAll(strings.NewReader(string(js)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]entry)
+	for _, e := range entries {
+		got[e.Name] = e
+	}
+	if e := got["accounts.google.com"]; e.Policy != "google" || e.Mode != "force-https" || e.Pins != "google" {
+		t.Errorf("accounts.google.com = %+v; want pinned by google forcing HTTPS", e)
+	}
+	if e := got["pinningtest.appspot.com"]; e.Mode != "" || e.Pins != "test" {
+		t.Errorf("pinningtest.appspot.com = %+v; want pinned only", e)
+	}
+	if e := got["dev"]; e.Policy != "public-suffix" {
+		t.Errorf("dev = %+v; want the public-suffix policy", e)
+	}
+}
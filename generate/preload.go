@@ -1,4 +1,11 @@
-// Binary preload generates a Go file with preloaded HSTS sites from Chromium.
+// Binary generate generates a Go file with preloaded HSTS sites from Chromium,
+// with the Certificate Transparency logs it trusts, or with all its entries
+// with their metadata.
+//
+// With -src, repeated, the sites or entries are instead the union of several
+// sources, such as Chromium, Firefox, hstspreload.org's pending entries and an
+// organization's own list, de-duplicated, and the database of entries keeps
+// which sources listed each.
 package main
 
 import (
@@ -12,43 +19,217 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
+	"os"
 	"sort"
 	"strings"
 )
 
 var (
 	pkg     = flag.String("p", "hsts", "Package name.")
-	varname = flag.String("v", "preload", "Variable name.")
+	varname = flag.String("v", "preload", "Prefix of the constant names.")
 	out     = flag.String("o", "preload.go", "Output file.")
+	tags    = flag.String("b", "", "Build constraint, if any.")
+	cache   = flag.String("c", "", "Cache file to only download and regenerate when modified.")
+	force   = flag.Bool("f", false, "Write output even if the list looks degraded.")
+	ctLogs  = flag.Bool("ctlogs", false, "Generate the trusted Certificate Transparency logs instead.")
+	db      = flag.Bool("db", false, "Generate the database of all entries with their metadata instead.")
+	srcs    sources
 )
 
+func init() {
+	flag.Var(&srcs, "src", "Source to union, repeatable: chromium, firefox or pending, optionally followed by a colon and a URL or file to read it from.")
+}
+
 func main() {
 	flag.Parse()
-	sites, err := get()
+	if *ctLogs {
+		if err := ctLogsMain(); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *db {
+		if err := dbMain(); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(srcs) > 0 && *cache != "" {
+		log.Fatal("-c cannot be used with -src")
+	}
+	var sites []entry
+	var modified bool
+	var err error
+	if len(srcs) > 0 {
+		sites, err = getSources(srcs)
+		sites, modified = forceHTTPS(sites), true
+	} else {
+		sites, modified, err = get(preloadURL, *cache)
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
+	if !modified {
+		log.Printf("not modified since last download, keeping %v", *out)
+		return
+	}
+	if err := validate(sites, countPrevious(*out)); err != nil {
+		if !*force {
+			log.Fatalf("refusing to overwrite %v (use -f to force): %v", *out, err)
+		}
+		log.Printf("forced: %v", err)
+	}
+	if err := ioutil.WriteFile(*out, generate(sites), 0660); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// generate generates the Go file for the preloaded HSTS sites.
+// Rather than a map, which costs a string header and map bucket per site, two
+// constants list the hosts with and without includeSubDomains, one per line
+// in sorted order so that they can be searched in place.
+func generate(sites []entry) []byte {
 	var b bytes.Buffer
+	if *tags != "" {
+		fmt.Fprintf(&b, "//go:build %s\n", *tags)
+		fmt.Fprintf(&b, "// +build %s\n", *tags)
+		b.WriteString("\n")
+	}
 	fmt.Fprintf(&b, "package %s\n", *pkg)
 	b.WriteString("\n")
 	b.WriteString("// Automatically generated with go generate.\n")
-	b.WriteString("\n")
-	b.WriteString("// Host -> includeSubDomains\n")
-	fmt.Fprintf(&b, "var %s = map[string]bool{\n", *varname)
+	for _, list := range []struct {
+		suffix            string
+		comment           string
+		includeSubDomains bool
+	}{
+		{"IncludeSubDomains", "Hosts including subdomains", true},
+		{"HostOnly", "Hosts not including subdomains", false},
+	} {
+		b.WriteString("\n")
+		fmt.Fprintf(&b, "// %s, one per line in sorted order.\n", list.comment)
+		fmt.Fprintf(&b, "const %s%s = `\n", *varname, list.suffix)
+		for _, e := range sites {
+			if e.IncludeSubDomains == list.includeSubDomains {
+				fmt.Fprintf(&b, "%s\n", e.Name)
+			}
+		}
+		b.WriteString("`\n")
+	}
+	return b.Bytes()
+}
+
+// sentinels are sites expected to always be preloaded.
+var sentinels = []string{
+	"accounts.google.com",
+	"github.com",
+	"login.yahoo.com",
+	"paypal.com",
+}
+
+// minRatio is how much smaller than the previous list a new list may be.
+const minRatio = 0.9
+
+// validate checks that a new list is not degraded compared to the previous
+// one, so that a transient upstream problem does not ship a tiny list.
+func validate(sites []entry, previous int) error {
+	if float64(len(sites)) < minRatio*float64(previous) {
+		return fmt.Errorf("list shrank from %d to %d sites", previous, len(sites))
+	}
+	names := make(map[string]bool)
 	for _, e := range sites {
-		fmt.Fprintf(&b, "\t%#v: %v,\n", e.Name, e.IncludeSubDomains)
+		if e.Name == "" || strings.ContainsAny(e.Name, "\n`") {
+			return fmt.Errorf("invalid site name: %q", e.Name)
+		}
+		names[e.Name] = true
 	}
-	b.WriteString("}\n")
-	if err := ioutil.WriteFile(*out, b.Bytes(), 0660); err != nil {
-		log.Fatal(err)
+	for _, name := range sentinels {
+		if !names[name] {
+			return fmt.Errorf("sentinel site missing: %v", name)
+		}
+	}
+	return nil
+}
+
+// countPrevious counts the sites in a previously generated file, if any.
+func countPrevious(path string) int {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	n, list := 0, false
+	for _, line := range strings.Split(string(b), "\n") {
+		switch {
+		case strings.HasSuffix(line, " = `"):
+			list = true
+		case line == "`":
+			list = false
+		case list:
+			n++
+		}
 	}
+	return n
 }
 
 const preloadURL = "https://github.com/chromium/chromium/raw/main/net/http/transport_security_state_static.json"
 
-// get obtains the file, decodes base64 and parses JSON to return preloaded HSTS sites.
-func get() ([]entry, error) {
-	resp, err := http.Get(preloadURL)
+// get obtains the file and parses it to return preloaded HSTS sites.
+// If a cache file is given, the request is conditional on the cached copy and
+// if the server says it was not modified, no sites are returned and modified is false.
+func get(url, cache string) (sites []entry, modified bool, err error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	var m cacheMeta
+	if cache != "" {
+		m = readCacheMeta(cache)
+		if m.ETag != "" {
+			req.Header.Set("If-None-Match", m.ETag)
+		}
+		if m.LastModified != "" {
+			req.Header.Set("If-Modified-Since", m.LastModified)
+		}
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && cache != "" {
+		if _, err := os.Stat(cache); err == nil {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("server returned %v but cache %v is missing", resp.Status, cache)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, fmt.Errorf("server returned: %v", resp.Status)
+	}
+	if cache == "" {
+		sites, err := parse(resp.Body)
+		return sites, true, err
+	}
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, false, err
+	}
+	if sites, err = parse(bytes.NewReader(b)); err != nil {
+		return nil, false, err
+	}
+	// Only cache what parsed fine, so a bad download is retried next time.
+	if err := ioutil.WriteFile(cache, b, 0660); err != nil {
+		return nil, false, err
+	}
+	m = cacheMeta{ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}
+	if err := writeCacheMeta(cache, m); err != nil {
+		return nil, false, err
+	}
+	return sites, true, nil
+}
+
+// download obtains a file.
+func download(url string) ([]byte, error) {
+	resp, err := http.Get(url)
 	if err != nil {
 		return nil, err
 	}
@@ -56,7 +237,38 @@ func get() ([]entry, error) {
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("server returned: %v", resp.Status)
 	}
-	js, err := removeComments(resp.Body)
+	return ioutil.ReadAll(resp.Body)
+}
+
+// cacheMeta holds the validators of a cached download, stored next to it.
+type cacheMeta struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+func readCacheMeta(cache string) cacheMeta {
+	var m cacheMeta
+	b, err := ioutil.ReadFile(cache + ".meta")
+	if err != nil {
+		return m // no cache: unconditional request
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return cacheMeta{}
+	}
+	return m
+}
+
+func writeCacheMeta(cache string, m cacheMeta) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(cache+".meta", b, 0660)
+}
+
+// parse parses Chromium's JSON with comments to return preloaded HSTS sites.
+func parse(r io.Reader) ([]entry, error) {
+	js, err := removeComments(r)
 	if err != nil {
 		return nil, err
 	}
@@ -102,9 +314,14 @@ type transportSecurityState struct {
 }
 
 type entry struct {
-	Name              string `json:"name"`
-	IncludeSubDomains bool   `json:"include_subdomains"`
-	Mode              string `json:"mode"`
+	Name                        string `json:"name"`
+	Policy                      string `json:"policy"`
+	IncludeSubDomains           bool   `json:"include_subdomains"`
+	Mode                        string `json:"mode"`
+	Pins                        string `json:"pins"`
+	IncludeSubDomainsForPinning bool   `json:"include_subdomains_for_pinning"`
+
+	Sources []string `json:"-"` // listing it, with -src
 }
 
 type byName []entry
@@ -1,11 +1,162 @@
 package main
 
-import "testing"
+import (
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var live = flag.Bool("live", false, "Also test against the live Chromium list (requires network).")
+
+func TestParse(t *testing.T) {
+	f, err := os.Open("testdata/transport_security_state_static.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	sites, err := parse(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range sites {
+		got = append(got, e.Name)
+	}
+	// Sorted, unique, force-https only.
+	want := []string{"accounts.google.com", "dev", "example.com", "google", "login.yahoo.com"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("parse() got %v; want %v", got, want)
+	}
+	// The last duplicate wins.
+	for _, e := range sites {
+		if e.Name == "example.com" && !e.IncludeSubDomains {
+			t.Errorf("example.com does not include subdomains")
+		}
+	}
+}
+
+func TestParseEmpty(t *testing.T) {
+	if _, err := parse(strings.NewReader(`{"entries": []}`)); err == nil {
+		t.Error("parse() of empty list succeeded; want error")
+	}
+}
 
-// TestGenerate tests that we can still generate the list, to catch
-// if anything changes on Chromium side.
 func TestGenerate(t *testing.T) {
-	sites, err := get()
+	b := string(generate([]entry{
+		{Name: "example.com", IncludeSubDomains: true},
+		{Name: "example.org"},
+	}))
+	for _, want := range []string{
+		"package hsts\n",
+		"const preloadIncludeSubDomains = `\nexample.com\n`\n",
+		"const preloadHostOnly = `\nexample.org\n`\n",
+	} {
+		if !strings.Contains(b, want) {
+			t.Errorf("generate() missing %q", want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	var sites []entry
+	for _, name := range sentinels {
+		sites = append(sites, entry{Name: name})
+	}
+	for _, tt := range []struct {
+		sites    []entry
+		previous int
+		valid    bool
+	}{
+		{sites: sites, previous: 0, valid: true},
+		{sites: sites, previous: len(sites), valid: true},
+		{sites: sites, previous: len(sites) * 2, valid: false}, // shrank
+		{sites: sites[1:], previous: 0, valid: false},          // sentinel missing
+		{sites: append(sites, entry{Name: "a`b"}), previous: 0, valid: false},
+		{sites: nil, previous: 0, valid: false},
+	} {
+		err := validate(tt.sites, tt.previous)
+		if (err == nil) != tt.valid {
+			t.Errorf("validate(%d sites, %d) got error %v; want valid %v", len(tt.sites), tt.previous, err, tt.valid)
+		}
+	}
+}
+
+func TestCountPrevious(t *testing.T) {
+	if got := countPrevious("../preload.go"); got < 50000 {
+		t.Errorf("countPrevious(../preload.go) = %d; want at least 50000", got)
+	}
+	if got := countPrevious("does-not-exist.go"); got != 0 {
+		t.Errorf("countPrevious(missing) = %d; want 0", got)
+	}
+}
+
+func TestConditional(t *testing.T) {
+	fixture, err := ioutil.ReadFile("testdata/transport_security_state_static.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const etag = `"v1"`
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write(fixture)
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "preload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cache := filepath.Join(dir, "cache.json")
+
+	// First download is unconditional and fills the cache.
+	sites, modified, err := get(ts.URL, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !modified || len(sites) == 0 {
+		t.Fatalf("1: got modified %v with %d sites; want modified with sites", modified, len(sites))
+	}
+
+	// Second download is conditional and not modified.
+	sites, modified, err = get(ts.URL, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if modified || len(sites) != 0 {
+		t.Fatalf("2: got modified %v with %d sites; want not modified", modified, len(sites))
+	}
+
+	// Without the cached copy, not modified is an error.
+	if err := os.Remove(cache); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := get(ts.URL, cache); err == nil {
+		t.Error("3: got no error with cache missing")
+	}
+	if requests != 3 {
+		t.Errorf("got %d requests; want 3", requests)
+	}
+}
+
+// TestLive tests that we can still generate the list, to catch
+// if anything changes on Chromium side. Run with -live.
+func TestLive(t *testing.T) {
+	if !*live {
+		t.Skip("use -live to test against the live Chromium list")
+	}
+	sites, _, err := get(preloadURL, "")
 	if err != nil {
 		t.Fatal(err)
 	}
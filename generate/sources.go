@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+const (
+	firefoxURL = "https://hg.mozilla.org/mozilla-central/raw-file/tip/security/manager/ssl/nsSTSPreloadList.inc"
+	pendingURL = "https://hstspreload.org/api/v2/pending"
+)
+
+// sourceURLs are where the lists of each kind of source are by default.
+var sourceURLs = map[string]string{
+	"chromium": preloadURL,
+	"firefox":  firefoxURL,
+	"pending":  pendingURL,
+}
+
+// A source is a list to union with others, given with -src as a kind,
+// optionally followed by a colon and a URL or local file to read it from
+// instead of the upstream one, e.g. chromium:internal/hsts.json for an
+// organization's own list in Chromium's format.
+type source struct {
+	Name     string // as given, to attribute entries
+	Kind     string // chromium, firefox or pending
+	Location string // URL or local file
+}
+
+// sources is the value of the repeatable -src flag.
+type sources []source
+
+func (s *sources) String() string {
+	var names []string
+	for _, src := range *s {
+		names = append(names, src.Name)
+	}
+	return strings.Join(names, " ")
+}
+
+func (s *sources) Set(name string) error {
+	if strings.ContainsAny(name, ",\t\n`") {
+		return fmt.Errorf("invalid source: %q", name)
+	}
+	kind, location := name, ""
+	if i := strings.IndexByte(name, ':'); i != -1 {
+		kind, location = name[:i], name[i+1:]
+	}
+	url, ok := sourceURLs[kind]
+	if !ok {
+		return fmt.Errorf("unknown source kind %q: want chromium, firefox or pending", kind)
+	}
+	if location == "" {
+		location = url
+	}
+	for _, src := range *s {
+		if src.Name == name {
+			return fmt.Errorf("duplicate source: %v", name)
+		}
+	}
+	*s = append(*s, source{Name: name, Kind: kind, Location: location})
+	return nil
+}
+
+// read obtains the list of a source, downloaded or read from a local file.
+func (src source) read() ([]byte, error) {
+	if strings.HasPrefix(src.Location, "https://") || strings.HasPrefix(src.Location, "http://") {
+		return download(src.Location)
+	}
+	return ioutil.ReadFile(src.Location)
+}
+
+// parse parses the list of a source to return all its entries, sorted by name.
+func (src source) parse(r io.Reader) ([]entry, error) {
+	switch src.Kind {
+	case "firefox":
+		return parseFirefox(r)
+	case "pending":
+		return parsePending(r)
+	}
+	return parseAll(r)
+}
+
+// getSources obtains and unions the lists of sources, see union.
+func getSources(srcs []source) ([]entry, error) {
+	var lists [][]entry
+	for _, src := range srcs {
+		b, err := src.read()
+		if err != nil {
+			return nil, fmt.Errorf("source %v: %v", src.Name, err)
+		}
+		entries, err := src.parse(bytes.NewReader(b))
+		if err != nil {
+			return nil, fmt.Errorf("source %v: %v", src.Name, err)
+		}
+		for i := range entries {
+			entries[i].Sources = []string{src.Name}
+		}
+		lists = append(lists, entries)
+	}
+	return union(lists), nil
+}
+
+// union unions lists of entries into one, de-duplicated and sorted by name.
+// An entry listed by several sources takes its fields from the first,
+// except that it forces HTTPS and includes subdomains if any of them says so,
+// and is attributed to all of them, in order.
+func union(lists [][]entry) []entry {
+	set := make(map[string]*entry)
+	for _, list := range lists {
+		for _, e := range list {
+			u, ok := set[e.Name]
+			if !ok {
+				e := e
+				e.Sources = append([]string(nil), e.Sources...)
+				set[e.Name] = &e
+				continue
+			}
+			if e.Mode == "force-https" {
+				if u.Mode != "force-https" {
+					u.Mode = e.Mode
+					u.IncludeSubDomains = false
+				}
+				u.IncludeSubDomains = u.IncludeSubDomains || e.IncludeSubDomains
+			}
+			u.Sources = append(u.Sources, e.Sources...)
+		}
+	}
+	entries := make([]entry, 0, len(set))
+	for _, e := range set {
+		entries = append(entries, *e)
+	}
+	sort.Sort(byName(entries))
+	return entries
+}
+
+// forceHTTPS returns the entries forcing HTTPS, the preloaded sites.
+func forceHTTPS(entries []entry) []entry {
+	var sites []entry
+	for _, e := range entries {
+		if e.Mode == "force-https" {
+			sites = append(sites, e)
+		}
+	}
+	return sites
+}
+
+// parseFirefox parses Firefox's nsSTSPreloadList.inc to return its entries,
+// sorted by name. Entries are lines between two %% lines, of a host, a comma
+// and 1 if it includes subdomains or 0 otherwise.
+func parseFirefox(r io.Reader) ([]entry, error) {
+	set := make(map[string]entry)
+	scanner := bufio.NewScanner(r)
+	in := false
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "%%" {
+			in = !in
+			continue
+		}
+		if !in || line == "" {
+			continue
+		}
+		i := strings.IndexByte(line, ',')
+		if i == -1 {
+			return nil, fmt.Errorf("invalid line: %q", line)
+		}
+		e := entry{Name: strings.TrimSpace(line[:i]), Mode: "force-https"}
+		switch strings.TrimSpace(line[i+1:]) {
+		case "1":
+			e.IncludeSubDomains = true
+		case "0":
+		default:
+			return nil, fmt.Errorf("invalid line: %q", line)
+		}
+		if err := checkEntry(e); err != nil {
+			return nil, err
+		}
+		set[e.Name] = e
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return sorted(set)
+}
+
+// parsePending parses the JSON array of hstspreload.org's pending entries to
+// return them, sorted by name.
+func parsePending(r io.Reader) ([]entry, error) {
+	var list []entry
+	if err := json.NewDecoder(r).Decode(&list); err != nil {
+		return nil, err
+	}
+	set := make(map[string]entry)
+	for _, e := range list {
+		if e.Mode == "" {
+			e.Mode = "force-https"
+		}
+		if err := checkEntry(e); err != nil {
+			return nil, err
+		}
+		set[e.Name] = e
+	}
+	return sorted(set)
+}
+
+// checkEntry checks that the fields of an entry fit in the generated files.
+func checkEntry(e entry) error {
+	for _, s := range []string{e.Name, e.Policy, e.Mode, e.Pins} {
+		if strings.ContainsAny(s, "\t\n`") {
+			return fmt.Errorf("invalid entry: %q", s)
+		}
+	}
+	if e.Name == "" {
+		return errors.New("entry without a name")
+	}
+	return nil
+}
+
+// sorted returns the entries of a set sorted by name.
+func sorted(set map[string]entry) ([]entry, error) {
+	if len(set) == 0 {
+		return nil, errors.New("no entries")
+	}
+	var entries []entry
+	for _, e := range set {
+		entries = append(entries, e)
+	}
+	sort.Sort(byName(entries))
+	return entries, nil
+}
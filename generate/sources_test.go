@@ -0,0 +1,157 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseFirefox(t *testing.T) {
+	f, err := os.Open("testdata/nsSTSPreloadList.inc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	entries, err := parseFirefox(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Name)
+		if e.Mode != "force-https" {
+			t.Errorf("%v has mode %q; want force-https", e.Name, e.Mode)
+		}
+		if want := e.Name != "example.com"; e.IncludeSubDomains != want {
+			t.Errorf("%v includes subdomains %v; want %v", e.Name, e.IncludeSubDomains, want)
+		}
+	}
+	want := []string{"example.com", "firefox-only.example.net", "login.yahoo.com", "pins-only.example.org"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("parseFirefox() got %v; want %v", got, want)
+	}
+	for _, list := range []string{
+		"%%\nexample.com\n%%\n",
+		"%%\nexample.com, 2\n%%\n",
+		"%%\na\tb, 1\n%%\n",
+		"example.com, 1\n", // outside of %%
+	} {
+		if _, err := parseFirefox(strings.NewReader(list)); err == nil {
+			t.Errorf("parseFirefox(%q) succeeded; want error", list)
+		}
+	}
+}
+
+func TestParsePending(t *testing.T) {
+	f, err := os.Open("testdata/pending.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	entries, err := parsePending(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Name != "example.com" || entries[1].Name != "pending.example.org" || !entries[1].IncludeSubDomains {
+		t.Errorf("parsePending() got %+v", entries)
+	}
+	if _, err := parsePending(strings.NewReader(`[]`)); err == nil {
+		t.Error("parsePending() of empty list succeeded; want error")
+	}
+}
+
+func TestSourcesFlag(t *testing.T) {
+	var s sources
+	for _, v := range []string{"chromium", "firefox:testdata/nsSTSPreloadList.inc", "chromium:https://example.com/org.json"} {
+		if err := s.Set(v); err != nil {
+			t.Fatalf("Set(%q): %v", v, err)
+		}
+	}
+	want := []source{
+		{Name: "chromium", Kind: "chromium", Location: preloadURL},
+		{Name: "firefox:testdata/nsSTSPreloadList.inc", Kind: "firefox", Location: "testdata/nsSTSPreloadList.inc"},
+		{Name: "chromium:https://example.com/org.json", Kind: "chromium", Location: "https://example.com/org.json"},
+	}
+	for i := range want {
+		if s[i] != want[i] {
+			t.Errorf("source %d = %+v; want %+v", i, s[i], want[i])
+		}
+	}
+	for _, v := range []string{"safari", "chromium", "pending:a,b"} {
+		if err := s.Set(v); err == nil {
+			t.Errorf("Set(%q) succeeded; want error", v)
+		}
+	}
+}
+
+func TestGetSources(t *testing.T) {
+	pending, err := ioutil.ReadFile("testdata/pending.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(pending)
+	}))
+	defer ts.Close()
+
+	var s sources
+	for _, v := range []string{
+		"chromium:testdata/transport_security_state_static.json",
+		"firefox:testdata/nsSTSPreloadList.inc",
+		"pending:" + ts.URL,
+	} {
+		if err := s.Set(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := getSources(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]entry)
+	var names []string
+	for _, e := range entries {
+		got[e.Name] = e
+		names = append(names, e.Name)
+	}
+	// Sorted and unique.
+	want := []string{"accounts.google.com", "dev", "example.com", "firefox-only.example.net", "google", "login.yahoo.com",
+		"pending.example.org", "pinningtest.appspot.com", "pins-only.example.net", "pins-only.example.org"}
+	if strings.Join(names, " ") != strings.Join(want, " ") {
+		t.Fatalf("getSources() got %v; want %v", names, want)
+	}
+
+	// Attributed to every source listing it, in order.
+	e := got["example.com"]
+	if want := []string{s[0].Name, s[1].Name, s[2].Name}; strings.Join(e.Sources, " ") != strings.Join(want, " ") {
+		t.Errorf("example.com sources %v; want %v", e.Sources, want)
+	}
+	// Fields of the first, including subdomains if any does.
+	if e.Policy != "bulk-18-weeks" || !e.IncludeSubDomains {
+		t.Errorf("example.com got %+v; want policy of Chromium including subdomains", e)
+	}
+	if e := got["firefox-only.example.net"]; len(e.Sources) != 1 || e.Sources[0] != s[1].Name {
+		t.Errorf("firefox-only.example.net sources %v; want only Firefox", e.Sources)
+	}
+	// Pinned only by Chromium but forcing HTTPS in Firefox.
+	if e := got["pins-only.example.org"]; e.Mode != "force-https" || e.Pins != "google" || !e.IncludeSubDomains {
+		t.Errorf("pins-only.example.org got %+v; want forcing HTTPS with pins", e)
+	}
+	for _, e := range forceHTTPS(entries) {
+		if e.Name == "pins-only.example.net" {
+			t.Error("forceHTTPS() kept a pins-only entry")
+		}
+	}
+
+	b := string(generateDB(entries))
+	if want := "\nfirefox-only.example.net\t\tforce-https\ts\t\tfirefox:testdata/nsSTSPreloadList.inc\n"; !strings.Contains(b, want) {
+		t.Errorf("generateDB() missing %q", want)
+	}
+
+	if _, err := getSources(sources{{Name: "firefox", Kind: "firefox", Location: "testdata/missing.inc"}}); err == nil {
+		t.Error("getSources() of a missing file succeeded; want error")
+	}
+}
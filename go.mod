@@ -1,3 +1,7 @@
 module github.com/StalkR/hsts
 
-go 1.14
+go 1.21
+
+require golang.org/x/net v0.33.0
+
+require golang.org/x/text v0.21.0 // indirect
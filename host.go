@@ -0,0 +1,126 @@
+package hsts
+
+import (
+	"net"
+	"strings"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/net/publicsuffix"
+)
+
+// canonicalize canonicalizes a host for use as state key and in lookups.
+// Any port is removed, as well as brackets around IPv6 addresses.
+// Section 8.2 says domain names are compared case-insensitively.
+// A single trailing dot of absolute domain names (example.com.) is removed.
+// Section 8.3 step 1 says internationalized domain names are converted to
+// their A-label (punycode) form, which is also what the preload list uses.
+func canonicalize(host string) string {
+	// Without a colon there is no port nor IPv6, and SplitHostPort would
+	// allocate its error.
+	if strings.IndexByte(host, ':') >= 0 {
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		} else if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+			host = host[1 : len(host)-1]
+		}
+	}
+	return canonicalizeName(host)
+}
+
+func canonicalizeName(name string) string {
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	if isASCII(name) {
+		return name // already in A-label form, avoids allocating
+	}
+	if a, err := idna.Lookup.ToASCII(name); err == nil {
+		return a
+	}
+	return name // not a valid IDN, keep it and it will not match
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// parseIP parses a host (without port) as an IP address, or returns nil.
+// Names are told apart without calling net.ParseIP, which allocates: an IPv4
+// address ends with a digit and an IPv6 address contains a colon.
+// The zone of an IPv6 address (fe80::1%eth0, or %25 escaped as in URLs) is
+// ignored, which net.ParseIP would reject.
+func parseIP(host string) net.IP {
+	if host == "" {
+		return nil
+	}
+	colon := strings.IndexByte(host, ':') != -1
+	if c := host[len(host)-1]; (c < '0' || c > '9') && !colon {
+		return nil
+	}
+	if i := strings.IndexByte(host, '%'); i != -1 && colon {
+		host = host[:i]
+	}
+	return net.ParseIP(host)
+}
+
+// isPublicSuffix tells whether a canonical host (without port) is a public
+// suffix (e.g. com, co.uk or github.io) under which anyone can register names.
+func isPublicSuffix(host string) bool {
+	suffix, _ := publicsuffix.PublicSuffix(host)
+	return suffix == host
+}
+
+// localNets are loopback and private networks (RFC 1918, RFC 4193).
+var localNets = func() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range []string{
+		"127.0.0.0/8",
+		"10.0.0.0/8",
+		"172.16.0.0/12",
+		"192.168.0.0/16",
+		"::1/128",
+		"fc00::/7",
+	} {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}()
+
+// localSuffixes are names which are only resolved locally.
+var localSuffixes = []string{"localhost", "local", "internal"}
+
+// isLocal tells whether a canonical host (without port) is local: a loopback
+// or private address, localhost, or a .local or .internal name.
+func isLocal(host string) bool {
+	if ip := parseIP(host); ip != nil {
+		for _, n := range localNets {
+			if n.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, suffix := range localSuffixes {
+		if host == suffix || strings.HasSuffix(host, "."+suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// inDomains tells whether a canonical host is one of domains or a subdomain.
+func inDomains(host string, domains []string) bool {
+	for _, domain := range domains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package hsts
+
+import "testing"
+
+func TestCanonicalize(t *testing.T) {
+	for _, tt := range []struct {
+		host string
+		want string
+	}{
+		{"example.com", "example.com"},
+		{"Example.COM", "example.com"},
+		{"example.com.", "example.com"},
+		{"Example.Com.:8080", "example.com"},
+		{"example.com:80", "example.com"},
+		{"example.com..", "example.com."}, // only a single dot
+		{"[2001:DB8::1]:80", "2001:db8::1"},
+		{"[2001:db8::1]", "2001:db8::1"},
+		{"bücher.example", "xn--bcher-kva.example"},
+		{"BÜCHER.example.:80", "xn--bcher-kva.example"},
+		{"xn--bcher-kva.example", "xn--bcher-kva.example"},
+	} {
+		if got := canonicalize(tt.host); got != tt.want {
+			t.Errorf("canonicalize(%v) = %v; want %v", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestIsPublicSuffix(t *testing.T) {
+	for _, tt := range []struct {
+		host string
+		want bool
+	}{
+		{"com", true},
+		{"co.uk", true},
+		{"github.io", true},
+		{"localhost", true}, // unknown single label
+		{"example.com", false},
+		{"example.co.uk", false},
+		{"example.github.io", false},
+	} {
+		if got := isPublicSuffix(tt.host); got != tt.want {
+			t.Errorf("isPublicSuffix(%v) = %v; want %v", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestIsLocal(t *testing.T) {
+	for _, tt := range []struct {
+		host string
+		want bool
+	}{
+		{"localhost", true},
+		{"app.localhost", true},
+		{"printer.local", true},
+		{"db.internal", true},
+		{"127.0.0.1", true},
+		{"127.1.2.3", true},
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"172.31.255.255", true},
+		{"192.168.1.1", true},
+		{"::1", true},
+		{"fd00::1", true},
+		{"example.com", false},
+		{"notlocal", false},
+		{"local.example.com", false},
+		{"172.32.0.1", false},
+		{"8.8.8.8", false},
+		{"2001:db8::1", false},
+	} {
+		if got := isLocal(tt.host); got != tt.want {
+			t.Errorf("isLocal(%v) = %v; want %v", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestInDomains(t *testing.T) {
+	domains := []string{"example.com", "example.org"}
+	for _, tt := range []struct {
+		host string
+		want bool
+	}{
+		{"example.com", true},
+		{"sub.example.com", true},
+		{"x.sub.example.org", true},
+		{"notexample.com", false},
+		{"example.net", false},
+		{"com", false},
+	} {
+		if got := inDomains(tt.host, domains); got != tt.want {
+			t.Errorf("inDomains(%v) = %v; want %v", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestIsIP(t *testing.T) {
+	for _, tt := range []struct {
+		host string
+		want bool
+	}{
+		{"192.0.2.1", true},
+		{"169.254.1.1", true},
+		{"2001:db8::1", true},
+		{"fe80::1", true},
+		{"fe80::1%eth0", true},
+		{"fe80::1%25eth0", true},
+		{canonicalize("[fe80::1%25eth0]:443"), true},
+		{"example.com", false},
+		{"1.example", false},
+		{"example%eth0", false},
+		{"", false},
+	} {
+		if got := isIP(tt.host); got != tt.want {
+			t.Errorf("isIP(%q) = %v; want %v", tt.host, got, tt.want)
+		}
+	}
+}
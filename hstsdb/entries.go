@@ -0,0 +1,8 @@
+package hstsdb
+
+// Automatically generated with go generate.
+
+// Entries, one per line in sorted order: name, policy, mode, flags, pinset and
+// sources if any, separated by tabs.
+const dbEntries = `
+`
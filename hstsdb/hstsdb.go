@@ -0,0 +1,123 @@
+// Package hstsdb is a read-only database of Chromium's transport security
+// state entries with all their metadata (mode, include subdomains, pinset and
+// policy), not only the hosts forcing HTTPS which package hsts preloads.
+// It is updated with go generate, which downloads Chromium's list: until it
+// is run there are no entries (Len is 0), as the metadata cannot be derived
+// from the preload list of package hsts.
+package hstsdb
+
+//go:generate go run ../generate -db -p hstsdb -v db -o entries.go
+//go:generate gofmt -w entries.go
+
+import "strings"
+
+// ForceHTTPS is the mode of entries which must be accessed over HTTPS.
+const ForceHTTPS = "force-https"
+
+// An Entry is a Chromium transport security state entry.
+type Entry struct {
+	Name                        string
+	Policy                      string // why it is listed, e.g. custom, bulk-18-weeks, public-suffix, if known
+	Mode                        string // ForceHTTPS, or empty if only pinned
+	IncludeSubDomains           bool
+	IncludeSubDomainsForPinning bool   // pins also apply to subdomains
+	Pinset                      string // static public key pinset, if pinned
+	Sources                     string // comma-separated lists it was unioned from, if generated from several
+}
+
+// Get returns the entry of a name.
+func Get(name string) (Entry, bool) {
+	return get(dbEntries, canonicalize(name))
+}
+
+// Lookup returns the entry applying to a host: its own, or that of the
+// nearest superdomain including subdomains, for HSTS or for pinning only.
+func Lookup(host string) (Entry, bool) {
+	return lookup(dbEntries, canonicalize(host))
+}
+
+// Len returns the number of entries.
+func Len() int {
+	return strings.Count(dbEntries, "\n") - 1
+}
+
+// Each calls f for each entry in sorted order, until it returns false.
+func Each(f func(Entry) bool) {
+	each(dbEntries, f)
+}
+
+func canonicalize(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+func lookup(list, host string) (Entry, bool) {
+	if e, ok := get(list, host); ok {
+		return e, true
+	}
+	for i := strings.IndexByte(host, '.'); i != -1; i = strings.IndexByte(host, '.') {
+		host = host[i+1:]
+		if e, ok := get(list, host); ok && (e.IncludeSubDomains || e.IncludeSubDomainsForPinning) {
+			return e, true
+		}
+	}
+	return Entry{}, false
+}
+
+// get returns the entry of a name in list, a sorted list of lines each
+// preceded and followed by a newline, with a binary search on its bytes.
+// Names are followed by a tab, lower than any byte of a name, so lines sort
+// like names.
+func get(list, name string) (Entry, bool) {
+	if name == "" || strings.ContainsAny(name, "\t\n") {
+		return Entry{}, false
+	}
+	// list[lo] and list[hi] are newlines around the lines left to search.
+	lo, hi := 0, len(list)-1
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		i := strings.LastIndexByte(list[:mid+1], '\n') // start of a line at or before mid
+		j := i + 1 + strings.IndexByte(list[i+1:], '\n')
+		line := list[i+1 : j]
+		lineName := line
+		if k := strings.IndexByte(line, '\t'); k != -1 {
+			lineName = line[:k]
+		}
+		switch {
+		case name == lineName:
+			return parse(line), true
+		case name < lineName:
+			hi = i
+		default:
+			lo = j
+		}
+	}
+	return Entry{}, false
+}
+
+func each(list string, f func(Entry) bool) {
+	for i := 1; i < len(list); {
+		j := i + strings.IndexByte(list[i:], '\n')
+		if !f(parse(list[i:j])) {
+			return
+		}
+		i = j + 1
+	}
+}
+
+// parse parses a line: name, policy, mode, flags, pinset and sources
+// separated by tabs.
+func parse(line string) Entry {
+	fields := strings.SplitN(line, "\t", 6)
+	for len(fields) < 6 {
+		fields = append(fields, "")
+	}
+	return Entry{
+		Name:                        fields[0],
+		Policy:                      fields[1],
+		Mode:                        fields[2],
+		IncludeSubDomains:           strings.Contains(fields[3], "s"),
+		IncludeSubDomainsForPinning: strings.Contains(fields[3], "p"),
+		Pinset:                      fields[4],
+		Sources:                     fields[5],
+	}
+}
@@ -0,0 +1,102 @@
+package hstsdb
+
+import (
+	"strings"
+	"testing"
+)
+
+// testEntries is a list in the generated format.
+const testEntries = "\n" +
+	"accounts.google.com\tgoogle\tforce-https\ts\tgoogle\n" +
+	"dev\tpublic-suffix\tforce-https\ts\t\n" +
+	"example.com\tbulk-18-weeks\tforce-https\t\t\n" +
+	"example.com.au\tcustom\tforce-https\ts\t\n" +
+	"pins-only.example.net\tcustom\t\tp\ttest\n" +
+	"unioned.example.org\t\tforce-https\ts\t\tfirefox,pending\n"
+
+func TestGet(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		want Entry
+		ok   bool
+	}{
+		{"example.com", Entry{Name: "example.com", Policy: "bulk-18-weeks", Mode: ForceHTTPS}, true},
+		{"example.com.au", Entry{Name: "example.com.au", Policy: "custom", Mode: ForceHTTPS, IncludeSubDomains: true}, true},
+		{"pins-only.example.net", Entry{Name: "pins-only.example.net", Policy: "custom", IncludeSubDomainsForPinning: true, Pinset: "test"}, true},
+		{"accounts.google.com", Entry{Name: "accounts.google.com", Policy: "google", Mode: ForceHTTPS, IncludeSubDomains: true, Pinset: "google"}, true},
+		{"dev", Entry{Name: "dev", Policy: "public-suffix", Mode: ForceHTTPS, IncludeSubDomains: true}, true},
+		{"unioned.example.org", Entry{Name: "unioned.example.org", Mode: ForceHTTPS, IncludeSubDomains: true, Sources: "firefox,pending"}, true},
+		{"example", Entry{}, false},
+		{"example.co", Entry{}, false},
+		{"zzz", Entry{}, false},
+		{"", Entry{}, false},
+		{"example.com\tbulk-18-weeks", Entry{}, false},
+	} {
+		got, ok := get(testEntries, tt.name)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("get(%q) = %+v, %v; want %+v, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	for _, tt := range []struct {
+		host, want string
+	}{
+		{"example.com", "example.com"},
+		{"sub.example.com", ""}, // host only
+		{"a.b.example.com.au", "example.com.au"},
+		{"foo.dev", "dev"},
+		{"sub.pins-only.example.net", "pins-only.example.net"},
+		{"example.org", ""},
+	} {
+		e, ok := lookup(testEntries, tt.host)
+		if e.Name != tt.want || ok != (tt.want != "") {
+			t.Errorf("lookup(%v) = %v, %v; want %v", tt.host, e.Name, ok, tt.want)
+		}
+	}
+}
+
+func TestEach(t *testing.T) {
+	var names []string
+	each(testEntries, func(e Entry) bool {
+		names = append(names, e.Name)
+		return len(names) < 3
+	})
+	if want := "accounts.google.com dev example.com"; strings.Join(names, " ") != want {
+		t.Errorf("each() got %v; want %v", names, want)
+	}
+}
+
+func TestGenerated(t *testing.T) {
+	if Len() == 0 {
+		t.Skip("entries not generated, see go generate")
+	}
+	n, prev := 0, ""
+	Each(func(e Entry) bool {
+		if e.Name <= prev {
+			t.Fatalf("%v after %v; want sorted and unique", e.Name, prev)
+		}
+		if got, ok := Get(e.Name); !ok || got != e {
+			t.Fatalf("Get(%v) = %+v, %v; want %+v", e.Name, got, ok, e)
+		}
+		n, prev = n+1, e.Name
+		return true
+	})
+	if n != Len() {
+		t.Errorf("Each() got %d entries; Len() = %d", n, Len())
+	}
+	// Known entries of Chromium's list.
+	for _, tt := range []struct {
+		host string
+		want Entry
+	}{
+		{"www.example.dev", Entry{Name: "dev", Policy: "public-suffix", Mode: ForceHTTPS, IncludeSubDomains: true}},
+		{"accounts.google.com", Entry{Name: "accounts.google.com", Policy: "google", Mode: ForceHTTPS, IncludeSubDomains: true, Pinset: "google"}},
+		{"pinningtest.appspot.com", Entry{Name: "pinningtest.appspot.com", Policy: "test", IncludeSubDomains: true, Pinset: "test"}}, // pinned only
+	} {
+		if e, ok := Lookup(tt.host); !ok || e != tt.want {
+			t.Errorf("Lookup(%v) = %+v, %v; want %+v", tt.host, e, ok, tt.want)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// Package hstshar seeds the state of an hsts.Transport from HAR (HTTP
+// Archive) captures, e.g. of a browser session, so that a client replaying it
+// starts with the same HSTS knowledge the browser had.
+package hstshar
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/StalkR/hsts"
+)
+
+// har is the part of a HAR file read, see http://www.softwareishard.com/blog/har-12-spec/.
+type har struct {
+	Log struct {
+		Entries []struct {
+			StartedDateTime time.Time `json:"startedDateTime"`
+			ServerIPAddress string    `json:"serverIPAddress"`
+			Request         struct {
+				URL string `json:"url"`
+			} `json:"request"`
+			Response struct {
+				Status  int `json:"status"`
+				Headers []struct {
+					Name  string `json:"name"`
+					Value string `json:"value"`
+				} `json:"headers"`
+			} `json:"response"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+// A header is a Strict-Transport-Security header from a HAR file.
+type header struct {
+	host     string
+	received time.Time
+	value    string
+	origin   hsts.Origin
+}
+
+// Import applies the Strict-Transport-Security headers of the HTTPS
+// responses in a HAR file to a Transport (see hsts.Transport.Apply), as if
+// received when they were recorded, in that order. Only the first header of
+// each response is considered (RFC 6797 section 8.1), and policies which
+// have since expired or are invalid are skipped. The browser is trusted to
+// have checked TLS, which HAR files do not record. Entries are attributed to
+// hsts.SourceFile, with the URL and server IP address recorded.
+// It returns how many headers changed the state.
+func Import(t *hsts.Transport, r io.Reader) (int, error) {
+	var f har
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return 0, err
+	}
+	var headers []header
+	for _, e := range f.Log.Entries {
+		if e.Response.Status == 0 { // not sent or blocked
+			continue
+		}
+		u, err := url.Parse(e.Request.URL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "wss") || u.Hostname() == "" {
+			continue
+		}
+		for _, h := range e.Response.Headers {
+			if strings.EqualFold(h.Name, "Strict-Transport-Security") {
+				origin := hsts.Origin{Source: hsts.SourceFile, URL: originURL(u), Addr: strings.Trim(e.ServerIPAddress, "[]")}
+				headers = append(headers, header{host: u.Hostname(), received: e.StartedDateTime, value: h.Value, origin: origin})
+				break
+			}
+		}
+	}
+	sort.SliceStable(headers, func(i, j int) bool { return headers[i].received.Before(headers[j].received) })
+
+	now := time.Now()
+	applied := 0
+	for _, h := range headers {
+		p, err := hsts.ParseHeader(h.value)
+		if err != nil {
+			continue
+		}
+		c := hsts.Change{Host: h.host, Removed: p.MaxAge == 0}
+		if !c.Removed {
+			if h.received.Add(p.MaxAge).Before(now) {
+				continue // expired since
+			}
+			c.Entry = hsts.Entry{Host: h.host, Received: h.received, Origin: h.origin, Policy: p}
+		}
+		if t.Apply(c) {
+			applied++
+		}
+	}
+	return applied, nil
+}
+
+// originURL returns a URL as kept in an hsts.Origin, without credentials,
+// query and fragment.
+func originURL(u *url.URL) string {
+	o := url.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path, RawPath: u.RawPath}
+	return o.String()
+}
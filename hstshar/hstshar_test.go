@@ -0,0 +1,55 @@
+package hstshar
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/StalkR/hsts"
+)
+
+func TestImport(t *testing.T) {
+	recent := time.Now().Add(-time.Hour).UTC()
+	at := func(d time.Duration) string { return recent.Add(d).Format(time.RFC3339Nano) }
+	har := `{"log": {"version": "1.2", "entries": [
+		{"startedDateTime": "` + at(2*time.Second) + `", "request": {"url": "https://removed.example/"},
+		 "response": {"status": 200, "headers": [{"name": "strict-transport-security", "value": "max-age=0"}]}},
+		{"startedDateTime": "` + at(0) + `", "serverIPAddress": "[2001:db8::1]", "request": {"url": "https://example.com/a?q=1"},
+		 "response": {"status": 200, "headers": [{"name": "Strict-Transport-Security", "value": "max-age=86400; includeSubDomains"}, {"name": "Strict-Transport-Security", "value": "max-age=1"}]}},
+		{"startedDateTime": "` + at(time.Second) + `", "request": {"url": "https://removed.example/"},
+		 "response": {"status": 200, "headers": [{"name": "Strict-Transport-Security", "value": "max-age=86400"}]}},
+		{"startedDateTime": "` + at(0) + `", "request": {"url": "http://plaintext.example/"},
+		 "response": {"status": 200, "headers": [{"name": "Strict-Transport-Security", "value": "max-age=86400"}]}},
+		{"startedDateTime": "` + at(0) + `", "request": {"url": "https://expired.example/"},
+		 "response": {"status": 200, "headers": [{"name": "Strict-Transport-Security", "value": "max-age=60"}]}},
+		{"startedDateTime": "` + at(0) + `", "request": {"url": "https://invalid.example/"},
+		 "response": {"status": 200, "headers": [{"name": "Strict-Transport-Security", "value": "includeSubDomains"}]}},
+		{"startedDateTime": "` + at(0) + `", "request": {"url": "https://blocked.example/"},
+		 "response": {"status": 0, "headers": [{"name": "Strict-Transport-Security", "value": "max-age=86400"}]}}
+	]}}`
+	transport := hsts.New(nil)
+	n, err := Import(transport, strings.NewReader(har))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// example.com, removed.example learned then removed.
+	if n != 3 {
+		t.Errorf("Import() = %v; want 3", n)
+	}
+	e, ok := transport.Lookup("sub.example.com")
+	if !ok || e.Host != "example.com" || e.MaxAge != 24*time.Hour || !e.IncludeSubDomains || !e.Received.Equal(recent.Truncate(time.Second)) {
+		t.Errorf("Lookup(sub.example.com) = %+v, %v; want example.com as recorded", e, ok)
+	}
+	if want := (hsts.Origin{Source: hsts.SourceFile, URL: "https://example.com/a", Addr: "2001:db8::1"}); e.Origin != want {
+		t.Errorf("got origin %+v; want %+v", e.Origin, want)
+	}
+	for _, host := range []string{"removed.example", "plaintext.example", "expired.example", "invalid.example", "blocked.example"} {
+		if e, ok := transport.Lookup(host); ok {
+			t.Errorf("Lookup(%v) = %+v; want unknown", host, e)
+		}
+	}
+
+	if _, err := Import(transport, strings.NewReader("not json")); err == nil {
+		t.Error("Import(not json) succeeded; want error")
+	}
+}
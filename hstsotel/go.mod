@@ -0,0 +1,16 @@
+module github.com/StalkR/hsts/hstsotel
+
+go 1.21
+
+require (
+	github.com/StalkR/hsts v0.0.0-00010101000000-000000000000
+	go.opentelemetry.io/otel v1.28.0
+	go.opentelemetry.io/otel/trace v1.28.0
+)
+
+require (
+	golang.org/x/net v0.33.0 // indirect
+	golang.org/x/text v0.21.0 // indirect
+)
+
+replace github.com/StalkR/hsts => ../
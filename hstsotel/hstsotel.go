@@ -0,0 +1,49 @@
+// Package hstsotel annotates OpenTelemetry trace spans with HSTS upgrades,
+// so that traces explain the redirect to HTTPS synthesized by hsts.Transport.
+package hstsotel
+
+import (
+	"github.com/StalkR/hsts"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Attribute keys set on spans.
+const (
+	Upgraded = attribute.Key("hsts.upgraded") // true if upgraded, false if it failed
+	Source   = attribute.Key("hsts.source")   // preload, dynamic or https-record
+	Policy   = attribute.Key("hsts.policy")   // source of the policy: preload, header, added, file or https-record, see hsts.Source
+	Host     = attribute.Key("hsts.host")     // known HSTS host whose policy applies
+	URL      = attribute.Key("hsts.url")      // upgraded URL
+)
+
+// Option returns an option for hsts.New annotating spans of upgraded requests.
+func Option() hsts.Option {
+	return hsts.WithUpgradeHook(Annotate)
+}
+
+// Annotate annotates the span in the context of an upgraded request, if any.
+// When the upgrade failed, the error is recorded too.
+func Annotate(u hsts.Upgrade) {
+	span := trace.SpanFromContext(u.Request.Context())
+	if !span.IsRecording() {
+		return
+	}
+	source := "dynamic"
+	switch {
+	case u.Preloaded:
+		source = "preload"
+	case u.HTTPSRecord:
+		source = "https-record"
+	}
+	span.SetAttributes(
+		Upgraded.Bool(u.Err == nil),
+		Source.String(source),
+		Policy.String(u.Source.String()),
+		Host.String(u.Host),
+		URL.String(u.URL.String()),
+	)
+	if u.Err != nil {
+		span.RecordError(u.Err)
+	}
+}
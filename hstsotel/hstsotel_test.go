@@ -0,0 +1,103 @@
+package hstsotel
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/StalkR/hsts"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// recordingSpan records attributes and errors.
+type recordingSpan struct {
+	noop.Span
+	attrs map[attribute.Key]attribute.Value
+	errs  []error
+}
+
+func (s *recordingSpan) IsRecording() bool { return true }
+
+func (s *recordingSpan) SetAttributes(kv ...attribute.KeyValue) {
+	for _, a := range kv {
+		s.attrs[a.Key] = a.Value
+	}
+}
+
+func (s *recordingSpan) RecordError(err error, options ...trace.EventOption) {
+	s.errs = append(s.errs, err)
+}
+
+func TestAnnotate(t *testing.T) {
+	for _, tt := range []struct {
+		preloaded   bool
+		httpsRecord bool
+		err         error
+		source      string
+	}{
+		{true, false, nil, "preload"},
+		{false, false, nil, "dynamic"},
+		{false, true, nil, "https-record"},
+		{false, false, errors.New("no proxy"), "dynamic"},
+	} {
+		span := &recordingSpan{attrs: make(map[attribute.Key]attribute.Value)}
+		req, err := http.NewRequestWithContext(trace.ContextWithSpan(context.Background(), span), "GET", "http://example.com", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		Annotate(hsts.Upgrade{
+			Request:     req,
+			URL:         &url.URL{Scheme: "https", Host: "example.com"},
+			Host:        "example.com",
+			Preloaded:   tt.preloaded,
+			HTTPSRecord: tt.httpsRecord,
+			Err:         tt.err,
+		})
+		if got := span.attrs[Upgraded].AsBool(); got != (tt.err == nil) {
+			t.Errorf("%v: got upgraded %v", tt.source, got)
+		}
+		if got := span.attrs[Source].AsString(); got != tt.source {
+			t.Errorf("got source %v; want %v", got, tt.source)
+		}
+		if got := span.attrs[URL].AsString(); got != "https://example.com" {
+			t.Errorf("got url %v", got)
+		}
+		if got := span.attrs[Host].AsString(); got != "example.com" {
+			t.Errorf("got host %v", got)
+		}
+		if (len(span.errs) > 0) != (tt.err != nil) {
+			t.Errorf("%v: got errors %v; want %v", tt.source, span.errs, tt.err)
+		}
+	}
+}
+
+// fakeTransport answers every request with an empty 200.
+type fakeTransport struct{}
+
+func (f *fakeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: http.NoBody, Request: req}, nil
+}
+
+func TestOption(t *testing.T) {
+	span := &recordingSpan{attrs: make(map[attribute.Key]attribute.Value)}
+	transport := hsts.New(&fakeTransport{}, Option())
+	req, err := http.NewRequestWithContext(trace.ContextWithSpan(context.Background(), span), "GET", "http://example.dev", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTemporaryRedirect {
+		t.Skip("dev is not preloaded, built with hsts_nopreload")
+	}
+	if !span.attrs[Upgraded].AsBool() || span.attrs[Source].AsString() != "preload" || span.attrs[Policy].AsString() != "preload" {
+		t.Errorf("span not annotated: %v", span.attrs)
+	}
+}
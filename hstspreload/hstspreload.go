@@ -0,0 +1,125 @@
+// Package hstspreload is a client for the hstspreload.org API, to query
+// whether a domain is preloaded, pending or removed, and submit it.
+// It is the live authority for what the embedded preload list only snapshots.
+package hstspreload
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// DefaultBaseURL is the URL of the hstspreload.org API.
+const DefaultBaseURL = "https://hstspreload.org/api/v2"
+
+// A Status is the preload status of a domain.
+type Status string
+
+// Statuses of domains.
+const (
+	Unknown                 Status = "unknown"
+	Pending                 Status = "pending"
+	Preloaded               Status = "preloaded"
+	Rejected                Status = "rejected"
+	Removed                 Status = "removed"
+	PendingRemoval          Status = "pending-removal"
+	PendingAutomatedRemoval Status = "pending-automated-removal"
+)
+
+// A DomainStatus is the preload status of a domain.
+type DomainStatus struct {
+	Name    string `json:"name"`
+	Status  Status `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// An Issue is a problem found with a domain.
+type Issue struct {
+	Code    string `json:"code"`
+	Summary string `json:"summary"`
+	Message string `json:"message"`
+}
+
+// Issues are problems found with a domain, errors prevent preloading.
+type Issues struct {
+	Errors   []Issue `json:"errors"`
+	Warnings []Issue `json:"warnings"`
+}
+
+// A Client talks to the hstspreload.org API. The zero value is ready to use.
+type Client struct {
+	HTTPClient *http.Client // http.DefaultClient if nil
+	BaseURL    string       // DefaultBaseURL if empty
+}
+
+// Status returns the preload status of a domain.
+func (c *Client) Status(ctx context.Context, domain string) (*DomainStatus, error) {
+	var s DomainStatus
+	if err := c.do(ctx, "GET", "status", domain, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// Preloadable returns the issues preventing a domain from being preloaded.
+func (c *Client) Preloadable(ctx context.Context, domain string) (*Issues, error) {
+	var i Issues
+	if err := c.do(ctx, "GET", "preloadable", domain, &i); err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+// Removable returns the issues preventing a domain from being removed.
+func (c *Client) Removable(ctx context.Context, domain string) (*Issues, error) {
+	var i Issues
+	if err := c.do(ctx, "GET", "removable", domain, &i); err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+// Submit submits a domain for preloading. It is only accepted if the
+// returned issues have no errors.
+func (c *Client) Submit(ctx context.Context, domain string) (*Issues, error) {
+	var i Issues
+	if err := c.do(ctx, "POST", "submit", domain, &i); err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+// do calls an API endpoint for a domain and decodes the JSON response into v.
+func (c *Client) do(ctx context.Context, method, endpoint, domain string, v interface{}) error {
+	base := c.BaseURL
+	if base == "" {
+		base = DefaultBaseURL
+	}
+	u := strings.TrimSuffix(base, "/") + "/" + endpoint + "?domain=" + url.QueryEscape(domain)
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return err
+	}
+	client := http.DefaultClient
+	if c.HTTPClient != nil {
+		client = c.HTTPClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("hstspreload: %v: %v: %s", endpoint, resp.Status, strings.TrimSpace(string(b)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("hstspreload: %v: %v", endpoint, err)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package hstspreload
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		domain := r.URL.Query().Get("domain")
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/status":
+			fmt.Fprintf(w, `{"name": %q, "status": "preloaded"}`, domain)
+		case r.Method == "GET" && r.URL.Path == "/preloadable":
+			fmt.Fprint(w, `{"errors": [], "warnings": [{"code": "w", "summary": "s", "message": "m"}]}`)
+		case r.Method == "POST" && r.URL.Path == "/submit":
+			fmt.Fprint(w, `{"errors": [{"code": "e", "summary": "s", "message": "m"}], "warnings": []}`)
+		default:
+			http.Error(w, "nope", http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+	c := &Client{BaseURL: server.URL + "/"}
+	ctx := context.Background()
+
+	s, err := c.Status(ctx, "a&b.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (DomainStatus{Name: "a&b.example.com", Status: Preloaded}); *s != want {
+		t.Errorf("Status() = %+v; want %+v", *s, want)
+	}
+
+	i, err := c.Preloadable(ctx, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Issues{Errors: []Issue{}, Warnings: []Issue{{"w", "s", "m"}}}); !reflect.DeepEqual(*i, want) {
+		t.Errorf("Preloadable() = %+v; want %+v", *i, want)
+	}
+
+	i, err = c.Submit(ctx, "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(i.Errors) != 1 || i.Errors[0].Code != "e" {
+		t.Errorf("Submit() = %+v; want an error", *i)
+	}
+
+	if _, err := c.Removable(ctx, "example.com"); err == nil {
+		t.Error("Removable() got no error on bad request")
+	}
+}
@@ -0,0 +1,181 @@
+// Package hstsproxy implements a forward HTTP proxy enforcing HSTS on behalf
+// of legacy clients which cannot be modified: plaintext requests to known HSTS
+// hosts are upgraded to HTTPS or blocked, and CONNECT tunnels pass through.
+package hstsproxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/StalkR/hsts"
+)
+
+// A Mode is what a Proxy does with plaintext requests to known HSTS hosts.
+type Mode int
+
+const (
+	// Upgrade sends them over HTTPS on behalf of the client. It is the default.
+	Upgrade Mode = iota
+
+	// Redirect replies 308 Permanent Redirect to HTTPS, for clients which
+	// can use HTTPS but do not enforce HSTS.
+	Redirect
+
+	// Block replies 403 Forbidden.
+	Block
+)
+
+// A Proxy is a forward HTTP proxy enforcing HSTS. The zero value is ready to use.
+type Proxy struct {
+	// Transport sends requests, noting HSTS from responses over HTTPS.
+	// If nil, a Transport from hsts.New(nil) is used.
+	Transport *hsts.Transport
+
+	// Mode is what to do with plaintext requests to known HSTS hosts.
+	Mode Mode
+
+	// Dial connects CONNECT tunnels, a net.Dialer with a 30 seconds timeout if nil.
+	Dial func(network, addr string) (net.Conn, error)
+
+	once sync.Once
+}
+
+func (p *Proxy) transport() *hsts.Transport {
+	p.once.Do(func() {
+		if p.Transport == nil {
+			p.Transport = hsts.New(nil)
+		}
+	})
+	return p.Transport
+}
+
+// ServeHTTP serves a proxy request.
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		p.tunnel(w, r)
+		return
+	}
+	if !r.URL.IsAbs() || r.URL.Host == "" {
+		http.Error(w, "hstsproxy: not a proxy request", http.StatusBadRequest)
+		return
+	}
+
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	out.Close = false
+	removeHopByHop(out.Header)
+	if r.ContentLength == 0 {
+		out.Body = nil
+	}
+	if out.URL.Scheme == "http" {
+		if _, ok := p.transport().Lookup(out.URL.Host); ok {
+			switch p.Mode {
+			case Block:
+				http.Error(w, "hstsproxy: plaintext request to an HSTS host blocked, use HTTPS", http.StatusForbidden)
+				return
+			case Redirect:
+				http.Redirect(w, r, hsts.UpgradeURL(out.URL).String(), http.StatusPermanentRedirect)
+				return
+			}
+			out.URL = hsts.UpgradeURL(out.URL)
+			out.Host = ""
+		}
+	}
+
+	resp, err := p.transport().RoundTrip(out)
+	if err != nil {
+		http.Error(w, "hstsproxy: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	removeHopByHop(resp.Header)
+	for k, v := range resp.Header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+// tunnel serves a CONNECT request by passing bytes through, without looking
+// into them: HSTS only matters to plaintext requests.
+func (p *Proxy) tunnel(w http.ResponseWriter, r *http.Request) {
+	dial := p.Dial
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: 30 * time.Second}).Dial
+	}
+	upstream, err := dial("tcp", r.Host)
+	if err != nil {
+		http.Error(w, "hstsproxy: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		upstream.Close()
+		http.Error(w, "hstsproxy: CONNECT not supported", http.StatusInternalServerError)
+		return
+	}
+	client, buf, err := hijacker.Hijack()
+	if err != nil {
+		upstream.Close()
+		http.Error(w, "hstsproxy: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, err := client.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n")); err != nil {
+		client.Close()
+		upstream.Close()
+		return
+	}
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(upstream, buf) // buffered bytes first, then the connection
+		closeWrite(upstream)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(client, upstream)
+		closeWrite(client)
+		done <- struct{}{}
+	}()
+	<-done
+	<-done
+	client.Close()
+	upstream.Close()
+}
+
+// closeWrite half-closes a connection if possible, so the other end sees EOF.
+func closeWrite(c net.Conn) {
+	if cw, ok := c.(interface{ CloseWrite() error }); ok {
+		cw.CloseWrite()
+	}
+}
+
+// hopByHop are headers only meaningful for a single connection (RFC 9110 7.6.1).
+var hopByHop = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// removeHopByHop removes hop-by-hop headers, including those listed in Connection.
+func removeHopByHop(h http.Header) {
+	for _, v := range h.Values("Connection") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				h.Del(name)
+			}
+		}
+	}
+	for _, name := range hopByHop {
+		h.Del(name)
+	}
+}
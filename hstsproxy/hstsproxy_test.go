@@ -0,0 +1,163 @@
+package hstsproxy
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/StalkR/hsts"
+)
+
+// setup returns a proxy whose upstream is a server answering with the scheme
+// and host of each request, over HTTPS with HSTS for example.com.
+// Ports 443 and 8080 are HTTPS, others plaintext.
+func setup(t *testing.T, mode Mode) *httptest.Server {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+			w.Header().Set("Strict-Transport-Security", "max-age=3600")
+		}
+		w.Header().Set("Connection", "X-Hop")
+		w.Header().Set("X-Hop", "1")
+		body, _ := ioutil.ReadAll(r.Body)
+		fmt.Fprintf(w, "%v %v://%v%v %s", r.Method, scheme, r.Host, r.URL, body)
+	})
+	tlsServer := httptest.NewTLSServer(handler)
+	t.Cleanup(tlsServer.Close)
+	plainServer := httptest.NewServer(handler)
+	t.Cleanup(plainServer.Close)
+
+	upstream := tlsServer.Client().Transport.(*http.Transport).Clone()
+	upstream.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		_, port, _ := net.SplitHostPort(addr)
+		addr = plainServer.Listener.Addr().String()
+		if port == "443" || port == "8080" {
+			addr = tlsServer.Listener.Addr().String()
+		}
+		var d net.Dialer
+		return d.DialContext(ctx, network, addr)
+	}
+	transport := hsts.New(upstream)
+	// Learn HSTS for example.com.
+	resp, err := (&http.Client{Transport: transport}).Get("https://example.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	proxy := httptest.NewServer(&Proxy{Transport: transport, Mode: mode})
+	t.Cleanup(proxy.Close)
+	return proxy
+}
+
+// client returns a client using a proxy, following no redirects.
+func client(proxy *httptest.Server) *http.Client {
+	u, _ := url.Parse(proxy.URL)
+	return &http.Client{
+		Transport: &http.Transport{Proxy: http.ProxyURL(u)},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func TestProxy(t *testing.T) {
+	for _, tt := range []struct {
+		mode     Mode
+		url      string
+		code     int
+		body     string
+		location string
+	}{
+		{Upgrade, "http://example.com/a?b", http.StatusOK, "GET https://example.com/a?b ", ""},
+		{Upgrade, "http://example.com:80/a", http.StatusOK, "GET https://example.com:443/a ", ""},
+		{Upgrade, "http://example.com:8080/a", http.StatusOK, "GET https://example.com:8080/a ", ""},
+		{Upgrade, "http://sub.example.com/", http.StatusOK, "GET http://sub.example.com/ ", ""}, // no includeSubDomains
+		{Upgrade, "http://example.org/", http.StatusOK, "GET http://example.org/ ", ""},
+		{Redirect, "http://example.com/a", http.StatusPermanentRedirect, "", "https://example.com/a"},
+		{Redirect, "http://example.com:80/a", http.StatusPermanentRedirect, "", "https://example.com:443/a"},
+		{Redirect, "http://example.com:8080/a", http.StatusPermanentRedirect, "", "https://example.com:8080/a"},
+		{Redirect, "http://example.org/", http.StatusOK, "GET http://example.org/ ", ""},
+		{Block, "http://example.com/", http.StatusForbidden, "", ""},
+	} {
+		resp, err := client(setup(t, tt.mode)).Get(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tt.code {
+			t.Errorf("mode %v %v got %v; want %v", tt.mode, tt.url, resp.Status, tt.code)
+		}
+		if tt.code == http.StatusOK && string(body) != tt.body {
+			t.Errorf("mode %v %v got body %q; want %q", tt.mode, tt.url, body, tt.body)
+		}
+		if location := resp.Header.Get("Location"); location != tt.location {
+			t.Errorf("mode %v %v got location %q; want %q", tt.mode, tt.url, location, tt.location)
+		}
+		if resp.Header.Get("X-Hop") != "" {
+			t.Errorf("mode %v %v forwarded hop-by-hop header", tt.mode, tt.url)
+		}
+	}
+}
+
+func TestProxyNotProxyRequest(t *testing.T) {
+	proxy := setup(t, Upgrade)
+	resp, err := http.Get(proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("got %v; want 400", resp.Status)
+	}
+}
+
+func TestTunnel(t *testing.T) {
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer echo.Close()
+	go func() {
+		c, err := echo.Accept()
+		if err != nil {
+			return
+		}
+		io.Copy(c, c)
+		c.Close()
+	}()
+
+	proxy := httptest.NewServer(&Proxy{})
+	defer proxy.Close()
+	c, err := net.Dial("tcp", proxy.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	fmt.Fprintf(c, "CONNECT %v HTTP/1.1\r\nHost: %[1]v\r\n\r\nping", echo.Addr())
+	r := bufio.NewReader(c)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("CONNECT got %v", resp.Status)
+	}
+	c.(*net.TCPConn).CloseWrite()
+	got, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "ping" {
+		t.Errorf("tunnel got %q; want ping", got)
+	}
+}
@@ -0,0 +1,199 @@
+// Package hstsrefresh refreshes the policies an hsts.Transport learned before
+// they expire, so that long-lived services do not regress to trusting the
+// first request again for their critical dependencies. Shortly before a
+// dynamic entry expires, a Refresher sends an HTTPS HEAD request to the host
+// through the Transport, which notes the policy sent again. A Warmer likewise
+// learns the policies of critical hosts at startup, before any traffic.
+package hstsrefresh
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/StalkR/hsts"
+)
+
+// Defaults of a Refresher.
+const (
+	defaultInterval = time.Minute
+	defaultLimit    = 10
+	defaultTimeout  = 10 * time.Second
+	retryIntervals  = 10 // a failed refresh is retried after as many intervals
+)
+
+// errNotRenewed is the error of a refresh when the host did not send its
+// policy again.
+var errNotRenewed = errors.New("hstsrefresh: policy not sent again")
+
+// A Refresher refreshes the dynamic entries of a Transport before they
+// expire. Transport must be set, other fields are optional.
+type Refresher struct {
+	Transport *hsts.Transport
+
+	// Domains restricts refreshes to entries of these domains and their
+	// subdomains, e.g. critical dependencies. All entries if empty.
+	Domains []string
+
+	// Before is how long before expiry an entry is refreshed, a tenth of
+	// its max-age if zero.
+	Before time.Duration
+
+	// Interval is how often entries are checked, a minute if zero.
+	Interval time.Duration
+
+	// Limit is how many requests are sent per Interval at most, 10 if zero,
+	// soonest expiring first.
+	Limit int
+
+	// Timeout bounds each request, 10 seconds if zero.
+	Timeout time.Duration
+
+	// Logger logs failed refreshes, if not nil.
+	Logger *slog.Logger
+
+	now func() time.Time // time.Now if nil, for tests
+
+	m         sync.Mutex           // protects attempted
+	attempted map[string]time.Time // hosts whose refresh failed, when, see retryIntervals
+}
+
+// Run refreshes entries until the context is done, and returns its error.
+func (r *Refresher) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.interval())
+	defer ticker.Stop()
+	for {
+		r.Refresh(ctx)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh refreshes the entries due now, up to Limit, and returns how many
+// it refreshed. Run calls it every Interval.
+func (r *Refresher) Refresh(ctx context.Context) int {
+	now := time.Now()
+	if r.now != nil {
+		now = r.now()
+	}
+	limit := r.Limit
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+	refreshed := 0
+	for _, e := range r.due(now, limit) {
+		if ctx.Err() != nil {
+			break
+		}
+		err := r.refresh(ctx, e.Host)
+		if err == nil {
+			if renewed, ok := r.Transport.State().Lookup(e.Host); ok && renewed.Host == e.Host && renewed.Received.After(e.Received) {
+				refreshed++
+				continue
+			}
+			err = errNotRenewed // it expires as planned
+		}
+		r.m.Lock()
+		r.attempted[e.Host] = now
+		r.m.Unlock()
+		if r.Logger != nil {
+			r.Logger.Info("hstsrefresh: refresh failed", "host", e.Host, "error", err)
+		}
+	}
+	return refreshed
+}
+
+// due returns the entries to refresh now, soonest expiring first.
+func (r *Refresher) due(now time.Time, limit int) []hsts.Entry {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if r.attempted == nil {
+		r.attempted = make(map[string]time.Time)
+	}
+	retry := retryIntervals * r.interval()
+	for host, at := range r.attempted {
+		if now.Sub(at) >= retry {
+			delete(r.attempted, host)
+		}
+	}
+	var due []hsts.Entry
+	for _, e := range r.Transport.State().Entries() {
+		expires := e.Expires()
+		if expires.IsZero() || !r.allowed(e.Host) {
+			continue
+		}
+		if _, ok := r.attempted[e.Host]; ok {
+			continue
+		}
+		before := r.Before
+		if before <= 0 {
+			before = e.MaxAge / 10
+		}
+		if expires.Sub(now) <= before {
+			due = append(due, e)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].Expires().Before(due[j].Expires()) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return due
+}
+
+// allowed tells whether a host is in Domains, or Domains is empty.
+func (r *Refresher) allowed(host string) bool {
+	if len(r.Domains) == 0 {
+		return true
+	}
+	for _, d := range r.Domains {
+		d = strings.TrimSuffix(strings.ToLower(d), ".")
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Refresher) refresh(ctx context.Context, host string) error {
+	return head(ctx, r.Transport, host, r.Timeout)
+}
+
+// head sends a HEAD request to a host, without following redirects, for the
+// Transport to note the policy it sends.
+func head(ctx context.Context, transport *hsts.Transport, host string, timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "HEAD", "https://"+host+"/", nil)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (r *Refresher) interval() time.Duration {
+	if r.Interval <= 0 {
+		return defaultInterval
+	}
+	return r.Interval
+}
@@ -0,0 +1,87 @@
+package hstsrefresh
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/StalkR/hsts"
+	"github.com/StalkR/hsts/hststest"
+)
+
+func TestRefresh(t *testing.T) {
+	clock := hststest.NewClock(time.Now())
+	rt := hststest.Advertising("max-age=1000")
+	transport := hsts.New(rt, hsts.WithClock(clock.Now))
+	for _, host := range []string{"a.example.com", "b.example.com", "other.com", "c.example.com"} {
+		resp, err := (&http.Client{Transport: transport}).Get("https://" + host)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		clock.Advance(10 * time.Second)
+	}
+	r := &Refresher{Transport: transport, Domains: []string{"Example.COM"}, Limit: 2, now: clock.Now}
+	refreshed := func() []string {
+		before := len(rt.URLs())
+		n := r.Refresh(context.Background())
+		var hosts []string
+		for _, u := range rt.URLs()[before:] {
+			hosts = append(hosts, u.Host)
+		}
+		if n != len(hosts) && rt.Header != "" {
+			t.Errorf("Refresh() = %v; want %v", n, len(hosts))
+		}
+		return hosts
+	}
+
+	if hosts := refreshed(); len(hosts) != 0 {
+		t.Errorf("refreshed %v early", hosts)
+	}
+	// A tenth of max-age before expiry of the first ones, soonest first up to Limit.
+	clock.Advance(895 * time.Second)
+	if got, want := refreshed(), []string{"a.example.com", "b.example.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("refreshed %v; want %v", got, want)
+	}
+	if got, want := refreshed(), []string{"c.example.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("then refreshed %v; want %v", got, want)
+	}
+	if e, ok := transport.Lookup("a.example.com"); !ok || !e.Expires().After(clock.Now().Add(900*time.Second)) {
+		t.Errorf("a.example.com expires %v; want renewed", e.Expires())
+	}
+
+	// Hosts no longer sending the policy are not retried until later.
+	rt.Header = ""
+	clock.Advance(900 * time.Second)
+	if got, want := refreshed(), []string{"a.example.com", "b.example.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("refreshed %v; want %v", got, want)
+	}
+	if got, want := refreshed(), []string{"c.example.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("refreshed %v; want %v", got, want)
+	}
+	if hosts := refreshed(); len(hosts) != 0 {
+		t.Errorf("retried %v right away", hosts)
+	}
+}
+
+func TestRun(t *testing.T) {
+	rt := hststest.Advertising("max-age=1000")
+	transport := hsts.New(rt)
+	resp, err := (&http.Client{Transport: transport}).Get("https://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	// Everything is due.
+	r := &Refresher{Transport: transport, Before: time.Hour, Interval: time.Millisecond}
+	if err := r.Run(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Run() = %v; want %v", err, context.DeadlineExceeded)
+	}
+	if got := rt.Last(); got.Host != "example.com" || got.Scheme != "https" {
+		t.Errorf("last request %v; want a refresh of example.com", got)
+	}
+}
@@ -0,0 +1,124 @@
+package hstsrefresh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/StalkR/hsts"
+)
+
+// Defaults of a Warmer.
+const (
+	defaultConcurrency = 4
+	defaultAttempts    = 3
+	defaultBackoff     = time.Second
+)
+
+// errNotSent is the error of a warm-up when the host sent no policy.
+var errNotSent = errors.New("hstsrefresh: no policy sent")
+
+// A Warmer learns the policies of hosts before any traffic flows to them,
+// e.g. the critical dependencies of a service at startup, so that their first
+// requests are not sent in plaintext, without adding permanent entries (see
+// hsts.Transport.AddHosts). It sends an HTTPS HEAD request to each host
+// through the Transport, which notes the policy sent. Transport and Hosts
+// must be set, other fields are optional.
+type Warmer struct {
+	Transport *hsts.Transport
+	Hosts     []string
+
+	// Concurrency is how many requests are sent at once at most, 4 if zero.
+	Concurrency int
+
+	// Attempts is how many requests are sent at most to a host failing to
+	// answer, 3 if zero.
+	Attempts int
+
+	// Backoff is how long to wait before sending a request again, a second
+	// if zero, doubled after each attempt.
+	Backoff time.Duration
+
+	// Timeout bounds each request, 10 seconds if zero.
+	Timeout time.Duration
+
+	// Logger logs failed warm-ups, if not nil.
+	Logger *slog.Logger
+}
+
+// Run learns the policies of Hosts, and returns once done, e.g. before
+// serving or in the background with go: nil if they all have a policy,
+// otherwise the errors of the others, joined in the order of Hosts. Hosts
+// already having a policy, preloaded or learned, are skipped. Hosts answering
+// without a policy are not sent a request again, nor is any once the context
+// is done.
+func (w *Warmer) Run(ctx context.Context) error {
+	concurrency := w.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultConcurrency
+	}
+	errs := make([]error, len(w.Hosts))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for n := 0; n < concurrency; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				host := strings.TrimSuffix(strings.ToLower(w.Hosts[i]), ".")
+				if err := w.warm(ctx, host); err != nil {
+					errs[i] = fmt.Errorf("hstsrefresh: warm-up of %v: %w", host, err)
+					if w.Logger != nil {
+						w.Logger.Info("hstsrefresh: warm-up failed", "host", host, "error", err)
+					}
+				}
+			}
+		}()
+	}
+	for i := range w.Hosts {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// warm learns the policy of a host, sending requests again with backoff
+// until it answers.
+func (w *Warmer) warm(ctx context.Context, host string) error {
+	if _, ok := w.Transport.Lookup(host); ok {
+		return nil
+	}
+	attempts := w.Attempts
+	if attempts <= 0 {
+		attempts = defaultAttempts
+	}
+	backoff := w.Backoff
+	if backoff <= 0 {
+		backoff = defaultBackoff
+	}
+	for attempt := 1; ; attempt++ {
+		err := head(ctx, w.Transport, host, w.Timeout)
+		if err == nil {
+			if _, ok := w.Transport.Lookup(host); !ok {
+				return errNotSent
+			}
+			return nil
+		}
+		if attempt >= attempts || ctx.Err() != nil {
+			return err
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
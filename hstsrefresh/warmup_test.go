@@ -0,0 +1,94 @@
+package hstsrefresh
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/StalkR/hsts"
+	"github.com/StalkR/hsts/hststest"
+)
+
+// flakyTransport fails the first requests to hosts, then answers like
+// hststest.Advertising, or without a policy for hosts starting with plain.
+type flakyTransport struct {
+	failures int // per host
+
+	m        sync.Mutex // protects below
+	requests map[string]int
+	active   int
+	peak     int // most requests at once
+}
+
+func (f *flakyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	f.m.Lock()
+	f.requests[req.URL.Host]++
+	n := f.requests[req.URL.Host]
+	f.active++
+	if f.active > f.peak {
+		f.peak = f.active
+	}
+	f.m.Unlock()
+	time.Sleep(time.Millisecond)
+	f.m.Lock()
+	f.active--
+	f.m.Unlock()
+	if n <= f.failures {
+		return nil, errors.New("connection refused")
+	}
+	if strings.HasPrefix(req.URL.Host, "plain") {
+		return hststest.Plain().RoundTrip(req)
+	}
+	return hststest.Advertising("max-age=3600").RoundTrip(req)
+}
+
+func TestWarmer(t *testing.T) {
+	flaky := &flakyTransport{failures: 2, requests: make(map[string]int)}
+	transport := hsts.New(flaky)
+	hosts := []string{"a.example.com", "B.example.com.", "c.example.com", "d.example.com", "plain.example.com"}
+	w := &Warmer{Transport: transport, Hosts: hosts, Concurrency: 2, Backoff: time.Millisecond}
+	err := w.Run(context.Background())
+	if err == nil || !errors.Is(err, errNotSent) || !strings.Contains(err.Error(), "plain.example.com") || strings.Count(err.Error(), "\n") != 0 {
+		t.Errorf("Run() = %v; want only plain.example.com without a policy", err)
+	}
+	for _, host := range []string{"a.example.com", "b.example.com", "c.example.com", "d.example.com"} {
+		if _, ok := transport.Lookup(host); !ok {
+			t.Errorf("%v not learned", host)
+		}
+		if n := flaky.requests[host]; n != 3 {
+			t.Errorf("%v got %d requests; want 3", host, n)
+		}
+	}
+	if flaky.peak > 2 {
+		t.Errorf("got %d requests at once; want at most 2", flaky.peak)
+	}
+
+	// Hosts with a policy are skipped, those failing give up after Attempts.
+	flaky.requests = make(map[string]int)
+	flaky.failures = 10
+	w.Hosts = []string{"a.example.com", "e.example.com"}
+	w.Attempts = 2
+	if err := w.Run(context.Background()); err == nil || !strings.Contains(err.Error(), "e.example.com") {
+		t.Errorf("Run() = %v; want e.example.com failing", err)
+	}
+	if flaky.requests["a.example.com"] != 0 || flaky.requests["e.example.com"] != 2 {
+		t.Errorf("got requests %v; want none to a.example.com and 2 to e.example.com", flaky.requests)
+	}
+
+	// No retries once the context is done.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	flaky.requests = make(map[string]int)
+	w.Hosts = []string{"f.example.com"}
+	w.Attempts = 0
+	if err := w.Run(ctx); err == nil {
+		t.Error("Run() with a done context = nil; want error")
+	}
+	if n := flaky.requests["f.example.com"]; n > 1 {
+		t.Errorf("got %d requests with a done context; want at most 1", n)
+	}
+}
@@ -0,0 +1,237 @@
+// Package hstsreport posts JSON reports of what hsts.Transport does for HSTS
+// hosts (upgrades, blocked downgrades and TLS failures) to an endpoint, like
+// report-uri for CSP, so that security teams see it across services.
+package hstsreport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/StalkR/hsts"
+)
+
+// An Action is what was done for a request to an HSTS host.
+type Action string
+
+// Actions reported.
+const (
+	Upgraded   Action = "upgraded"    // sent over HTTPS instead of HTTP
+	Blocked    Action = "blocked"     // refused instead of sent over HTTP
+	TLSFailure Action = "tls-failure" // refused for its TLS connection
+)
+
+// A Report is what is posted as JSON for each action.
+type Report struct {
+	Host   string    `json:"host"` // known HSTS host whose policy applies
+	URL    string    `json:"url"`  // as requested, without credentials, query and fragment
+	Action Action    `json:"action"`
+	Source string    `json:"source,omitempty"` // of the policy: preload, dynamic or https-record
+	Error  string    `json:"error,omitempty"`  // why it was blocked or failed
+	Time   time.Time `json:"time"`
+}
+
+// defaultQueueSize is the default number of reports waiting to be posted.
+const defaultQueueSize = 100
+
+// A Reporter posts reports to an endpoint in the background, one at a time
+// and in order, so that requests are not slowed down. Use Upgrade as the
+// upgrade hook of the Transport (see hsts.WithUpgradeHook) and wrap it with
+// Wrap to also report failures. The zero value is not usable, Endpoint must
+// be set; other fields are optional. It is safe for concurrent use.
+type Reporter struct {
+	// Endpoint is the URL reports are posted to.
+	Endpoint string
+
+	// Client posts reports, http.DefaultClient if nil. It must not report
+	// to the same Reporter, which would report about its own reports.
+	Client *http.Client
+
+	// Timeout bounds each post, 10 seconds if zero.
+	Timeout time.Duration
+
+	// QueueSize is the number of reports waiting to be posted, 100 if zero.
+	// Reports are dropped when it is full.
+	QueueSize int
+
+	once    sync.Once
+	m       sync.RWMutex // protects closed, and queue from being closed while sent to
+	closed  bool
+	queue   chan Report
+	done    chan struct{}
+	dropped int64 // updated atomically
+	failed  int64 // updated atomically
+}
+
+func (r *Reporter) init() {
+	size := r.QueueSize
+	if size <= 0 {
+		size = defaultQueueSize
+	}
+	r.queue = make(chan Report, size)
+	r.done = make(chan struct{})
+	go r.run()
+}
+
+// Report queues a report to be posted. The time is set if zero.
+func (r *Reporter) Report(report Report) {
+	r.once.Do(r.init)
+	if report.Time.IsZero() {
+		report.Time = time.Now().UTC()
+	}
+	r.m.RLock()
+	defer r.m.RUnlock()
+	if r.closed {
+		atomic.AddInt64(&r.dropped, 1)
+		return
+	}
+	select {
+	case r.queue <- report:
+	default:
+		atomic.AddInt64(&r.dropped, 1)
+	}
+}
+
+// Upgrade reports an upgrade, or a blocked request if it failed.
+// It is meant as the upgrade hook of a Transport, see hsts.WithUpgradeHook.
+func (r *Reporter) Upgrade(u hsts.Upgrade) {
+	report := Report{
+		Host:   u.Host,
+		URL:    redact(u.Request.URL),
+		Action: Upgraded,
+		Source: "dynamic",
+	}
+	switch {
+	case u.Preloaded:
+		report.Source = "preload"
+	case u.HTTPSRecord:
+		report.Source = "https-record"
+	}
+	if u.Err != nil {
+		report.Action = Blocked
+		report.Error = u.Err.Error()
+	}
+	r.Report(report)
+}
+
+// Wrap wraps a transport, usually an hsts.Transport, to report requests
+// failing because of HSTS: connections refused by TLS requirements
+// (*hsts.TLSError and *hsts.SCTError) and plaintext dials
+// refused (*hsts.PlaintextError, see hsts.DialContext).
+func (r *Reporter) Wrap(transport http.RoundTripper) http.RoundTripper {
+	return &reportingTransport{r: r, wrap: transport}
+}
+
+type reportingTransport struct {
+	r    *Reporter
+	wrap http.RoundTripper
+}
+
+func (t *reportingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.wrap.RoundTrip(req)
+	if err != nil {
+		if report, ok := failure(err); ok {
+			report.URL = redact(req.URL)
+			t.r.Report(report)
+		}
+	}
+	return resp, err
+}
+
+// Unwrap returns the wrapped transport, so that hsts.New finds it.
+func (t *reportingTransport) Unwrap() http.RoundTripper {
+	return t.wrap
+}
+
+// redact returns a URL as reported: query strings and credentials may be
+// secrets, and are posted outside.
+func redact(u *url.URL) string {
+	r := url.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path, RawPath: u.RawPath}
+	return r.String()
+}
+
+// failure returns the report of an error caused by HSTS, if it is one.
+func failure(err error) (Report, bool) {
+	var tlsErr *hsts.TLSError
+	var sctErr *hsts.SCTError
+	var plaintextErr *hsts.PlaintextError
+	report := Report{Action: TLSFailure, Error: err.Error()}
+	switch {
+	case errors.As(err, &tlsErr):
+		report.Host = tlsErr.Host
+	case errors.As(err, &sctErr):
+		report.Host = sctErr.Host
+	case errors.As(err, &plaintextErr):
+		report.Host = plaintextErr.Host
+		report.Action = Blocked
+	default:
+		return Report{}, false
+	}
+	return report, true
+}
+
+// Close stops accepting reports and waits for those queued to be posted.
+func (r *Reporter) Close() {
+	r.once.Do(r.init)
+	r.m.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.queue)
+	}
+	r.m.Unlock()
+	<-r.done
+}
+
+// Dropped returns the number of reports dropped because the queue was full
+// or the Reporter closed.
+func (r *Reporter) Dropped() int64 { return atomic.LoadInt64(&r.dropped) }
+
+// Failed returns the number of reports which failed to be posted.
+func (r *Reporter) Failed() int64 { return atomic.LoadInt64(&r.failed) }
+
+func (r *Reporter) run() {
+	defer close(r.done)
+	for report := range r.queue {
+		if err := r.post(report); err != nil {
+			atomic.AddInt64(&r.failed, 1)
+		}
+	}
+}
+
+func (r *Reporter) post(report Report) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	timeout := r.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", r.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := http.DefaultClient
+	if r.Client != nil {
+		client = r.Client
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("hstsreport: %v: %v", r.Endpoint, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+// Package hstssync synchronizes what hsts.Transports learn across processes
+// through a message bus, so that a fleet (e.g. of crawlers) converges on the
+// same HSTS knowledge within seconds. Learned and removed entries are
+// published as JSON, and those of others applied with hsts.Transport.Apply.
+//
+// A Bus is any publish/subscribe system. Redis is provided, and others are
+// easily adapted, for instance NATS:
+//
+//	type natsBus struct {
+//		conn    *nats.Conn
+//		subject string
+//	}
+//
+//	func (b natsBus) Publish(ctx context.Context, msg []byte) error {
+//		return b.conn.Publish(b.subject, msg)
+//	}
+//
+//	func (b natsBus) Subscribe(ctx context.Context, f func([]byte)) error {
+//		sub, err := b.conn.Subscribe(b.subject, func(m *nats.Msg) { f(m.Data) })
+//		if err != nil {
+//			return err
+//		}
+//		defer sub.Unsubscribe()
+//		<-ctx.Done()
+//		return ctx.Err()
+//	}
+package hstssync
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/StalkR/hsts"
+)
+
+// A Bus publishes messages to all its subscribers, possibly including the
+// publisher itself.
+type Bus interface {
+	// Publish publishes a message.
+	Publish(ctx context.Context, msg []byte) error
+
+	// Subscribe calls f for each message published until the context is
+	// done, or it fails. It returns why it stopped.
+	Subscribe(ctx context.Context, f func(msg []byte)) error
+}
+
+// A Message is a change to the entries of a Transport, as published.
+type Message struct {
+	Origin            string            `json:"origin"` // ID of the publishing Syncer
+	Host              string            `json:"host"`
+	Removed           bool              `json:"removed,omitempty"`
+	MaxAge            int64             `json:"max_age,omitempty"` // in seconds
+	IncludeSubDomains bool              `json:"include_subdomains,omitempty"`
+	Preload           bool              `json:"preload,omitempty"`
+	LongLived         bool              `json:"long_lived,omitempty"`
+	Extensions        map[string]string `json:"extensions,omitempty"`
+	Received          time.Time         `json:"received,omitempty"` // when learned or removed
+	Source            hsts.Source       `json:"source,omitempty"`   // where the origin learned it
+	URL               string            `json:"url,omitempty"`
+	Addr              string            `json:"addr,omitempty"`
+}
+
+func newMessage(origin string, c hsts.Change) Message {
+	if c.Removed {
+		return Message{Origin: origin, Host: c.Host, Removed: true, Received: c.Entry.Received}
+	}
+	return Message{
+		Origin:            origin,
+		Host:              c.Host,
+		MaxAge:            int64(c.Entry.MaxAge / time.Second),
+		IncludeSubDomains: c.Entry.IncludeSubDomains,
+		Preload:           c.Entry.Preload,
+		LongLived:         c.Entry.LongLived,
+		Extensions:        c.Entry.Extensions,
+		Received:          c.Entry.Received,
+		Source:            c.Entry.Origin.Source,
+		URL:               c.Entry.Origin.URL,
+		Addr:              c.Entry.Origin.Addr,
+	}
+}
+
+func (m Message) change() hsts.Change {
+	if m.Removed {
+		return hsts.Change{Host: m.Host, Entry: hsts.Entry{Host: m.Host, Received: m.Received}, Removed: true}
+	}
+	return hsts.Change{Host: m.Host, Entry: hsts.Entry{
+		Host:      m.Host,
+		LongLived: m.LongLived,
+		Received:  m.Received,
+		Origin:    hsts.Origin{Source: m.Source, URL: m.URL, Addr: m.Addr},
+		Policy: hsts.Policy{
+			MaxAge:            time.Duration(m.MaxAge) * time.Second,
+			IncludeSubDomains: m.IncludeSubDomains,
+			Preload:           m.Preload,
+			Extensions:        m.Extensions,
+		},
+	}}
+}
+
+// defaultQueueSize is the default number of changes waiting to be published.
+const defaultQueueSize = 1024
+
+// A Syncer publishes the changes of a Transport to a Bus, and applies those
+// published by others. Transport and Bus must be set, other fields are optional.
+type Syncer struct {
+	Transport *hsts.Transport
+	Bus       Bus
+
+	// ID identifies the Syncer in messages, to ignore its own. Random if empty.
+	ID string
+
+	// QueueSize is the number of changes waiting to be published, 1024 if
+	// zero. Changes are dropped when it is full.
+	QueueSize int
+
+	// Logger logs failures to publish and invalid messages, if not nil.
+	Logger *slog.Logger
+
+	m        sync.Mutex
+	applying map[changeKey]int // changes being applied, not to publish back
+}
+
+// Run synchronizes until the context is done or subscribing fails, and
+// returns why it stopped. Changes made while it is not running are not
+// published.
+func (s *Syncer) Run(ctx context.Context) error {
+	if s.ID == "" {
+		var b [8]byte
+		rand.Read(b[:])
+		s.ID = hex.EncodeToString(b[:])
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	size := s.QueueSize
+	if size <= 0 {
+		size = defaultQueueSize
+	}
+	queue := make(chan hsts.Change, size)
+	unsubscribe := s.Transport.State().Subscribe(func(c hsts.Change) {
+		if c.Evicted || s.applied(c) {
+			return // evictions are local, others may still have room
+		}
+		select {
+		case queue <- c:
+		default:
+			if s.Logger != nil {
+				s.Logger.Info("hstssync: queue full, change dropped", "host", c.Host)
+			}
+		}
+	})
+	defer unsubscribe()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case c := <-queue:
+				s.publish(ctx, c)
+			}
+		}
+	}()
+	return s.Bus.Subscribe(ctx, s.receive)
+}
+
+func (s *Syncer) publish(ctx context.Context, c hsts.Change) {
+	msg, err := json.Marshal(newMessage(s.ID, c))
+	if err == nil {
+		err = s.Bus.Publish(ctx, msg)
+	}
+	if err != nil && s.Logger != nil {
+		s.Logger.Info("hstssync: publish failed", "host", c.Host, "error", err)
+	}
+}
+
+// receive applies a message published by another Syncer.
+func (s *Syncer) receive(msg []byte) {
+	var m Message
+	if err := json.Unmarshal(msg, &m); err != nil || m.Host == "" {
+		if s.Logger != nil {
+			s.Logger.Info("hstssync: invalid message", "message", string(msg), "error", err)
+		}
+		return
+	}
+	if m.Origin == s.ID {
+		return
+	}
+	c := m.change()
+	key := keyOf(c)
+	s.m.Lock()
+	if s.applying == nil {
+		s.applying = make(map[changeKey]int)
+	}
+	s.applying[key]++
+	s.m.Unlock()
+	s.Transport.Apply(c)
+	s.m.Lock()
+	if s.applying[key]--; s.applying[key] == 0 {
+		delete(s.applying, key)
+	}
+	s.m.Unlock()
+}
+
+// applied tells whether a change is one being applied, which is not
+// published back.
+func (s *Syncer) applied(c hsts.Change) bool {
+	s.m.Lock()
+	defer s.m.Unlock()
+	_, ok := s.applying[keyOf(c)]
+	return ok
+}
+
+// A changeKey identifies a change, without its extensions.
+type changeKey struct {
+	host     string
+	removed  bool
+	received int64
+	maxAge   time.Duration
+}
+
+func keyOf(c hsts.Change) changeKey {
+	k := changeKey{host: strings.TrimSuffix(strings.ToLower(c.Host), "."), removed: c.Removed}
+	if !c.Removed {
+		k.received, k.maxAge = c.Entry.Received.Unix(), c.Entry.MaxAge
+	}
+	return k
+}
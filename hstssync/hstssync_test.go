@@ -0,0 +1,307 @@
+package hstssync
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/StalkR/hsts"
+	"github.com/StalkR/hsts/hststest"
+)
+
+// memBus is an in-memory Bus, delivering messages to all subscribers.
+type memBus struct {
+	m         sync.Mutex
+	subs      map[int]func([]byte)
+	next      int
+	published []Message
+}
+
+func (b *memBus) Publish(ctx context.Context, msg []byte) error {
+	var m Message
+	json.Unmarshal(msg, &m)
+	b.m.Lock()
+	b.published = append(b.published, m)
+	subs := make([]func([]byte), 0, len(b.subs))
+	for _, f := range b.subs {
+		subs = append(subs, f)
+	}
+	b.m.Unlock()
+	for _, f := range subs {
+		f(msg)
+	}
+	return nil
+}
+
+func (b *memBus) Subscribe(ctx context.Context, f func([]byte)) error {
+	b.m.Lock()
+	if b.subs == nil {
+		b.subs = make(map[int]func([]byte))
+	}
+	id := b.next
+	b.next++
+	b.subs[id] = f
+	b.m.Unlock()
+	<-ctx.Done()
+	b.m.Lock()
+	delete(b.subs, id)
+	b.m.Unlock()
+	return ctx.Err()
+}
+
+func (b *memBus) subscribers() int {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return len(b.subs)
+}
+
+func (b *memBus) messages() []Message {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return append([]Message(nil), b.published...)
+}
+
+// eventually waits up to a second for f to be true.
+func eventually(f func() bool) bool {
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if f() {
+			return true
+		}
+	}
+	return f()
+}
+
+func TestSyncer(t *testing.T) {
+	bus := &memBus{}
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+
+	a := hsts.New(hststest.Advertising("max-age=3600; includeSubDomains"))
+	b := hsts.New(hststest.Deleting())
+	for i, transport := range []*hsts.Transport{a, b} {
+		s := &Syncer{Transport: transport, Bus: bus, ID: string(rune('a' + i))}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.Run(ctx)
+		}()
+	}
+	if !eventually(func() bool { return bus.subscribers() == 2 }) {
+		t.Fatal("Syncers did not subscribe")
+	}
+
+	resp, err := (&http.Client{Transport: a}).Get("https://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if !eventually(func() bool { _, ok := b.Lookup("sub.example.com"); return ok }) {
+		t.Fatal("b did not learn example.com from a")
+	}
+	want, _ := a.Lookup("example.com")
+	if got, _ := b.Lookup("example.com"); got.MaxAge != want.MaxAge || !got.IncludeSubDomains || !got.Received.Equal(want.Received) || got.Origin != want.Origin {
+		t.Errorf("b learned %+v; want %+v", got, want)
+	}
+
+	// b deletes the policy, which a forgets.
+	resp, err = (&http.Client{Transport: b}).Get("https://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if !eventually(func() bool { _, ok := a.Lookup("example.com"); return !ok }) {
+		t.Fatal("a did not forget example.com from b")
+	}
+
+	time.Sleep(10 * time.Millisecond) // any echo would be published by now
+	var origins []string
+	for _, m := range bus.messages() {
+		origins = append(origins, m.Origin)
+		if m.Removed && m.Received.IsZero() {
+			t.Errorf("published removal %+v; want when removed", m)
+		}
+	}
+	if want := []string{"a", "b"}; !reflect.DeepEqual(origins, want) {
+		t.Errorf("published by %v; want %v, without echoes", origins, want)
+	}
+}
+
+func TestSyncerIgnoresOwnMessages(t *testing.T) {
+	transport := hsts.New(nil)
+	s := &Syncer{Transport: transport, Bus: &memBus{}, ID: "me"}
+	msg := `{"origin":"me","host":"example.com","max_age":3600,"received":"` + time.Now().Format(time.RFC3339) + `"}`
+	s.receive([]byte(msg))
+	if _, ok := transport.Lookup("example.com"); ok {
+		t.Error("applied its own message")
+	}
+	s.receive([]byte(strings.Replace(msg, `"me"`, `"other"`, 1)))
+	if _, ok := transport.Lookup("example.com"); !ok {
+		t.Error("did not apply a message of another")
+	}
+	s.receive([]byte("invalid"))
+}
+
+// fakeRedis serves a Redis pub/sub subset: AUTH, PUBLISH and SUBSCRIBE.
+func fakeRedis(t *testing.T, password string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	var m sync.Mutex
+	var subs []net.Conn
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+			go func() {
+				r := bufio.NewReader(conn)
+				authed := password == ""
+				for {
+					v, err := readReply(r)
+					if err != nil {
+						return
+					}
+					args, _ := v.([]interface{})
+					if len(args) == 0 {
+						return
+					}
+					switch cmd := args[0].(string); {
+					case cmd == "AUTH" && len(args) == 2:
+						if args[1] != password {
+							conn.Write([]byte("-WRONGPASS invalid password\r\n"))
+							continue
+						}
+						authed = true
+						conn.Write([]byte("+OK\r\n"))
+					case !authed:
+						conn.Write([]byte("-NOAUTH Authentication required.\r\n"))
+					case cmd == "SUBSCRIBE" && len(args) == 2:
+						writeCommand(conn, "subscribe", args[1].(string), "1")
+						m.Lock()
+						subs = append(subs, conn)
+						m.Unlock()
+					case cmd == "PUBLISH" && len(args) == 3:
+						m.Lock()
+						for _, sub := range subs {
+							writeCommand(sub, "message", args[1].(string), args[2].(string))
+						}
+						n := len(subs)
+						m.Unlock()
+						conn.Write([]byte(":" + string(rune('0'+n)) + "\r\n"))
+					default:
+						conn.Write([]byte("-ERR unknown command\r\n"))
+					}
+				}
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestRedis(t *testing.T) {
+	addr := fakeRedis(t, "secret")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := (&Redis{Addr: addr, Password: "wrong", Channel: "hsts"}).Publish(ctx, []byte("x")); err == nil || !strings.Contains(err.Error(), "WRONGPASS") {
+		t.Errorf("Publish with a wrong password = %v; want WRONGPASS", err)
+	}
+
+	bus := &Redis{Addr: addr, Password: "secret", Channel: "hsts"}
+	received := make(chan string, 10)
+	subCtx, stop := context.WithCancel(ctx)
+	done := make(chan error)
+	go func() {
+		done <- bus.Subscribe(subCtx, func(msg []byte) { received <- string(msg) })
+	}()
+
+	// Publish until the subscription is in place.
+	for i := 0; ; i++ {
+		if err := bus.Publish(ctx, []byte("hello\r\nworld")); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case msg := <-received:
+			if msg != "hello\r\nworld" {
+				t.Errorf("received %q; want %q", msg, "hello\r\nworld")
+			}
+		case <-time.After(10 * time.Millisecond):
+			continue
+		}
+		break
+	}
+
+	stop()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Subscribe() = %v; want %v", err, context.Canceled)
+	}
+}
+
+func TestReadReply(t *testing.T) {
+	for _, tt := range []struct {
+		reply string
+		want  interface{}
+		err   bool
+	}{
+		{"+OK\r\n", "OK", false},
+		{"-ERR bad\r\n", nil, true},
+		{":42\r\n", int64(42), false},
+		{"$5\r\nhello\r\n", "hello", false},
+		{"$-1\r\n", nil, false},
+		{"*2\r\n$1\r\na\r\n:1\r\n", []interface{}{"a", int64(1)}, false},
+		{"*-1\r\n", nil, false},
+		{"$x\r\n", nil, true},
+		{"?\r\n", nil, true},
+		{"+OK\n", nil, true},
+	} {
+		got, err := readReply(bufio.NewReader(strings.NewReader(tt.reply)))
+		if (err != nil) != tt.err || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("readReply(%q) = %#v, %v; want %#v, error %v", tt.reply, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestSyncerEvictions(t *testing.T) {
+	bus := &memBus{}
+	ctx, cancel := context.WithCancel(context.Background())
+	transport := hsts.New(hststest.Advertising("max-age=3600"), hsts.WithMaxEntries(1))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		(&Syncer{Transport: transport, Bus: bus}).Run(ctx)
+	}()
+	defer func() { cancel(); <-done }()
+	if !eventually(func() bool { return bus.subscribers() == 1 }) {
+		t.Fatal("Syncer did not subscribe")
+	}
+
+	for _, u := range []string{"https://example.com", "https://example.org"} {
+		resp, err := (&http.Client{Transport: transport}).Get(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if !eventually(func() bool { return len(bus.messages()) == 2 }) {
+		t.Fatalf("published %+v; want 2 messages", bus.messages())
+	}
+	time.Sleep(10 * time.Millisecond) // any removal would be published by now
+	for _, m := range bus.messages() {
+		if m.Removed {
+			t.Errorf("published eviction of %v", m.Host)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package hstssync
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Redis is a Bus over a Redis pub/sub channel. It speaks the Redis protocol
+// (RESP) itself, with a connection to publish and one per subscription.
+type Redis struct {
+	Addr     string // host:port
+	Password string // sent with AUTH if not empty
+	Channel  string
+
+	// Dial connects to Redis, a net.Dialer if nil.
+	Dial func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	m    sync.Mutex // protects conn and r, used to publish
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// A redisError is an error replied by Redis.
+type redisError string
+
+func (e redisError) Error() string {
+	return "hstssync: redis: " + string(e)
+}
+
+// Publish publishes a message on the channel.
+func (b *Redis) Publish(ctx context.Context, msg []byte) error {
+	b.m.Lock()
+	defer b.m.Unlock()
+	if b.conn == nil {
+		conn, r, err := b.connect(ctx)
+		if err != nil {
+			return err
+		}
+		b.conn, b.r = conn, r
+	}
+	_, err := b.do(ctx, b.conn, b.r, "PUBLISH", b.Channel, string(msg))
+	var replied redisError
+	if err != nil && !errors.As(err, &replied) {
+		b.conn.Close() // broken, reconnect next time
+		b.conn, b.r = nil, nil
+	}
+	return err
+}
+
+// Subscribe subscribes to the channel and calls f for each message.
+func (b *Redis) Subscribe(ctx context.Context, f func(msg []byte)) error {
+	conn, r, err := b.connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	if err := writeCommand(conn, "SUBSCRIBE", b.Channel); err != nil {
+		return err
+	}
+	for {
+		v, err := readReply(r)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		// Messages are pushed as ["message", channel, payload].
+		if a, ok := v.([]interface{}); ok && len(a) == 3 && a[0] == "message" {
+			if payload, ok := a[2].(string); ok {
+				f([]byte(payload))
+			}
+		}
+	}
+}
+
+func (b *Redis) connect(ctx context.Context) (net.Conn, *bufio.Reader, error) {
+	dial := b.Dial
+	if dial == nil {
+		var d net.Dialer
+		dial = d.DialContext
+	}
+	conn, err := dial(ctx, "tcp", b.Addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	r := bufio.NewReader(conn)
+	if b.Password != "" {
+		if _, err := b.do(ctx, conn, r, "AUTH", b.Password); err != nil {
+			conn.Close()
+			return nil, nil, err
+		}
+	}
+	return conn, r, nil
+}
+
+// do sends a command and reads its reply, within the deadline of the context.
+func (b *Redis) do(ctx context.Context, conn net.Conn, r *bufio.Reader, args ...string) (interface{}, error) {
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+	defer conn.SetDeadline(time.Time{})
+	if err := writeCommand(conn, args...); err != nil {
+		return nil, err
+	}
+	return readReply(r)
+}
+
+// writeCommand writes a command as an array of bulk strings.
+func writeCommand(w io.Writer, args ...string) error {
+	b := []byte("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		b = append(b, '$')
+		b = strconv.AppendInt(b, int64(len(arg)), 10)
+		b = append(b, "\r\n"...)
+		b = append(b, arg...)
+		b = append(b, "\r\n"...)
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+// maxBulkLength bounds bulk strings read, as Redis does by default.
+const maxBulkLength = 512 << 20
+
+// readReply reads a reply: a string for simple and bulk strings, an int64,
+// nil for null, an []interface{} for arrays, or a redisError.
+func readReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errors.New("hstssync: redis: invalid reply")
+	}
+	kind, line := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return line, nil
+	case '-':
+		return nil, redisError(line)
+	case ':':
+		return strconv.ParseInt(line, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line)
+		if err != nil || n > maxBulkLength {
+			return nil, fmt.Errorf("hstssync: redis: invalid bulk length %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, err
+		}
+		return string(b[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line)
+		if err != nil {
+			return nil, fmt.Errorf("hstssync: redis: invalid array length %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		a := make([]interface{}, 0, n)
+		for i := 0; i < n; i++ {
+			v, err := readReply(r)
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, v)
+		}
+		return a, nil
+	}
+	return nil, fmt.Errorf("hstssync: redis: invalid reply type %q", kind)
+}
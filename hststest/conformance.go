@@ -0,0 +1,139 @@
+package hststest
+
+import (
+	"net/http"
+	"testing"
+)
+
+// A Scenario is a sequence of requests checking a requirement of RFC 6797.
+type Scenario struct {
+	Name    string
+	Section string // of RFC 6797
+	Steps   []Step
+}
+
+// A Step is a request in a scenario, answered by the fake HTTP server with
+// a Strict-Transport-Security header if set, over HTTPS only unless Plaintext.
+type Step struct {
+	URL        string // requested
+	Want       string // URL expected to be sent, URL if empty
+	Header     string
+	Plaintext  bool // also send the header over plaintext
+	Unverified bool // HTTPS without verified chains, see RoundTripper
+}
+
+// Scenarios are the scenarios run by Conformance.
+var Scenarios = []Scenario{
+	{"note over HTTPS", "8.1", []Step{
+		{URL: "https://example.com/", Header: "max-age=3600"},
+		{URL: "http://example.com/", Want: "https://example.com/"},
+	}},
+	{"unknown host not upgraded", "8.3", []Step{
+		{URL: "http://example.com/"},
+	}},
+	{"ignore header over plaintext", "8.1", []Step{
+		{URL: "http://example.com/", Header: "max-age=3600", Plaintext: true},
+		{URL: "http://example.com/"},
+	}},
+	{"ignore header over TLS with errors", "8.1", []Step{
+		{URL: "https://example.com/", Header: "max-age=3600", Unverified: true},
+		{URL: "http://example.com/"},
+	}},
+	{"ignore header without max-age", "6.1.1", []Step{
+		{URL: "https://example.com/", Header: "includeSubDomains"},
+		{URL: "http://example.com/"},
+	}},
+	{"ignore header with invalid max-age", "6.1.1", []Step{
+		{URL: "https://example.com/", Header: "max-age=abc"},
+		{URL: "http://example.com/"},
+	}},
+	{"case-insensitive directives", "6.1", []Step{
+		{URL: "https://example.com/", Header: "MAX-AGE=3600; INCLUDESUBDOMAINS"},
+		{URL: "http://sub.example.com/", Want: "https://sub.example.com/"},
+	}},
+	{"quoted max-age", "6.1", []Step{
+		{URL: "https://example.com/", Header: `max-age="3600"`},
+		{URL: "http://example.com/", Want: "https://example.com/"},
+	}},
+	{"ignore unknown directives", "6.1", []Step{
+		{URL: "https://example.com/", Header: "max-age=3600; unknown=value"},
+		{URL: "http://example.com/", Want: "https://example.com/"},
+	}},
+	{"max-age=0 removes the policy", "6.1.1", []Step{
+		{URL: "https://example.com/", Header: "max-age=3600"},
+		{URL: "https://example.com/", Header: "max-age=0"},
+		{URL: "http://example.com/"},
+	}},
+	{"includeSubDomains", "6.1.2", []Step{
+		{URL: "https://example.com/", Header: "max-age=3600; includeSubDomains"},
+		{URL: "http://a.b.example.com/", Want: "https://a.b.example.com/"},
+	}},
+	{"subdomains not covered without includeSubDomains", "8.2", []Step{
+		{URL: "https://example.com/", Header: "max-age=3600"},
+		{URL: "http://sub.example.com/"},
+	}},
+	{"superdomains not covered", "8.2", []Step{
+		{URL: "https://sub.example.com/", Header: "max-age=3600; includeSubDomains"},
+		{URL: "http://example.com/"},
+	}},
+	{"policy updated", "8.1.1", []Step{
+		{URL: "https://example.com/", Header: "max-age=3600; includeSubDomains"},
+		{URL: "https://example.com/", Header: "max-age=3600"},
+		{URL: "http://sub.example.com/"},
+	}},
+	{"case-insensitive host matching", "8.2", []Step{
+		{URL: "https://Example.COM/", Header: "max-age=3600"},
+		{URL: "http://example.com/", Want: "https://example.com/"},
+		{URL: "http://EXAMPLE.com/", Want: "https://EXAMPLE.com/"},
+	}},
+	{"noted regardless of port", "8.1", []Step{
+		{URL: "https://example.com:8443/", Header: "max-age=3600"},
+		{URL: "http://example.com/", Want: "https://example.com/"},
+	}},
+	{"port 80 replaced by 443", "8.3", []Step{
+		{URL: "https://example.com/", Header: "max-age=3600"},
+		{URL: "http://example.com:80/", Want: "https://example.com:443/"},
+	}},
+	{"other ports preserved", "8.3", []Step{
+		{URL: "https://example.com/", Header: "max-age=3600"},
+		{URL: "http://example.com:8080/", Want: "https://example.com:8080/"},
+	}},
+	{"path, query and userinfo preserved", "8.3", []Step{
+		{URL: "https://example.com/", Header: "max-age=3600"},
+		{URL: "http://user@example.com/a/b?c=d", Want: "https://user@example.com/a/b?c=d"},
+	}},
+	{"IP addresses not noted", "8.1", []Step{
+		{URL: "https://127.0.0.1/", Header: "max-age=3600"},
+		{URL: "http://127.0.0.1/"},
+		{URL: "https://[::1]/", Header: "max-age=3600"},
+		{URL: "http://[::1]/"},
+	}},
+}
+
+// Conformance runs the Scenarios as subtests against an implementation of
+// HSTS, newTransport returning a new one wrapping a fake RoundTripper, to
+// check that what it sends is upgraded as expected.
+func Conformance(t *testing.T, newTransport func(http.RoundTripper) http.RoundTripper) {
+	for _, sc := range Scenarios {
+		sc := sc
+		t.Run(sc.Name, func(t *testing.T) {
+			rt := &RoundTripper{}
+			client := &http.Client{Transport: newTransport(rt)}
+			for i, step := range sc.Steps {
+				rt.Header, rt.Plaintext, rt.Unverified = step.Header, step.Plaintext, step.Unverified
+				resp, err := client.Get(step.URL)
+				if err != nil {
+					t.Fatalf("section %v step %d: %v", sc.Section, i, err)
+				}
+				resp.Body.Close()
+				want := step.Want
+				if want == "" {
+					want = step.URL
+				}
+				if got := rt.Last(); got == nil || got.String() != want {
+					t.Fatalf("section %v step %d: %v sent as %v; want %v", sc.Section, i, step.URL, got, want)
+				}
+			}
+		})
+	}
+}
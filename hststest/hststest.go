@@ -0,0 +1,131 @@
+// Package hststest provides utilities for testing code using package hsts:
+// fake RoundTrippers sending Strict-Transport-Security headers, a pair of
+// HTTP and HTTPS test servers, a fake clock, and a conformance suite for
+// implementations of HSTS.
+package hststest
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// A RoundTripper is a fake http.RoundTripper answering every request with an
+// empty 200 OK, as if HTTPS were verified TLS, and remembering the URLs asked.
+// It is safe for concurrent use.
+type RoundTripper struct {
+	// Header is the Strict-Transport-Security header sent over HTTPS,
+	// none if empty. It is also sent over plaintext if Plaintext is set,
+	// to check it is ignored there.
+	Header    string
+	Plaintext bool
+
+	// Unverified makes HTTPS responses lack verified chains, as when
+	// certificate errors are ignored.
+	Unverified bool
+
+	m    sync.Mutex // protects urls
+	urls []*url.URL
+}
+
+// Advertising returns a RoundTripper sending an HSTS header over HTTPS.
+func Advertising(header string) *RoundTripper {
+	return &RoundTripper{Header: header}
+}
+
+// Deleting returns a RoundTripper sending max-age=0 over HTTPS, which
+// removes the policy of hosts.
+func Deleting() *RoundTripper {
+	return &RoundTripper{Header: "max-age=0"}
+}
+
+// Plain returns a RoundTripper sending no HSTS header.
+func Plain() *RoundTripper {
+	return &RoundTripper{}
+}
+
+// RoundTrip answers a request.
+func (rt *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	u := *req.URL
+	rt.m.Lock()
+	rt.urls = append(rt.urls, &u)
+	rt.m.Unlock()
+
+	resp := &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Body:       http.NoBody,
+		Request:    req,
+	}
+	secure := req.URL.Scheme == "https" || req.URL.Scheme == "wss"
+	if secure {
+		resp.TLS = &tls.ConnectionState{
+			HandshakeComplete: true,
+			ServerName:        req.URL.Hostname(),
+		}
+		if !rt.Unverified {
+			resp.TLS.VerifiedChains = [][]*x509.Certificate{{&x509.Certificate{}}}
+		}
+	}
+	if rt.Header != "" && (secure || rt.Plaintext) {
+		resp.Header.Set("Strict-Transport-Security", rt.Header)
+	}
+	return resp, nil
+}
+
+// URLs returns the URLs of the requests received, in order.
+func (rt *RoundTripper) URLs() []*url.URL {
+	rt.m.Lock()
+	defer rt.m.Unlock()
+	return append([]*url.URL(nil), rt.urls...)
+}
+
+// Last returns the URL of the last request received, nil if none.
+func (rt *RoundTripper) Last() *url.URL {
+	rt.m.Lock()
+	defer rt.m.Unlock()
+	if len(rt.urls) == 0 {
+		return nil
+	}
+	return rt.urls[len(rt.urls)-1]
+}
+
+// A Clock is a fake clock for hsts.WithClock, only moving when told to.
+// It is safe for concurrent use.
+type Clock struct {
+	m   sync.Mutex // protects now
+	now time.Time
+}
+
+// NewClock returns a clock set to a time.
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+// Now returns the time of the clock.
+func (c *Clock) Now() time.Time {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d.
+func (c *Clock) Advance(d time.Duration) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Set sets the time of the clock.
+func (c *Clock) Set(now time.Time) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.now = now
+}
@@ -0,0 +1,94 @@
+package hststest_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/StalkR/hsts"
+	"github.com/StalkR/hsts/hststest"
+)
+
+func get(t *testing.T, client *http.Client, u string) *http.Response {
+	t.Helper()
+	resp, err := client.Get(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestRoundTripper(t *testing.T) {
+	rt := hststest.Advertising("max-age=3600")
+	transport := hsts.New(rt)
+	client := &http.Client{Transport: transport}
+	get(t, client, "https://example.com")
+	get(t, client, "http://example.com/a")
+	if got := rt.Last().String(); got != "https://example.com/a" {
+		t.Errorf("got last %v; want upgraded", got)
+	}
+	if n := len(rt.URLs()); n != 2 {
+		t.Errorf("got %d URLs; want 2", n)
+	}
+
+	client.Transport = hsts.New(hststest.Deleting(), hsts.WithStore(transport.Store()))
+	get(t, client, "https://example.com")
+	if _, ok := transport.Lookup("example.com"); ok {
+		t.Error("example.com still known after deleting")
+	}
+
+	plain := &hststest.RoundTripper{Header: "max-age=3600", Plaintext: true}
+	client.Transport = hsts.New(plain)
+	get(t, client, "http://example.com")
+	get(t, client, "http://example.com")
+	if got := plain.Last().Scheme; got != "http" {
+		t.Errorf("got scheme %v; want header over plaintext ignored", got)
+	}
+	if hststest.Plain().Header != "" {
+		t.Error("plain RoundTripper sends a header")
+	}
+}
+
+func TestServer(t *testing.T) {
+	s := hststest.NewServer("max-age=3600; includeSubDomains", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil {
+			w.Header().Set("X-Scheme", "https")
+		}
+	}))
+	defer s.Close()
+
+	clock := hststest.NewClock(time.Now())
+	transport := hsts.New(s.Transport(), hsts.WithClock(clock.Now))
+	client := &http.Client{Transport: transport}
+	if resp := get(t, client, s.URL("http", "/")); resp.Header.Get("X-Scheme") != "" {
+		t.Fatal("HTTP served over HTTPS before learning")
+	}
+	get(t, client, s.URL("https", "/"))
+	if resp := get(t, client, "http://sub."+hststest.Host+"/"); resp.Header.Get("X-Scheme") != "https" {
+		t.Error("subdomain not upgraded after learning")
+	}
+
+	clock.Advance(2 * time.Hour)
+	if _, ok := transport.Lookup(hststest.Host); ok {
+		t.Error("policy not expired after advancing the clock")
+	}
+	clock.Set(time.Now())
+	if got := clock.Now(); time.Since(got) > time.Minute {
+		t.Errorf("got clock %v; want now", got)
+	}
+}
+
+func TestServerCertPool(t *testing.T) {
+	s := hststest.NewServer("max-age=3600", http.NotFoundHandler())
+	defer s.Close()
+
+	insecure := s.Transport()
+	insecure.TLSClientConfig.RootCAs = nil
+	insecure.TLSClientConfig.InsecureSkipVerify = true
+	transport := hsts.New(insecure, hsts.WithTestCertificates(s.CertPool()))
+	get(t, &http.Client{Transport: transport}, s.URL("https", "/"))
+	if _, ok := transport.Lookup(hststest.Host); !ok {
+		t.Error("policy not learned with the test certificate trusted")
+	}
+}
@@ -0,0 +1,77 @@
+package hststest
+
+import (
+	"context"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+)
+
+// Host is the host served by a Server, with its subdomains.
+const Host = "example.com"
+
+// A Server is a pair of HTTP and HTTPS test servers for Host and its
+// subdomains, with the HTTPS one sending a Strict-Transport-Security header.
+// Requests must be made with its Transport, which sends them to port 80 to
+// the HTTP server and to port 443 to the HTTPS one, so that upgrades from
+// http:// to https:// URLs work as with real servers.
+type Server struct {
+	HTTP  *httptest.Server
+	HTTPS *httptest.Server
+}
+
+// NewServer starts a Server serving handler on both servers, the HTTPS one
+// adding the Strict-Transport-Security header if not empty.
+// The caller should call Close when finished, to shut it down.
+func NewServer(header string, handler http.Handler) *Server {
+	return &Server{
+		HTTP: httptest.NewServer(handler),
+		HTTPS: httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if header != "" {
+				w.Header().Set("Strict-Transport-Security", header)
+			}
+			handler.ServeHTTP(w, r)
+		})),
+	}
+}
+
+// URL returns the URL of a path on Host with a scheme, http or https.
+func (s *Server) URL(scheme, path string) string {
+	return scheme + "://" + Host + path
+}
+
+// Transport returns a transport sending requests for any host to the servers,
+// trusting the certificate of the HTTPS server which is valid for Host and
+// its subdomains. It is the one to wrap with hsts.New.
+func (s *Server) Transport() *http.Transport {
+	transport := s.HTTPS.Client().Transport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		_, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		if port == "443" {
+			addr = s.HTTPS.Listener.Addr().String()
+		} else {
+			addr = s.HTTP.Listener.Addr().String()
+		}
+		var d net.Dialer
+		return d.DialContext(ctx, network, addr)
+	}
+	return transport
+}
+
+// CertPool returns a pool with the certificate of the HTTPS server, to trust
+// with hsts.WithTestCertificates when wrapping a transport which does not.
+func (s *Server) CertPool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(s.HTTPS.Certificate())
+	return pool
+}
+
+// Close shuts down the servers.
+func (s *Server) Close() {
+	s.HTTP.Close()
+	s.HTTPS.Close()
+}
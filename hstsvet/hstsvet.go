@@ -0,0 +1,87 @@
+// Package hstsvet defines an Analyzer reporting string literals with
+// plaintext URLs (http or ws) of hosts in the HSTS preload list, which
+// browsers and hsts.Transports upgrade anyway, suggesting https or wss so
+// that the upgrades are never needed. Use it with go vet, see command
+// hstsvet, or in a multichecker.
+package hstsvet
+
+import (
+	"go/ast"
+	"go/token"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/StalkR/hsts"
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
+)
+
+// Analyzer reports plaintext URLs of preloaded hosts in string literals.
+var Analyzer = &analysis.Analyzer{
+	Name:     "hstspreload",
+	Doc:      "report plaintext URLs of hosts in the HSTS preload list\n\nBrowsers and HSTS clients upgrade such URLs to HTTPS before sending anything, so they should be written with https (or wss) in the first place.",
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run:      run,
+}
+
+// preloaded only knows the preload list, having learned nothing.
+var preloaded = hsts.New(nil)
+
+// secureSchemes are the upgrades of plaintext schemes.
+var secureSchemes = map[string]string{"http": "https", "ws": "wss"}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	inspect := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+	inspect.Preorder([]ast.Node{(*ast.BasicLit)(nil)}, func(n ast.Node) {
+		lit := n.(*ast.BasicLit)
+		if lit.Kind != token.STRING {
+			return
+		}
+		s, err := strconv.Unquote(lit.Value)
+		if err != nil {
+			return
+		}
+		check(pass, lit, s)
+	})
+	return nil, nil
+}
+
+// check reports a string literal which is a plaintext URL of a preloaded host.
+func check(pass *analysis.Pass, lit *ast.BasicLit, s string) {
+	i := strings.Index(s, "://")
+	if i == -1 {
+		return
+	}
+	scheme := strings.ToLower(s[:i])
+	secure, ok := secureSchemes[scheme]
+	if !ok {
+		return
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.Hostname() == "" {
+		return
+	}
+	e, ok := preloaded.Lookup(u.Hostname())
+	if !ok || !e.Preloaded {
+		return
+	}
+	d := analysis.Diagnostic{
+		Pos:     lit.Pos(),
+		End:     lit.End(),
+		Message: scheme + " URL of " + u.Hostname() + ", in the HSTS preload list as " + e.Host + ": use " + secure,
+	}
+	// The scheme is replaced in place if written as is, without escapes.
+	if lit.Value[1:1+i] == s[:i] {
+		d.SuggestedFixes = []analysis.SuggestedFix{{
+			Message: "Use " + secure,
+			TextEdits: []analysis.TextEdit{{
+				Pos:     lit.Pos() + 1,
+				End:     lit.Pos() + 1 + token.Pos(i),
+				NewText: []byte(secure),
+			}},
+		}}
+	}
+	pass.Report(d)
+}
@@ -0,0 +1,15 @@
+package hstsvet
+
+import (
+	"testing"
+
+	"github.com/StalkR/hsts"
+	"golang.org/x/tools/go/analysis/analysistest"
+)
+
+func TestAnalyzer(t *testing.T) {
+	if e, ok := hsts.New(nil).Lookup("accounts.google.com"); !ok || !e.Preloaded {
+		t.Skip("built without the preload list")
+	}
+	analysistest.RunWithSuggestedFixes(t, analysistest.TestData(), Analyzer, "a")
+}
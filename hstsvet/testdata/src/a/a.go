@@ -0,0 +1,11 @@
+package a
+
+const (
+	preloaded = "http://accounts.google.com/login" // want `http URL of accounts.google.com, in the HSTS preload list as accounts.google.com: use https`
+	subdomain = `http://mail.google.com:8080/`     // want `http URL of mail.google.com, in the HSTS preload list as mail.google.com: use https`
+	websocket = "WS://accounts.google.com/socket"  // want `ws URL of accounts.google.com, in the HSTS preload list as accounts.google.com: use wss`
+	escaped   = "\x68ttp://accounts.google.com/"   // want `http URL of accounts.google.com`
+	secure    = "https://accounts.google.com/"
+	unknown   = "http://example.com/"
+	notURL    = "accounts.google.com"
+)
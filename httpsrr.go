@@ -0,0 +1,203 @@
+package hsts
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// typeHTTPS is the DNS HTTPS record type (RFC 9460).
+const typeHTTPS = dnsmessage.Type(65)
+
+// WithHTTPSRecords upgrades plaintext requests to unknown hosts which have a
+// DNS HTTPS record, as browsers do (RFC 9460 9.5), using lookup to tell
+// whether a host has one, for instance from LookupHTTPSRecords.
+// It is called before each such request, failing open on errors.
+func WithHTTPSRecords(lookup func(ctx context.Context, host string) (bool, error)) Option {
+	return func(t *Transport) {
+		t.httpsRecords = lookup
+	}
+}
+
+// httpsRecordMaxAge is the max-age of hosts noted for a DNS HTTPS record.
+const httpsRecordMaxAge = 24 * time.Hour
+
+// WithNoteHTTPSRecords sets whether hosts with a DNS HTTPS record are noted as
+// known HSTS hosts not including subdomains for a day, so that they are not
+// looked up again meanwhile, see WithHTTPSRecords. They are learned like
+// policies from headers, if allowed (see WithLearnAllow) and written through
+// to the Storage. DNS answers are not authenticated, so unlike headers they
+// are not kept long. It is disabled by default.
+func WithNoteHTTPSRecords(note bool) Option {
+	return func(t *Transport) {
+		t.noteHTTPSRecords = note
+	}
+}
+
+// hasHTTPSRecord returns whether a host has a DNS HTTPS record, if looked up,
+// noting it if configured.
+func (t *Transport) hasHTTPSRecord(req *http.Request, host string) bool {
+	if t.httpsRecords == nil {
+		return false
+	}
+	ok, err := t.httpsRecords(req.Context(), host)
+	if err != nil {
+		if t.logger != nil {
+			t.logger.DebugContext(req.Context(), "hsts: HTTPS record lookup failed", "host", host, "error", err)
+		}
+		return false
+	}
+	if ok && t.noteHTTPSRecords && t.mayLearn(host) {
+		t.add(host, newDirective(t.now(), httpsRecordMaxAge, 0).withMeta(nil, Origin{Source: SourceHTTPSRecord}))
+	}
+	return ok
+}
+
+// LookupHTTPSRecords returns a lookup for WithHTTPSRecords querying a DNS
+// server (host:port) for HTTPS records, the first nameserver of
+// /etc/resolv.conf if empty. It does not follow CNAME records itself,
+// recursive servers do.
+func LookupHTTPSRecords(server string) func(ctx context.Context, host string) (bool, error) {
+	return func(ctx context.Context, host string) (bool, error) {
+		addr := server
+		if addr == "" {
+			var err error
+			if addr, err = systemDNSServer(); err != nil {
+				return false, err
+			}
+		}
+		return lookupHTTPSRecord(ctx, addr, host)
+	}
+}
+
+// systemDNSServer returns the first nameserver of /etc/resolv.conf.
+func systemDNSServer() (string, error) {
+	f, err := os.Open("/etc/resolv.conf")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			return net.JoinHostPort(fields[1], "53"), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", errors.New("hsts: no nameserver in /etc/resolv.conf")
+}
+
+// lookupHTTPSRecord queries a DNS server for the HTTPS records of a host,
+// over UDP then TCP if the response was truncated.
+func lookupHTTPSRecord(ctx context.Context, server, host string) (bool, error) {
+	name, err := dnsmessage.NewName(host + ".")
+	if err != nil {
+		return false, err
+	}
+	var id [2]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return false, err
+	}
+	question := dnsmessage.Question{Name: name, Type: typeHTTPS, Class: dnsmessage.ClassINET}
+	query := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: binary.BigEndian.Uint16(id[:]), RecursionDesired: true},
+		Questions: []dnsmessage.Question{question},
+	}
+	b, err := query.Pack()
+	if err != nil {
+		return false, err
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+	}
+	resp, err := exchange(ctx, "udp", server, b)
+	if err != nil {
+		return false, err
+	}
+	if resp.Header.Truncated {
+		if resp, err = exchange(ctx, "tcp", server, b); err != nil {
+			return false, err
+		}
+	}
+	if !resp.Header.Response || resp.Header.ID != query.Header.ID {
+		return false, errors.New("hsts: DNS response ID mismatch")
+	}
+	if len(resp.Questions) != 1 || !sameQuestion(resp.Questions[0], question) {
+		return false, errors.New("hsts: DNS response to another question")
+	}
+	switch resp.Header.RCode {
+	case dnsmessage.RCodeSuccess:
+	case dnsmessage.RCodeNameError:
+		return false, nil
+	default:
+		return false, fmt.Errorf("hsts: DNS lookup of %v: %v", host, resp.Header.RCode)
+	}
+	for _, a := range resp.Answers {
+		if a.Header.Type == typeHTTPS {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// sameQuestion tells whether two DNS questions are the same, names compared
+// case-insensitively (RFC 4343).
+func sameQuestion(a, b dnsmessage.Question) bool {
+	return a.Type == b.Type && a.Class == b.Class && strings.EqualFold(a.Name.String(), b.Name.String())
+}
+
+// exchange sends a DNS query and returns the response.
+func exchange(ctx context.Context, network, server string, query []byte) (*dnsmessage.Message, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	b := make([]byte, 65535)
+	var n int
+	if network == "tcp" {
+		msg := binary.BigEndian.AppendUint16(nil, uint16(len(query)))
+		if _, err := conn.Write(append(msg, query...)); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(conn, b[:2]); err != nil {
+			return nil, err
+		}
+		n = int(binary.BigEndian.Uint16(b))
+		if _, err := io.ReadFull(conn, b[:n]); err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err := conn.Write(query); err != nil {
+			return nil, err
+		}
+		if n, err = conn.Read(b); err != nil {
+			return nil, err
+		}
+	}
+	var m dnsmessage.Message
+	if err := m.Unpack(b[:n]); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
@@ -0,0 +1,191 @@
+package hsts
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// noHeaderTransport replies without HSTS, so that only HTTPS records count.
+type noHeaderTransport struct{}
+
+func (f *noHeaderTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return secureReply(req, "HTTP/1.1 200 OK\r\n\r\n")
+}
+
+func TestHTTPSRecords(t *testing.T) {
+	lookups := 0
+	lookup := func(ctx context.Context, host string) (bool, error) {
+		lookups++
+		switch host {
+		case "svcb.example.com":
+			return true, nil
+		case "fail.example.com":
+			return false, errors.New("timeout")
+		}
+		return false, nil
+	}
+	for _, note := range []bool{false, true} {
+		lookups = 0
+		transport := New(&noHeaderTransport{}, WithHTTPSRecords(lookup), WithNoteHTTPSRecords(note))
+		var upgrades []Upgrade
+		WithUpgradeHook(func(u Upgrade) { upgrades = append(upgrades, u) })(transport)
+		client := &http.Client{Transport: transport}
+
+		for _, tt := range []struct {
+			url      string
+			upgraded bool
+		}{
+			{"http://svcb.example.com/", true},
+			{"http://svcb.example.com/", true},
+			{"http://sub.svcb.example.com/", false},
+			{"http://fail.example.com/", false},
+			{"http://example.org/", false},
+			{"http://127.0.0.1/", false}, // not looked up
+		} {
+			resp, err := client.Get(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if upgraded := resp.Request.URL.Scheme == "https"; upgraded != tt.upgraded {
+				t.Errorf("note %v: %v got upgraded %v; want %v", note, tt.url, upgraded, tt.upgraded)
+			}
+		}
+		want := 5
+		if note {
+			want = 4 // noted the first time
+		}
+		if lookups != want {
+			t.Errorf("note %v: got %d lookups; want %d", note, lookups, want)
+		}
+		// Once noted, the host is known: upgrades are no longer from a record.
+		if len(upgrades) != 2 || !upgrades[0].HTTPSRecord || upgrades[0].Host != "svcb.example.com" || upgrades[1].HTTPSRecord == note {
+			t.Errorf("note %v: got upgrades %+v; want 2", note, upgrades)
+		}
+		if e, ok := transport.Lookup("svcb.example.com"); ok != note || ok && (e.LongLived || e.IncludeSubDomains || e.MaxAge != httpsRecordMaxAge || e.Origin.Source != SourceHTTPSRecord) {
+			t.Errorf("note %v: got entry %+v, %v", note, e, ok)
+		}
+	}
+}
+
+func TestNoteHTTPSRecordsLearning(t *testing.T) {
+	lookup := func(ctx context.Context, host string) (bool, error) { return true, nil }
+	storage := &fakeStorage{}
+	transport := New(&noHeaderTransport{}, WithHTTPSRecords(lookup), WithNoteHTTPSRecords(true),
+		WithLearnDeny("internal.example"), WithStorage(storage))
+	client := &http.Client{Transport: transport}
+	for _, u := range []string{"http://svcb.example.com/", "http://svcb.internal.example/"} {
+		resp, err := client.Get(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if _, ok := transport.Lookup("svcb.internal.example"); ok {
+		t.Error("noted a host not allowed to be learned")
+	}
+	if _, ok := storage.entries["svcb.example.com"]; !ok || len(storage.entries) != 1 {
+		t.Errorf("got stored %v; want only svcb.example.com", storage.entries)
+	}
+}
+
+// dnsServer serves HTTPS records for a host, and truncates responses over UDP
+// if asked to.
+func dnsServer(t *testing.T, host string, truncate bool) string {
+	answer := func(b []byte, udp bool) []byte {
+		var q dnsmessage.Message
+		if err := q.Unpack(b); err != nil {
+			t.Error(err)
+			return nil
+		}
+		r := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: q.Header.ID, Response: true},
+			Questions: q.Questions,
+		}
+		if q.Questions[0].Name.String() == "spoofed."+host+"." {
+			r.Questions[0].Name = dnsmessage.MustNewName(host + ".")
+			q.Questions = r.Questions
+		}
+		if q.Questions[0].Name.String() != host+"." {
+			r.Header.RCode = dnsmessage.RCodeNameError
+		} else if udp && truncate {
+			r.Header.Truncated = true
+		} else {
+			r.Answers = []dnsmessage.Resource{{
+				Header: dnsmessage.ResourceHeader{Name: q.Questions[0].Name, Type: typeHTTPS, Class: dnsmessage.ClassINET, TTL: 60},
+				Body:   &dnsmessage.UnknownResource{Type: typeHTTPS, Data: []byte{0, 1, 0}}, // priority 1, target .
+			}}
+		}
+		out, err := r.Pack()
+		if err != nil {
+			t.Error(err)
+		}
+		return out
+	}
+
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { udp.Close() })
+	go func() {
+		b := make([]byte, 512)
+		for {
+			n, addr, err := udp.ReadFrom(b)
+			if err != nil {
+				return
+			}
+			udp.WriteTo(answer(b[:n], true), addr)
+		}
+	}()
+
+	tcp, err := net.Listen("tcp", udp.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { tcp.Close() })
+	go func() {
+		for {
+			c, err := tcp.Accept()
+			if err != nil {
+				return
+			}
+			b := make([]byte, 512)
+			n, _ := c.Read(b)
+			out := answer(b[2:n], false)
+			c.Write(append([]byte{byte(len(out) >> 8), byte(len(out))}, out...))
+			c.Close()
+		}
+	}()
+	return udp.LocalAddr().String()
+}
+
+func TestLookupHTTPSRecords(t *testing.T) {
+	for _, truncate := range []bool{false, true} {
+		lookup := LookupHTTPSRecords(dnsServer(t, "svcb.example.com", truncate))
+		for host, want := range map[string]bool{
+			"svcb.example.com": true,
+			"example.org":      false,
+		} {
+			got, err := lookup(context.Background(), host)
+			if err != nil {
+				t.Fatalf("truncate %v: %v: %v", truncate, host, err)
+			}
+			if got != want {
+				t.Errorf("truncate %v: %v got %v; want %v", truncate, host, got, want)
+			}
+		}
+	}
+}
+
+func TestLookupHTTPSRecordsQuestion(t *testing.T) {
+	lookup := LookupHTTPSRecords(dnsServer(t, "svcb.example.com", false))
+	if _, err := lookup(context.Background(), "spoofed.svcb.example.com"); err == nil {
+		t.Error("got no error for a response to another question")
+	}
+}
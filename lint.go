@@ -0,0 +1,133 @@
+package hsts
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// A Severity is how serious a Finding is.
+type Severity int
+
+const (
+	// SeverityError is for what browsers ignore or reject.
+	SeverityError Severity = iota
+
+	// SeverityWarning is for what works but is not recommended.
+	SeverityWarning
+
+	// SeverityInfo is for what may be intended but is worth knowing.
+	SeverityInfo
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	case SeverityInfo:
+		return "info"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// Codes of findings, as strings for programs to match on. They are stable:
+// new ones may be added but these do not change.
+const (
+	CodeSyntax          = "syntax"                        // grammar of section 6.1 violated
+	CodeDuplicate       = "directive.duplicate"           // section 6.1 requirement 2
+	CodeUnexpectedValue = "directive.unexpected_value"    // includeSubDomains or preload with a value
+	CodeUnknown         = "directive.unknown"             // extension, ignored by browsers
+	CodeMaxAgeMissing   = "max_age.missing"               // section 6.1.1
+	CodeMaxAgeInvalid   = "max_age.invalid"               // not delta-seconds
+	CodeMaxAgeZero      = "max_age.zero"                  // removes the policy
+	CodeMaxAgeTooLow    = "max_age.too_low"               // below MinPreloadMaxAge
+	CodeNoSubDomains    = "include_subdomains.missing"    // subdomains not covered
+	CodePreloadNoSub    = "preload.no_include_subdomains" // preload list requirement
+	CodePreloadMaxAge   = "preload.max_age_too_low"       // preload list requirement
+	CodeHeaderMissing   = "header.missing"
+	CodeHeaderMultiple  = "header.multiple"  // only the first is used
+	CodeHeaderPlaintext = "header.plaintext" // section 8.1 says to ignore it
+)
+
+// A Finding is a diagnostic about a Strict-Transport-Security header.
+type Finding struct {
+	Severity  Severity
+	Code      string // one of the Code constants, e.g. CodeSyntax
+	Directive string // the offending directive, if any
+	Message   string
+}
+
+func (f Finding) String() string {
+	if f.Directive != "" {
+		return fmt.Sprintf("%v: %v: directive %q: %v", f.Severity, f.Code, f.Directive, f.Message)
+	}
+	return fmt.Sprintf("%v: %v: %v", f.Severity, f.Code, f.Message)
+}
+
+// LintHeader checks a Strict-Transport-Security header value as a site
+// operator would want: every violation of the grammar of section 6.1 (as
+// ValidateHeader but not only the first), and advice on the policy itself
+// like a short max-age, missing includeSubDomains or preload without meeting
+// the preload list requirements (https://hstspreload.org).
+// Findings are in the order of the directives, then about the policy.
+func LintHeader(header string) []Finding {
+	var findings []Finding
+	p, err := parse(header, func(directive, code, reason string) {
+		findings = append(findings, Finding{Severity: SeverityError, Code: code, Directive: directive, Message: reason})
+	})
+	if err != nil {
+		return findings
+	}
+	add := func(severity Severity, code, format string, args ...interface{}) {
+		findings = append(findings, Finding{Severity: severity, Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+	var names []string
+	for name := range p.Extensions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		findings = append(findings, Finding{Severity: SeverityInfo, Code: CodeUnknown, Directive: name, Message: "unknown directive, ignored by browsers"})
+	}
+	if p.MaxAge == 0 {
+		add(SeverityInfo, CodeMaxAgeZero, "max-age=0 removes the policy")
+		return findings
+	}
+	if p.Preload {
+		if !p.IncludeSubDomains {
+			add(SeverityError, CodePreloadNoSub, "preload requires includeSubDomains")
+		}
+		if p.MaxAge < MinPreloadMaxAge {
+			add(SeverityError, CodePreloadMaxAge, "preload requires max-age of at least %d", int64(MinPreloadMaxAge/time.Second))
+		}
+		return findings
+	}
+	if p.MaxAge < MinPreloadMaxAge {
+		add(SeverityWarning, CodeMaxAgeTooLow, "max-age of %v is below the recommended %d (one year)", p.MaxAge, int64(MinPreloadMaxAge/time.Second))
+	}
+	if !p.IncludeSubDomains {
+		add(SeverityWarning, CodeNoSubDomains, "subdomains are not covered without includeSubDomains")
+	}
+	return findings
+}
+
+// LintResponse checks the Strict-Transport-Security header of a response as
+// a browser would receive it: it must be there, over HTTPS and only once, in
+// addition to the findings of LintHeader.
+func LintResponse(resp *http.Response) []Finding {
+	values := resp.Header.Values("Strict-Transport-Security")
+	if len(values) == 0 {
+		return []Finding{{Severity: SeverityError, Code: CodeHeaderMissing, Message: "no Strict-Transport-Security header"}}
+	}
+	var findings []Finding
+	if resp.TLS == nil {
+		findings = append(findings, Finding{Severity: SeverityError, Code: CodeHeaderPlaintext, Message: "header received over plaintext, browsers ignore it"})
+	}
+	if len(values) > 1 {
+		findings = append(findings, Finding{Severity: SeverityWarning, Code: CodeHeaderMultiple, Message: fmt.Sprintf("%d headers, browsers only use the first", len(values))})
+	}
+	return append(findings, LintHeader(values[0])...)
+}
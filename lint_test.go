@@ -0,0 +1,73 @@
+package hsts
+
+import (
+	"crypto/tls"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestLintHeader(t *testing.T) {
+	for _, tt := range []struct {
+		header string
+		want   []string // codes
+	}{
+		{"max-age=63072000; includeSubDomains; preload", nil},
+		{"max-age=31536000; includeSubDomains", nil},
+		{"max-age=3600; includeSubDomains", []string{CodeMaxAgeTooLow}},
+		{"max-age=31536000", []string{CodeNoSubDomains}},
+		{"max-age=3600", []string{CodeMaxAgeTooLow, CodeNoSubDomains}},
+		{"max-age=31536000; preload", []string{CodePreloadNoSub}},
+		{"max-age=3600; includeSubDomains; preload", []string{CodePreloadMaxAge}},
+		{"max-age=0", []string{CodeMaxAgeZero}},
+		{"max-age=31536000; includeSubDomains; b; a=1", []string{CodeUnknown, CodeUnknown}},
+		{"max-age=31536000; includeSubDomains; includeSubDomains", []string{CodeDuplicate}},
+		{"max-age = 31536000; includeSubDomains=1; e@t", []string{CodeSyntax, CodeUnexpectedValue, CodeSyntax, CodeNoSubDomains}},
+		{"includeSubDomains", []string{CodeMaxAgeMissing}},
+		{"max-age=-1; preload", []string{CodeMaxAgeInvalid, CodeMaxAgeMissing}},
+		{"max-age=1234, includeSubDomains", []string{CodeSyntax, CodeMaxAgeMissing}},
+	} {
+		var got []string
+		for _, f := range LintHeader(tt.header) {
+			got = append(got, f.Code)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("LintHeader(%q) got %v; want %v", tt.header, got, tt.want)
+		}
+	}
+
+	findings := LintHeader("max-age=1; a; max-age=2")
+	want := Finding{Severity: SeverityError, Code: CodeDuplicate, Directive: "max-age=2", Message: "duplicate directive"}
+	if len(findings) == 0 || findings[0] != want {
+		t.Errorf("LintHeader() got %v; want first %v", findings, want)
+	}
+	if got, want := want.String(), `error: directive.duplicate: directive "max-age=2": duplicate directive`; got != want {
+		t.Errorf("String() got %q; want %q", got, want)
+	}
+}
+
+func TestLintResponse(t *testing.T) {
+	for _, tt := range []struct {
+		values []string
+		tls    bool
+		want   []string // codes
+	}{
+		{[]string{"max-age=31536000; includeSubDomains"}, true, nil},
+		{nil, true, []string{CodeHeaderMissing}},
+		{[]string{"max-age=31536000; includeSubDomains"}, false, []string{CodeHeaderPlaintext}},
+		{[]string{"max-age=31536000; includeSubDomains", "max-age=0"}, true, []string{CodeHeaderMultiple}},
+		{[]string{"max-age=31536000"}, false, []string{CodeHeaderPlaintext, CodeNoSubDomains}},
+	} {
+		resp := &http.Response{Header: http.Header{"Strict-Transport-Security": tt.values}}
+		if tt.tls {
+			resp.TLS = &tls.ConnectionState{}
+		}
+		var got []string
+		for _, f := range LintResponse(resp) {
+			got = append(got, f.Code)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("LintResponse(%q, tls %v) got %v; want %v", tt.values, tt.tls, got, tt.want)
+		}
+	}
+}
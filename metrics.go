@@ -0,0 +1,200 @@
+package hsts
+
+import (
+	"expvar"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// counters count what a Transport does, updated atomically.
+type counters struct {
+	upgradesPreloaded int64 // requests upgraded by a preloaded policy
+	upgradesDynamic   int64 // requests upgraded by a learned policy
+	bypassed          int64 // requests not upgraded because of an IP or local host
+	fallbacks         int64 // upgraded requests sent again in plaintext, see WithHTTPFallback
+	learned           int64 // directives noted
+	added             int64 // policies added, see AddHosts
+	expired           int64 // entries removed because expired
+	knockOuts         int64 // directives with max-age=0
+	coalesced         int64 // directives ignored, see WithMinUpdateInterval
+	evicted           int64 // entries evicted, see WithMaxEntries
+	storageErrors     int64 // failures of the Storage, see WithStorage
+	hits              int64 // lookups finding a known HSTS host
+	misses            int64 // lookups finding none
+
+	upgradesBySource [len(sourceNames)]int64 // requests upgraded by the source of the policy
+}
+
+func (t *Transport) count(counter *int64) {
+	atomic.AddInt64(counter, 1)
+}
+
+// publish publishes the counters of a Transport as an expvar map, see WithExpvar.
+func (t *Transport) publish(name string) {
+	m := new(expvar.Map)
+	for _, c := range []struct {
+		name    string
+		counter *int64
+	}{
+		{"upgrades_preloaded", &t.counters.upgradesPreloaded},
+		{"upgrades_dynamic", &t.counters.upgradesDynamic},
+		{"bypassed", &t.counters.bypassed},
+		{"fallbacks", &t.counters.fallbacks},
+		{"learned", &t.counters.learned},
+		{"added", &t.counters.added},
+		{"expired", &t.counters.expired},
+		{"knock_outs", &t.counters.knockOuts},
+		{"coalesced", &t.counters.coalesced},
+		{"evicted", &t.counters.evicted},
+		{"storage_errors", &t.counters.storageErrors},
+		{"lookup_hits", &t.counters.hits},
+		{"lookup_misses", &t.counters.misses},
+	} {
+		counter := c.counter
+		m.Set(c.name, expvar.Func(func() interface{} { return atomic.LoadInt64(counter) }))
+	}
+	m.Set("upgrades_by_source", expvar.Func(func() interface{} {
+		by := make(map[string]int64)
+		for s, n := range t.upgradesBySource() {
+			by[s.String()] = n
+		}
+		return by
+	}))
+	m.Set("dynamic_entries", expvar.Func(func() interface{} { return t.size() }))
+	m.Set("top_upgraded", expvar.Func(func() interface{} { return t.topUpgraded.top() }))
+	expvar.Publish(name, m)
+}
+
+// Stats are counts of what a Transport knows, and of what it did since New.
+type Stats struct {
+	Preloaded int // hosts in the preload list
+	Dynamic   int // hosts with a learned policy, some may have expired
+
+	UpgradesPreloaded int64 // requests upgraded by a preloaded policy
+	UpgradesDynamic   int64 // requests upgraded by a learned policy
+	Bypassed          int64 // plaintext requests not upgraded because the host is an IP or local
+	Fallbacks         int64 // upgraded requests sent again in plaintext, see WithHTTPFallback
+	Learned           int64 // policies learned or renewed
+	Added             int64 // policies added with AddHosts
+	Expired           int64 // learned policies removed because they expired
+	KnockOuts         int64 // policies removed with max-age=0
+	Coalesced         int64 // policies ignored as the same or too soon, see WithMinUpdateInterval
+	Evicted           int64 // learned policies evicted, see WithMaxEntries
+	StorageErrors     int64 // failures to read or write the Storage, see WithStorage
+	LookupHits        int64 // lookups finding a policy
+	LookupMisses      int64 // lookups finding none
+
+	// UpgradesBySource are the requests upgraded by the source of the policy
+	// which applied (see Upgrade), e.g. to tell whether policies learned from
+	// headers still upgrade any which the preload list does not.
+	UpgradesBySource map[Source]int64
+
+	// TopUpgraded are the hosts most requested in plaintext and upgraded,
+	// most upgraded first, see WithTopUpgraded.
+	TopUpgraded []HostCount
+}
+
+// A HostCount is a count of events for a host.
+type HostCount struct {
+	Host  string
+	Count int64 // may be overestimated, see WithTopUpgraded
+}
+
+// Stats returns counts of what the Transport knows and did.
+func (t *Transport) Stats() Stats {
+	return Stats{
+		Preloaded:         t.preloadCount(),
+		Dynamic:           t.size(),
+		UpgradesPreloaded: atomic.LoadInt64(&t.counters.upgradesPreloaded),
+		UpgradesDynamic:   atomic.LoadInt64(&t.counters.upgradesDynamic),
+		Bypassed:          atomic.LoadInt64(&t.counters.bypassed),
+		Fallbacks:         atomic.LoadInt64(&t.counters.fallbacks),
+		Learned:           atomic.LoadInt64(&t.counters.learned),
+		Added:             atomic.LoadInt64(&t.counters.added),
+		Expired:           atomic.LoadInt64(&t.counters.expired),
+		KnockOuts:         atomic.LoadInt64(&t.counters.knockOuts),
+		Coalesced:         atomic.LoadInt64(&t.counters.coalesced),
+		Evicted:           atomic.LoadInt64(&t.counters.evicted),
+		StorageErrors:     atomic.LoadInt64(&t.counters.storageErrors),
+		LookupHits:        atomic.LoadInt64(&t.counters.hits),
+		LookupMisses:      atomic.LoadInt64(&t.counters.misses),
+		UpgradesBySource:  t.upgradesBySource(),
+		TopUpgraded:       t.topUpgraded.top(),
+	}
+}
+
+// upgradesBySource returns the upgrades by source of the policy, among
+// sources which upgraded any.
+func (t *Transport) upgradesBySource() map[Source]int64 {
+	by := make(map[Source]int64)
+	for s := range t.counters.upgradesBySource {
+		if n := atomic.LoadInt64(&t.counters.upgradesBySource[s]); n > 0 {
+			by[Source(s)] = n
+		}
+	}
+	return by
+}
+
+// defaultTopUpgraded is the default number of hosts counted for upgrades.
+const defaultTopUpgraded = 100
+
+// A topHosts counts events for the hosts with the most of them, bounded with
+// the Space-Saving algorithm: when full, a new host replaces the one with the
+// lowest count and starts from it, so it is overestimated by at most that.
+// Hosts with many events are kept and their counts are accurate.
+// A nil topHosts counts nothing.
+type topHosts struct {
+	m      sync.Mutex // protects counts
+	size   int
+	counts map[string]int64
+}
+
+func newTopHosts(size int) *topHosts {
+	if size <= 0 {
+		return nil
+	}
+	return &topHosts{size: size, counts: make(map[string]int64)}
+}
+
+// add counts an event for a host.
+func (c *topHosts) add(host string) {
+	if c == nil {
+		return
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+	if _, ok := c.counts[host]; ok || len(c.counts) < c.size {
+		c.counts[host]++
+		return
+	}
+	var minHost string
+	var minCount int64
+	for h, n := range c.counts {
+		if minHost == "" || n < minCount {
+			minHost, minCount = h, n
+		}
+	}
+	delete(c.counts, minHost)
+	c.counts[host] = minCount + 1
+}
+
+// top returns the counts, highest first.
+func (c *topHosts) top() []HostCount {
+	if c == nil {
+		return nil
+	}
+	c.m.Lock()
+	top := make([]HostCount, 0, len(c.counts))
+	for host, n := range c.counts {
+		top = append(top, HostCount{Host: host, Count: n})
+	}
+	c.m.Unlock()
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return top[i].Host < top[j].Host
+	})
+	return top
+}
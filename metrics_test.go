@@ -0,0 +1,131 @@
+package hsts
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestExpvar(t *testing.T) {
+	name := "hsts_test_" + strconv.FormatInt(time.Now().UnixNano(), 10) // unique with -count
+	transport := New(&fakeTransport{}, WithExpvar(name))
+	client := &http.Client{Transport: transport}
+	for _, u := range []string{
+		"http://example.com",  // miss
+		"https://example.com", // learned
+		"http://example.com",  // hit, upgraded, then followed
+	} {
+		resp, err := client.Get(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	transport.add("example.com", directive{})
+
+	v := expvar.Get(name)
+	if v == nil {
+		t.Fatal("not published")
+	}
+	var got map[string]int64
+	var top struct {
+		TopUpgraded []HostCount `json:"top_upgraded"`
+	}
+	if err := json.Unmarshal([]byte(v.String()), &top); err != nil {
+		t.Fatal(err)
+	}
+	if want := []HostCount{{"example.com", 1}}; !reflect.DeepEqual(top.TopUpgraded, want) {
+		t.Errorf("top_upgraded = %v; want %v", top.TopUpgraded, want)
+	}
+	// Others are numbers.
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(v.String()), &all); err != nil {
+		t.Fatal(err)
+	}
+	delete(all, "top_upgraded")
+	var bySource map[string]int64
+	if err := json.Unmarshal(all["upgrades_by_source"], &bySource); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int64{"header": 1}; !reflect.DeepEqual(bySource, want) {
+		t.Errorf("upgrades_by_source = %v; want %v", bySource, want)
+	}
+	delete(all, "upgrades_by_source")
+	b, err := json.Marshal(all)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]int64{
+		"upgrades_dynamic": 1,
+		"learned":          1,
+		"coalesced":        1,
+		"expired":          0,
+		"knock_outs":       1,
+		"lookup_hits":      1,
+		"lookup_misses":    1,
+		"dynamic_entries":  0,
+	} {
+		if got[name] != want {
+			t.Errorf("%v = %v; want %v", name, got[name], want)
+		}
+	}
+}
+
+func TestStats(t *testing.T) {
+	transport := New(&fakeTransport{})
+	client := &http.Client{Transport: transport}
+	for _, u := range []string{
+		"https://example.com",    // learned
+		"http://sub.example.com", // upgraded by a dynamic policy, then learned
+		"http://127.0.0.1",       // bypassed
+		"http://localhost",       // bypassed
+		"http://unknown.example", // miss
+	} {
+		resp, err := client.Get(u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	transport.put("old.example.org", newDirective(time.Now().Add(-2*time.Hour), time.Hour, 0))
+	transport.lookup("old.example.org", time.Now())
+
+	got := transport.Stats()
+	want := Stats{
+		Preloaded:        preloadCount(),
+		Dynamic:          2,
+		UpgradesDynamic:  1,
+		Bypassed:         2,
+		Learned:          2,
+		Expired:          1,
+		LookupHits:       1,
+		LookupMisses:     2,
+		UpgradesBySource: map[Source]int64{SourceHeader: 1},
+		TopUpgraded:      []HostCount{{"sub.example.com", 1}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v; want %+v", got, want)
+	}
+}
+
+func TestTopHosts(t *testing.T) {
+	c := newTopHosts(2)
+	for _, host := range []string{"a", "a", "a", "b", "b", "c", "a"} {
+		c.add(host)
+	}
+	// c replaced b with its count 2, plus 1.
+	want := []HostCount{{"a", 4}, {"c", 3}}
+	if got := c.top(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v; want %v", got, want)
+	}
+	if got := newTopHosts(0).top(); got != nil {
+		t.Errorf("disabled got %v", got)
+	}
+}
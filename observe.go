@@ -0,0 +1,128 @@
+package hsts
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// An Observation is a response with Strict-Transport-Security headers seen by
+// a Transport, and what it made of them, see WithObserver.
+type Observation struct {
+	Time   time.Time
+	Host   string   // canonical host the headers are for, that of the request
+	URL    *url.URL // of the request
+	Values []string // raw header values, only the first is processed (section 8.1)
+	Secure bool     // received over a verified secure transport
+
+	// Policy is parsed from the first value, unless it is invalid (Err).
+	Policy Policy
+	Err    error
+
+	// Ignored is why the headers were not noted, e.g. "local host", empty if
+	// they were or were invalid.
+	Ignored string
+}
+
+// Noted tells whether the policy was noted: learned, renewed or removed.
+func (o Observation) Noted() bool {
+	return o.Ignored == "" && o.Err == nil
+}
+
+// WithObserver sets a function called with every response seen with
+// Strict-Transport-Security headers, including over plaintext, and whether
+// they were noted, e.g. to measure HSTS adoption. It observes alongside
+// enforcement, or instead of it WithObserveOnly. The observer must not block.
+func WithObserver(observer func(Observation)) Option {
+	return func(t *Transport) {
+		t.observer = observer
+	}
+}
+
+// WithObserveOnly sets whether the Transport only observes responses for
+// the observer (see WithObserver), and does not enforce HSTS: requests are
+// sent as is, not upgraded nor checked, and policies are not noted.
+// It is disabled by default.
+func WithObserveOnly(enable bool) Option {
+	return func(t *Transport) {
+		t.observeOnly = enable
+	}
+}
+
+// roundTripObserved sends a request as is, only observing the response.
+func (t *Transport) roundTripObserved(req *http.Request) (*http.Response, error) {
+	resp, err := t.wrap.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	if values := resp.Header.Values("Strict-Transport-Security"); len(values) > 0 {
+		t.observe(req, resp, canonicalize(req.URL.Host), values, "observing only")
+	}
+	return resp, nil
+}
+
+// observe tells the observer about headers of a response, if any.
+func (t *Transport) observe(req *http.Request, resp *http.Response, host string, values []string, ignored string) {
+	if t.observer == nil {
+		return
+	}
+	o := Observation{
+		Time:    t.now(),
+		Host:    host,
+		URL:     req.URL,
+		Values:  values,
+		Secure:  t.secure(req, resp),
+		Ignored: ignored,
+	}
+	o.Policy, o.Err = parse(values[0], nil)
+	t.observer(o)
+}
+
+// ObservationWriter returns an observer (see WithObserver) writing each
+// observation to w as a line of JSON, for analytics pipelines, e.g.
+//
+//	{"time":"2024-01-02T03:04:05Z","host":"example.com","url":"https://example.com/","values":["max-age=31536000"],"secure":true,"policy":"max-age=31536000","noted":true}
+//
+// The policy is rendered as a header value, missing if invalid. Write errors
+// are ignored.
+func ObservationWriter(w io.Writer) func(Observation) {
+	var m sync.Mutex // protects enc
+	enc := json.NewEncoder(w)
+	return func(o Observation) {
+		j := observationJSON{
+			Time:    o.Time,
+			Host:    o.Host,
+			Values:  o.Values,
+			Secure:  o.Secure,
+			Ignored: o.Ignored,
+			Noted:   o.Noted(),
+		}
+		if o.URL != nil {
+			j.URL = originURL(o.URL)
+		}
+		if o.Err != nil {
+			j.Error = o.Err.Error()
+		} else {
+			j.Policy = o.Policy.String()
+		}
+		m.Lock()
+		defer m.Unlock()
+		enc.Encode(j)
+	}
+}
+
+// observationJSON is an Observation as written by ObservationWriter.
+type observationJSON struct {
+	Time    time.Time `json:"time"`
+	Host    string    `json:"host"`
+	URL     string    `json:"url"`
+	Values  []string  `json:"values"`
+	Secure  bool      `json:"secure"`
+	Policy  string    `json:"policy,omitempty"`
+	Error   string    `json:"error,omitempty"`
+	Ignored string    `json:"ignored,omitempty"`
+	Noted   bool      `json:"noted"`
+}
@@ -0,0 +1,315 @@
+package hsts
+
+import (
+	"crypto/x509"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// An Option changes the default behavior of a Transport, see New.
+type Option func(*Transport)
+
+// A Match is an algorithm to match a host against known HSTS hosts (section 8.2).
+// They only differ when a host and its superdomains are known HSTS hosts.
+type Match int
+
+const (
+	// MostSpecific matches the host itself (congruent match) first, then the
+	// nearest superdomain including subdomains (superdomain match).
+	// It is the default.
+	MostSpecific Match = iota
+
+	// NearestSuperdomain matches the nearest superdomain including subdomains
+	// first, then the host itself: a superdomain governs its subdomains even
+	// if they have a policy of their own.
+	NearestSuperdomain
+
+	// Exact only matches the host itself, ignoring includeSubDomains.
+	Exact
+)
+
+// WithMatch sets the algorithm to match hosts against known HSTS hosts.
+func WithMatch(m Match) Option {
+	return func(t *Transport) {
+		t.match = m
+	}
+}
+
+// WithLocalExclusion sets whether local hosts are excluded: they are never
+// upgraded and HSTS is never noted for them. It is enabled by default.
+// Local hosts are localhost, loopback and private addresses (RFC 1918, RFC 4193),
+// and .local or .internal names.
+func WithLocalExclusion(exclude bool) Option {
+	return func(t *Transport) {
+		t.excludeLocal = exclude
+	}
+}
+
+// WithProxyCheck sets whether upgrades consult the Proxy function of the wrapped
+// transport (if it is an *http.Transport) for the upgraded URL, so that a
+// request which cannot go through the proxy once upgraded fails right away,
+// instead of after a redirect. It is disabled by default.
+func WithProxyCheck(check bool) Option {
+	return func(t *Transport) {
+		t.proxyCheck = check
+	}
+}
+
+// WithHeaderHook sets a function called with all the Strict-Transport-Security
+// header values of a response, for the host they would be noted for.
+// Only responses received over secure transport are considered, and only the
+// first value is processed (section 8.1). The hook must not block.
+func WithHeaderHook(hook func(host string, values []string)) Option {
+	return func(t *Transport) {
+		t.headerHook = hook
+	}
+}
+
+// An Upgrade describes a request upgraded to HTTPS, see WithUpgradeHook.
+type Upgrade struct {
+	Request     *http.Request // as made by the caller
+	URL         *url.URL      // upgraded URL, redirected to or sent in place
+	Host        string        // known HSTS host whose policy applies
+	Preloaded   bool          // the policy is from the preload list, not learned
+	HTTPSRecord bool          // unknown host with a DNS HTTPS record, see WithHTTPSRecords
+	Source      Source        // of the policy which applies, see Origin
+	InPlace     bool          // sent upgraded instead of redirected, see RoundTrip
+	Err         error         // if not nil the request failed instead, see WithProxyCheck
+}
+
+// WithInPlaceUpgrades sets whether requests to upgrade are always sent
+// upgraded by RoundTrip, instead of answered with a redirect to HTTPS which
+// clients follow. HTTP stacks not following redirects (setting CheckRedirect
+// to stop them, like many SDKs and retrying clients) would otherwise return
+// the redirect or fail on it. The response is then that to the upgraded
+// request, with its URL in the Request of the response.
+func WithInPlaceUpgrades(enable bool) Option {
+	return func(t *Transport) {
+		t.inPlace = enable
+	}
+}
+
+// WithUpgradeHook sets a hook called when a request is upgraded to HTTPS, or
+// when it fails to be. It is called on the RoundTrip goroutine before the
+// upgraded request is sent, for instance to annotate the trace span in the
+// request context (see package hstsotel), and must not modify the request.
+func WithUpgradeHook(hook func(Upgrade)) Option {
+	return func(t *Transport) {
+		t.upgradeHook = hook
+	}
+}
+
+// WithLogger sets a logger for what the Transport does: upgrades, headers
+// ignored and why (debug level), policies learned or removed, invalid headers
+// and failed upgrades (info level). Nothing is logged by default.
+func WithLogger(logger *slog.Logger) Option {
+	return func(t *Transport) {
+		t.logger = logger
+	}
+}
+
+// WithRejectConflicting sets whether responses with several, different
+// Strict-Transport-Security header values are ignored instead of processing
+// the first one. It is disabled by default.
+func WithRejectConflicting(reject bool) Option {
+	return func(t *Transport) {
+		t.rejectConflicting = reject
+	}
+}
+
+// A KnockOut is the scope of removal when a known HSTS host sends max-age=0,
+// which section 6.1.1 says signals to forget about it.
+type KnockOut int
+
+const (
+	// KnockOutHost removes only the entry of the host itself. It is the default.
+	KnockOutHost KnockOut = iota
+
+	// KnockOutSubdomains also removes the entries learned for its subdomains,
+	// e.g. those which were relying on it including subdomains.
+	// Preloaded entries are not removed.
+	KnockOutSubdomains
+)
+
+// WithKnockOut sets the scope of removal when a host sends max-age=0.
+func WithKnockOut(k KnockOut) Option {
+	return func(t *Transport) {
+		t.knockOut = k
+	}
+}
+
+// WithKnockOutProtection protects the entries of these domains and their
+// subdomains from knock-outs: max-age=0 is ignored for them, with a warning
+// logged, and they are not removed with subdomains of another host (see
+// KnockOutSubdomains) nor by changes applied (see Apply). It is meant for
+// critical hosts, e.g. one's own API domains, whose single misconfigured
+// deployment would otherwise turn HSTS off in all clients. Their policies
+// still expire, and are renewed as usual.
+func WithKnockOutProtection(domains ...string) Option {
+	return func(t *Transport) {
+		t.knockOutProtected = append(t.knockOutProtected, canonicalizeAll(domains)...)
+	}
+}
+
+// A PublicSuffixPolicy is what a Transport does with a Strict-Transport-Security
+// header including subdomains from a public suffix (e.g. github.io or
+// s3.amazonaws.com), under which anyone can register names: it would force
+// HTTPS on the unrelated sites of all its tenants, which only the preload
+// list should do (e.g. for TLDs).
+type PublicSuffixPolicy int
+
+const (
+	// PublicSuffixHostOnly learns the policy for the host alone, as if it did
+	// not include subdomains. It is the default.
+	PublicSuffixHostOnly PublicSuffixPolicy = iota
+
+	// PublicSuffixAllow learns the policy including subdomains, as sent.
+	PublicSuffixAllow
+
+	// PublicSuffixRefuse ignores the header, learning nothing for the host.
+	PublicSuffixRefuse
+)
+
+// WithPublicSuffixPolicy sets what to do with policies including subdomains
+// received from a public suffix. The hook, if not nil, is called with each
+// such policy whatever is done with it, to warn about it, and a warning is
+// logged. Policies added (see AddHosts), applied (see Apply) or read from the
+// Storage are never refused, but also include subdomains only with
+// PublicSuffixAllow.
+func WithPublicSuffixPolicy(p PublicSuffixPolicy, hook func(host string, p Policy)) Option {
+	return func(t *Transport) {
+		t.publicSuffix = p
+		t.publicSuffixHook = hook
+	}
+}
+
+// WithLearnAllow restricts learning of dynamic policies (including knock-outs)
+// to these domains and their subdomains. Preloaded policies still apply.
+func WithLearnAllow(domains ...string) Option {
+	return func(t *Transport) {
+		t.learnAllow = append(t.learnAllow, canonicalizeAll(domains)...)
+		if t.learnAllow == nil {
+			t.learnAllow = []string{} // allow nothing
+		}
+	}
+}
+
+// WithLearnDeny prevents learning of dynamic policies (including knock-outs)
+// for these domains and their subdomains.
+func WithLearnDeny(domains ...string) Option {
+	return func(t *Transport) {
+		t.learnDeny = append(t.learnDeny, canonicalizeAll(domains)...)
+	}
+}
+
+func canonicalizeAll(hosts []string) []string {
+	var c []string
+	for _, host := range hosts {
+		c = append(c, canonicalize(host))
+	}
+	return c
+}
+
+// WithLongLivedPreload sets whether policies requesting preload and meeting the
+// preload list requirements (includeSubDomains and max-age of at least
+// MinPreloadMaxAge) are kept without expiry, approximating their inclusion in
+// the preload list. They are still removed with max-age=0.
+// It is disabled by default.
+func WithLongLivedPreload(enable bool) Option {
+	return func(t *Transport) {
+		t.longLivedPreload = enable
+	}
+}
+
+// WithPreloadList sets whether the preload list applies, e.g. to turn it off
+// in shipped binaries (see FromEnv). Building with the hsts_nopreload tag
+// leaves it out of the binary instead. It is enabled by default.
+func WithPreloadList(enable bool) Option {
+	return func(t *Transport) {
+		t.noPreload = !enable
+	}
+}
+
+// WithMinUpdateInterval sets the minimum interval between updates of the
+// policy of a host, so that a server changing it on every response (e.g.
+// flapping between max-age values) does not cause constant writes and
+// notifications (see State): until then, other policies received for the
+// host are ignored. Knock-outs (max-age=0) are always honored.
+// It is 0 by default, as section 8.1.1 requires updating the policy on every
+// change. Regardless, a policy received again the same is only renewed once a
+// minute, or at the interval if longer, or at half its max-age if shorter.
+func WithMinUpdateInterval(d time.Duration) Option {
+	return func(t *Transport) {
+		t.minUpdateInterval = d
+	}
+}
+
+// WithShards sets the number of shards of the state, each with its own lock,
+// to reduce contention when many goroutines learn policies at once.
+// There is a single shard by default. It is ignored WithStore.
+func WithShards(n int) Option {
+	return func(t *Transport) {
+		if n < 1 {
+			n = 1
+		}
+		t.shards = make([]*shard, n) // filled by New
+	}
+}
+
+// WithNegativeCache sets how many hosts without a policy are remembered, so
+// that hot hosts without HSTS are not looked up again on every request.
+// Learning a policy forgets the host and its subdomains.
+// It is 1024 by default and 0 disables it.
+func WithNegativeCache(size int) Option {
+	return func(t *Transport) {
+		t.negativeSize = size
+	}
+}
+
+// WithExpvar publishes counters of what the Transport does under an expvar
+// map of that name, so that they show in /debug/vars: upgrades_preloaded,
+// upgrades_dynamic, bypassed, fallbacks, learned, added, expired, knock_outs,
+// coalesced, evicted, storage_errors, lookup_hits, lookup_misses,
+// upgrades_by_source, dynamic_entries and top_upgraded. See Stats for their
+// meaning.
+// Like expvar.Publish, New panics if the name is already used.
+func WithExpvar(name string) Option {
+	return func(t *Transport) {
+		t.expvarName = name
+	}
+}
+
+// WithTopUpgraded sets how many hosts are counted when requested in plaintext
+// and upgraded, to find which are still used with http:// URLs (see Stats).
+// When more hosts are upgraded, those upgraded the least are replaced, and the
+// counts of new hosts may be overestimated by as much as those they replace.
+// It is 100 by default and 0 disables it.
+func WithTopUpgraded(size int) Option {
+	return func(t *Transport) {
+		t.topSize = size
+	}
+}
+
+// WithClock sets the function telling the current time, time.Now by default,
+// for tests to control when policies are received and expire.
+func WithClock(now func() time.Time) Option {
+	return func(t *Transport) {
+		t.now = now
+	}
+}
+
+// WithTestCertificates also trusts certificates signed by the roots of pool
+// when deciding whether a response was received securely enough to learn its
+// Strict-Transport-Security header, for integration tests against servers
+// with test certificates (e.g. httptest.Server) through a wrapped transport
+// which does not verify them itself (e.g. InsecureSkipVerify). The chain must
+// still verify for the host of the request, against pool instead of the
+// system roots. It is nil by default: only chains verified by the wrapped
+// transport count, as must be the case in production.
+func WithTestCertificates(pool *x509.CertPool) Option {
+	return func(t *Transport) {
+		t.testRoots = pool
+	}
+}
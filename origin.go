@@ -0,0 +1,169 @@
+package hsts
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sync"
+)
+
+// A Source is where a policy comes from.
+type Source int
+
+const (
+	// SourceUnknown is the source of policies stored without one, e.g. by
+	// earlier versions.
+	SourceUnknown Source = iota
+
+	// SourcePreload is the source of preloaded policies.
+	SourcePreload
+
+	// SourceHeader is the source of policies learned from a
+	// Strict-Transport-Security header.
+	SourceHeader
+
+	// SourceHTTPSRecord is the source of policies noted for DNS HTTPS
+	// records, see WithHTTPSRecords.
+	SourceHTTPSRecord
+
+	// SourceAdded is the source of policies added with AddHosts.
+	SourceAdded
+
+	// SourceFile is the source of policies loaded from a file, e.g. a HAR
+	// capture (see package hstshar).
+	SourceFile
+)
+
+var sourceNames = [...]string{"unknown", "preload", "header", "https-record", "added", "file"}
+
+func (s Source) String() string {
+	if s < 0 || int(s) >= len(sourceNames) {
+		return fmt.Sprintf("Source(%d)", int(s))
+	}
+	return sourceNames[s]
+}
+
+// MarshalText marshals a source as its name, for JSON.
+func (s Source) MarshalText() ([]byte, error) {
+	if s < 0 || int(s) >= len(sourceNames) {
+		return nil, fmt.Errorf("hsts: invalid source %d", int(s))
+	}
+	return []byte(sourceNames[s]), nil
+}
+
+// UnmarshalText unmarshals a source from its name.
+func (s *Source) UnmarshalText(text []byte) error {
+	for i, name := range sourceNames {
+		if string(text) == name {
+			*s = Source(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("hsts: unknown source %q", text)
+}
+
+// An Origin is where a Transport learned a dynamic policy, for incident
+// response to tell how an entry came to be, along with Entry.Received.
+// Entries keep it through Storage and changes applied (see Apply).
+type Origin struct {
+	Source Source
+	URL    string `json:",omitempty"` // of the response with the header, without credentials, query and fragment
+	Addr   string `json:",omitempty"` // IP address the response came from, if known, see WithOriginAddrs
+}
+
+// originURL returns a URL as kept in an Origin: query strings and
+// credentials may be secrets.
+func originURL(u *url.URL) string {
+	o := url.URL{Scheme: u.Scheme, Host: u.Host, Path: u.Path, RawPath: u.RawPath}
+	return o.String()
+}
+
+// meta is what is rarely in a directive, or not needed to apply it, so that
+// directives stay small.
+type meta struct {
+	extensions map[string]string // unknown directives, nil if none
+	origin     Origin
+}
+
+// withMeta returns a directive with extensions and an origin, both kept as
+// is.
+func (d directive) withMeta(extensions map[string]string, origin Origin) directive {
+	if extensions == nil && origin == (Origin{}) {
+		d.meta = nil
+		return d
+	}
+	d.meta = &meta{extensions: extensions, origin: origin}
+	return d
+}
+
+// extensions returns the unknown directives of a directive, not to modify.
+func (d directive) extensions() map[string]string {
+	if d.meta == nil {
+		return nil
+	}
+	return d.meta.extensions
+}
+
+// origin returns where a directive was learned.
+func (d directive) origin() Origin {
+	if d.preloaded() {
+		return Origin{Source: SourcePreload}
+	}
+	if d.meta == nil {
+		return Origin{}
+	}
+	return d.meta.origin
+}
+
+// WithOriginAddrs sets whether the IP address a policy was learned from is
+// noted in its Origin. It is disabled by default: it traces the connection
+// of every HTTPS request, which allocates.
+func WithOriginAddrs(note bool) Option {
+	return func(t *Transport) {
+		t.originAddrs = note
+	}
+}
+
+type remoteKey struct{}
+
+// A remote is the address a request was sent to, noted by traceRemote.
+type remote struct {
+	m    sync.Mutex // protects addr
+	addr string
+}
+
+// traceRemote returns an HTTPS request whose connection's remote IP address
+// is noted, for remoteAddr.
+func traceRemote(req *http.Request) *http.Request {
+	if req.URL.Scheme != "https" {
+		return req
+	}
+	r := new(remote)
+	ctx := context.WithValue(req.Context(), remoteKey{}, r)
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			host, _, err := net.SplitHostPort(info.Conn.RemoteAddr().String())
+			if err != nil {
+				return
+			}
+			r.m.Lock()
+			r.addr = host
+			r.m.Unlock()
+		},
+	})
+	return req.WithContext(ctx)
+}
+
+// remoteAddr returns the remote IP address noted for a request, if any.
+func remoteAddr(req *http.Request) string {
+	r, ok := req.Context().Value(remoteKey{}).(*remote)
+	if !ok {
+		return ""
+	}
+	r.m.Lock()
+	defer r.m.Unlock()
+	return r.addr
+}
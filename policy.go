@@ -0,0 +1,116 @@
+package hsts
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A Policy is an HSTS policy, as set by a Strict-Transport-Security header.
+type Policy struct {
+	MaxAge            time.Duration
+	IncludeSubDomains bool
+	Preload           bool              // requests inclusion in the preload list
+	Extensions        map[string]string // unknown directives, lowercased name -> value
+}
+
+// String renders the policy as a Strict-Transport-Security header value.
+// Extensions are rendered sorted by name, quoted if needed.
+func (p Policy) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "max-age=%d", int64(p.MaxAge/time.Second))
+	if p.IncludeSubDomains {
+		b.WriteString("; includeSubDomains")
+	}
+	if p.Preload {
+		b.WriteString("; preload")
+	}
+	var names []string
+	for name := range p.Extensions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		b.WriteString("; ")
+		b.WriteString(name)
+		if v := p.Extensions[name]; v != "" {
+			b.WriteString("=")
+			b.WriteString(quote(v))
+		}
+	}
+	return b.String()
+}
+
+// quote quotes a directive value unless it is a token.
+func quote(v string) string {
+	if isToken(v) {
+		return v
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(v); i++ {
+		if v[i] == '"' || v[i] == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(v[i])
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// MinPreloadMaxAge is the minimum max-age to be accepted in the preload list.
+const MinPreloadMaxAge = 365 * 24 * time.Hour
+
+// Header validates the policy and renders it as a Strict-Transport-Security
+// header value for servers to send.
+// It is rejected if it would be invalid, or if preload is requested without
+// meeting the preload list requirements (https://hstspreload.org).
+func (p Policy) Header() (string, error) {
+	if p.MaxAge < 0 {
+		return "", errors.New("hsts: negative max-age")
+	}
+	if p.MaxAge%time.Second != 0 {
+		return "", errors.New("hsts: max-age is not a whole number of seconds")
+	}
+	for name, v := range p.Extensions {
+		switch strings.ToLower(name) {
+		case "max-age", "includesubdomains", "preload":
+			return "", fmt.Errorf("hsts: extension %v is a known directive", name)
+		}
+		if !isToken(name) {
+			return "", fmt.Errorf("hsts: extension name %q is not a token", name)
+		}
+		if strings.ContainsAny(v, "\x00\r\n") {
+			return "", fmt.Errorf("hsts: extension %v has an invalid value", name)
+		}
+	}
+	if p.Preload {
+		if !p.IncludeSubDomains {
+			return "", errors.New("hsts: preload requires includeSubDomains")
+		}
+		if p.MaxAge < MinPreloadMaxAge {
+			return "", fmt.Errorf("hsts: preload requires max-age of at least %d", int64(MinPreloadMaxAge/time.Second))
+		}
+	}
+	return p.String(), nil
+}
+
+// An Entry is what a Transport knows about an HSTS host.
+type Entry struct {
+	Host      string    // known HSTS host, it may be a superdomain of the one looked up
+	Preloaded bool      // from the preload list, Policy only has IncludeSubDomains
+	LongLived bool      // requested preload and does not expire, see WithLongLivedPreload
+	Received  time.Time // when the policy was noted to the second (see WithServerDate), zero if preloaded
+	Origin    Origin    // where the policy was noted
+	Policy
+}
+
+// Expires returns when the entry expires, zero if preloaded or long-lived.
+func (e Entry) Expires() time.Time {
+	if e.Preloaded || e.LongLived {
+		return time.Time{}
+	}
+	return e.Received.Add(e.MaxAge)
+}
@@ -0,0 +1,62 @@
+package hsts
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPolicyString(t *testing.T) {
+	for _, tt := range []struct {
+		policy Policy
+		want   string
+	}{
+		{Policy{}, "max-age=0"},
+		{Policy{MaxAge: 1234 * time.Second}, "max-age=1234"},
+		{Policy{MaxAge: time.Hour, IncludeSubDomains: true}, "max-age=3600; includeSubDomains"},
+		{
+			Policy{MaxAge: MinPreloadMaxAge, IncludeSubDomains: true, Preload: true},
+			"max-age=31536000; includeSubDomains; preload",
+		},
+		{
+			Policy{MaxAge: time.Second, Extensions: map[string]string{"b": "", "a": "x y", "c": `q"`}},
+			`max-age=1; a="x y"; b; c="q\""`,
+		},
+	} {
+		got := tt.policy.String()
+		if got != tt.want {
+			t.Errorf("%+v.String() = %q; want %q", tt.policy, got, tt.want)
+		}
+		// What we render must be valid and parse back the same.
+		if err := ValidateHeader(got); err != nil {
+			t.Errorf("%+v.String() is invalid: %v", tt.policy, err)
+		}
+		p, err := ParseHeader(got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.String() != got {
+			t.Errorf("ParseHeader(%q) renders back as %q", got, p.String())
+		}
+	}
+}
+
+func TestPolicyHeader(t *testing.T) {
+	for _, tt := range []struct {
+		policy Policy
+		valid  bool
+	}{
+		{Policy{MaxAge: time.Hour}, true},
+		{Policy{MaxAge: MinPreloadMaxAge, IncludeSubDomains: true, Preload: true}, true},
+		{Policy{MaxAge: -time.Second}, false},
+		{Policy{MaxAge: 1500 * time.Millisecond}, false},
+		{Policy{MaxAge: MinPreloadMaxAge, Preload: true}, false},                              // no includeSubDomains
+		{Policy{MaxAge: MinPreloadMaxAge / 2, IncludeSubDomains: true, Preload: true}, false}, // max-age too short
+		{Policy{MaxAge: time.Hour, Extensions: map[string]string{"max-age": "1"}}, false},
+		{Policy{MaxAge: time.Hour, Extensions: map[string]string{"a b": ""}}, false},
+		{Policy{MaxAge: time.Hour, Extensions: map[string]string{"a": "\r\n"}}, false},
+	} {
+		if _, err := tt.policy.Header(); (err == nil) != tt.valid {
+			t.Errorf("%+v.Header() got error %v; want valid %v", tt.policy, err, tt.valid)
+		}
+	}
+}
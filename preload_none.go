@@ -0,0 +1,10 @@
+//go:build hsts_nopreload
+// +build hsts_nopreload
+
+package hsts
+
+// Built with hsts_nopreload: no preloaded sites.
+
+const preloadIncludeSubDomains = "\n"
+
+const preloadHostOnly = "\n"
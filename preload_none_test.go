@@ -0,0 +1,21 @@
+//go:build hsts_nopreload
+// +build hsts_nopreload
+
+package hsts
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNoPreloadedTLDs(t *testing.T) {
+	transport := New(nil)
+	transport.add("example.com", newDirective(time.Now(), time.Hour, 0))
+	transport.add("example.com", newDirective(time.Now(), 0, 0))
+	if tlds := PreloadedTLDs(); len(tlds) != 0 {
+		t.Errorf("PreloadedTLDs() = %v; want none", tlds)
+	}
+	if preloadedTLDs != nil {
+		t.Error("preload list scanned for top-level domains")
+	}
+}
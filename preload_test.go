@@ -1,8 +1,13 @@
+//go:build !hsts_nopreload
+// +build !hsts_nopreload
+
 package hsts
 
 import (
 	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 )
 
 type checkTransport struct{}
@@ -25,6 +30,8 @@ func TestPreloaded(t *testing.T) {
 		"x.accounts.google.com",
 		"login.yahoo.com",
 		"x.login.yahoo.com",
+		"accounts.google.com.", // absolute FQDN
+		"x.亚马逊",                // IDN, preloaded as xn--jlq480n2rg
 	} {
 		resp, err := client.Get("http://" + tt)
 		if err != nil {
@@ -37,11 +44,24 @@ func TestPreloaded(t *testing.T) {
 	}
 }
 
+func TestLookupPreloaded(t *testing.T) {
+	e, ok := New(nil).Lookup("x.accounts.google.com")
+	if !ok {
+		t.Fatal("x.accounts.google.com is not known")
+	}
+	if e.Host != "accounts.google.com" || !e.Preloaded || !e.IncludeSubDomains {
+		t.Errorf("got %+v; want preloaded accounts.google.com including subdomains", e)
+	}
+	if !e.Expires().IsZero() {
+		t.Errorf("got expiry %v; want none", e.Expires())
+	}
+}
+
 type deleteTransport struct{}
 
 func (f *deleteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	if req.URL.Scheme == "https" {
-		return reply(req, "HTTP/1.1 200 OK\r\n"+
+		return secureReply(req, "HTTP/1.1 200 OK\r\n"+
 			"Strict-Transport-Security: max-age=0\r\n\r\n")
 	}
 	return reply(req, "HTTP/1.1 202 OK\r\n\r\n")
@@ -84,3 +104,140 @@ func TestPersistence(t *testing.T) {
 		t.Errorf("3: %s is no longer preloaded", domain)
 	}
 }
+
+func TestPreloadedTLDs(t *testing.T) {
+	tlds := PreloadedTLDs()
+	found := false
+	for i, tld := range tlds {
+		if i > 0 && tlds[i-1] >= tld {
+			t.Errorf("not sorted: %v before %v", tlds[i-1], tld)
+		}
+		if tld == "dev" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("dev is not a preloaded TLD")
+	}
+
+	client := http.DefaultClient
+	client.Transport = New(&checkTransport{})
+	for _, tt := range []string{
+		"dev",
+		"example.dev",
+		"x.example.dev",
+	} {
+		resp, err := client.Get("http://" + tt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("%s is not preloaded", tt)
+		}
+	}
+}
+
+func TestKnockOutKeepsPreloaded(t *testing.T) {
+	transport := New(&deleteTransport{}, WithKnockOut(KnockOutSubdomains))
+	req, err := http.NewRequest("GET", "https://google.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if _, ok := transport.Lookup("accounts.google.com"); !ok {
+		t.Error("preloaded accounts.google.com was removed by knock-out of google.com")
+	}
+}
+
+func BenchmarkFindPreloaded(b *testing.B) {
+	transport := New(nil)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, _, ok := transport.lookup("a.b.c.accounts.google.com", time.Now()); !ok {
+			b.Fatal("not found")
+		}
+	}
+}
+
+func TestPreloadFind(t *testing.T) {
+	n := 0
+	for list, want := range map[string]directive{
+		preloadIncludeSubDomains: preloadedIncludeSubDomains,
+		preloadHostOnly:          preloadedHostOnly,
+	} {
+		each(list, func(host string) {
+			n++
+			if d, ok := preloadFind(host); !ok || d.flags != want.flags {
+				t.Errorf("preloadFind(%v) = %+v; want %+v", host, d, want)
+			}
+		})
+	}
+	if n < 50000 {
+		t.Errorf("preload list has %v hosts; want at least 50000", n)
+	}
+	if got := preloadCount(); got != n {
+		t.Errorf("preloadCount() = %v; want %v", got, n)
+	}
+	for _, host := range []string{"", "example.com", "google.com.invalid"} {
+		if _, ok := preloadFind(host); ok {
+			t.Errorf("preloadFind(%v) found", host)
+		}
+	}
+}
+
+func TestPreloadedAfterExpiry(t *testing.T) {
+	transport := New(nil)
+	transport.put("accounts.google.com", newDirective(time.Now().Add(-2*time.Hour), time.Hour, 0))
+	e, ok := transport.Lookup("accounts.google.com")
+	if !ok || !e.Preloaded {
+		t.Errorf("got %+v, %v; want preloaded once the dynamic entry expired", e, ok)
+	}
+}
+
+func TestRedirectHandlerPreloaded(t *testing.T) {
+	rec := httptest.NewRecorder()
+	New(nil).RedirectHandler(nil).ServeHTTP(rec, httptest.NewRequest("GET", "http://foo.dev/", nil))
+	if rec.Code != http.StatusPermanentRedirect || rec.Header().Get("Location") != "https://foo.dev/" {
+		t.Errorf("got %v to %q; want 308 to HTTPS", rec.Code, rec.Header().Get("Location"))
+	}
+}
+
+func TestNewConstant(t *testing.T) {
+	if n := testing.AllocsPerRun(10, func() { New(nil) }); n > 20 {
+		t.Errorf("New() allocates %v times; want it independent of the preload list", n)
+	}
+}
+
+func BenchmarkNew(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		New(nil)
+	}
+}
+
+func TestHTTPFallbackPreloaded(t *testing.T) {
+	transport := New(&downTransport{}, WithHTTPFallback(true, nil))
+	client := &http.Client{Transport: transport}
+	if _, err := client.Get("http://accounts.google.com/"); err == nil {
+		t.Error("preloaded accounts.google.com fell back to plaintext")
+	}
+	if n := transport.Stats().Fallbacks; n != 0 {
+		t.Errorf("got %v fallbacks; want 0", n)
+	}
+}
+
+func TestPreloadListDisabledSharedStore(t *testing.T) {
+	without := New(nil, WithPreloadList(false))
+	with := New(nil, WithStore(without.Store()))
+	if _, ok := without.Lookup("accounts.google.com"); ok {
+		t.Error("preload list applies WithPreloadList(false)")
+	}
+	if _, ok := with.Lookup("accounts.google.com"); !ok {
+		t.Error("accounts.google.com not preloaded after a lookup without the preload list")
+	}
+}
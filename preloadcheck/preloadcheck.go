@@ -0,0 +1,216 @@
+// Package preloadcheck checks whether a domain meets the requirements to be
+// submitted to the HSTS preload list (https://hstspreload.org), so that site
+// operators can validate it before submitting. A Report tells what must change,
+// in Markdown or JSON.
+package preloadcheck
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/StalkR/hsts"
+	"golang.org/x/net/publicsuffix"
+)
+
+// An Issue is a problem found with a domain.
+type Issue struct {
+	Code    string // stable identifier, e.g. header.no_preload
+	Message string
+}
+
+func (i Issue) String() string {
+	return i.Code + ": " + i.Message
+}
+
+// A Result is the outcome of checking a domain.
+type Result struct {
+	Domain   string
+	Errors   []Issue // requirements not met
+	Warnings []Issue // problems not preventing submission
+}
+
+// Eligible returns whether the domain meets the requirements.
+func (r *Result) Eligible() bool {
+	return len(r.Errors) == 0
+}
+
+func (r *Result) errorf(code, format string, args ...interface{}) {
+	r.Errors = append(r.Errors, Issue{Code: code, Message: fmt.Sprintf(format, args...)})
+}
+
+func (r *Result) warnf(code, format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, Issue{Code: code, Message: fmt.Sprintf(format, args...)})
+}
+
+// A Checker checks domains. The zero value is ready to use.
+type Checker struct {
+	// Client makes requests, http.DefaultClient if nil.
+	// Redirects are never followed by it.
+	Client *http.Client
+
+	// LookupHost resolves hosts, net.DefaultResolver.LookupHost if nil.
+	// It is used to tell whether the www subdomain exists.
+	LookupHost func(ctx context.Context, host string) ([]string, error)
+
+	// Timeout bounds each request, 10 seconds if zero.
+	Timeout time.Duration
+
+	// Subdomains are crawled by Report, DefaultSubdomains if nil.
+	Subdomains []string
+
+	// Concurrency is how many subdomains Report crawls at once at most,
+	// 4 if zero.
+	Concurrency int
+}
+
+// Check checks a domain with the zero Checker.
+func Check(ctx context.Context, domain string) *Result {
+	var c Checker
+	return c.Check(ctx, domain)
+}
+
+// Check checks that a domain:
+//   - is a registrable domain, not a subdomain or a public suffix,
+//   - serves a valid certificate on HTTPS,
+//   - serves a Strict-Transport-Security header on the HTTPS root with a
+//     max-age of at least a year, includeSubDomains and preload,
+//   - if it serves HTTP, redirects it to HTTPS on the same host first,
+//   - if the www subdomain exists, serves it over HTTPS.
+func (c *Checker) Check(ctx context.Context, domain string) *Result {
+	domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+	r := &Result{Domain: domain}
+	registrable, err := publicsuffix.EffectiveTLDPlusOne(domain)
+	if err != nil {
+		r.errorf("domain.invalid", "%v is not a registrable domain: %v", domain, err)
+		return r
+	}
+	if registrable != domain {
+		r.errorf("domain.subdomain", "%v is a subdomain, only %v can be submitted", domain, registrable)
+		return r
+	}
+	c.checkHTTPS(ctx, r)
+	c.checkHTTP(ctx, r)
+	c.checkWWW(ctx, r)
+	return r
+}
+
+// get makes a request without following redirects.
+func (c *Checker) get(ctx context.Context, u string) (*http.Response, error) {
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := http.DefaultClient
+	if c.Client != nil {
+		client = c.Client
+	}
+	noRedirect := *client
+	noRedirect.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	resp, err := noRedirect.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return resp, nil
+}
+
+func (c *Checker) checkHTTPS(ctx context.Context, r *Result) {
+	resp, err := c.get(ctx, "https://"+r.Domain+"/")
+	if err != nil {
+		if isCertificateError(err) {
+			r.errorf("tls.invalid_certificate", "invalid certificate: %v", err)
+		} else {
+			r.errorf("https.unavailable", "cannot connect over HTTPS: %v", err)
+		}
+		return
+	}
+	checkHeader(r, resp.Header.Values("Strict-Transport-Security"))
+}
+
+// checkHeader checks the Strict-Transport-Security header of the HTTPS root.
+func checkHeader(r *Result, values []string) {
+	switch len(values) {
+	case 0:
+		r.errorf("header.missing", "no Strict-Transport-Security header on the HTTPS root")
+		return
+	case 1:
+	default:
+		r.errorf("header.multiple", "multiple Strict-Transport-Security headers on the HTTPS root")
+		return
+	}
+	if err := hsts.ValidateHeader(values[0]); err != nil {
+		r.warnf("header.syntax", "%v", err)
+	}
+	p, err := hsts.ParseHeader(values[0])
+	if err != nil {
+		r.errorf("header.invalid", "%v", err)
+		return
+	}
+	if p.MaxAge < hsts.MinPreloadMaxAge {
+		r.errorf("header.max_age_too_low", "max-age is %d, it must be at least %d", int64(p.MaxAge/time.Second), int64(hsts.MinPreloadMaxAge/time.Second))
+	}
+	if !p.IncludeSubDomains {
+		r.errorf("header.no_include_subdomains", "the includeSubDomains directive is missing")
+	}
+	if !p.Preload {
+		r.errorf("header.no_preload", "the preload directive is missing")
+	}
+}
+
+func (c *Checker) checkHTTP(ctx context.Context, r *Result) {
+	resp, err := c.get(ctx, "http://"+r.Domain+"/")
+	if err != nil {
+		r.warnf("http.unavailable", "cannot connect over HTTP, so no redirect to HTTPS is checked: %v", err)
+		return
+	}
+	location, err := resp.Location()
+	if err != nil || resp.StatusCode < 300 || resp.StatusCode >= 400 {
+		r.errorf("redirect.missing", "HTTP does not redirect to HTTPS")
+		return
+	}
+	// Redirecting elsewhere first, e.g. to www, means the HSTS header of the
+	// domain itself is never seen by browsers following the redirect.
+	if location.Scheme != "https" || !strings.EqualFold(location.Hostname(), r.Domain) {
+		r.errorf("redirect.not_same_host", "HTTP first redirects to %v instead of HTTPS on %v", location, r.Domain)
+	}
+}
+
+func (c *Checker) checkWWW(ctx context.Context, r *Result) {
+	www := "www." + r.Domain
+	lookupHost := net.DefaultResolver.LookupHost
+	if c.LookupHost != nil {
+		lookupHost = c.LookupHost
+	}
+	if _, err := lookupHost(ctx, www); err != nil {
+		return // does not exist
+	}
+	if _, err := c.get(ctx, (&url.URL{Scheme: "https", Host: www, Path: "/"}).String()); err != nil {
+		r.errorf("www.no_https", "%v exists but cannot be reached over HTTPS: %v", www, err)
+	}
+}
+
+// isCertificateError returns whether a request failed verifying the certificate.
+func isCertificateError(err error) bool {
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostname x509.HostnameError
+	var invalid x509.CertificateInvalidError
+	var verification *tls.CertificateVerificationError
+	return errors.As(err, &unknownAuthority) || errors.As(err, &hostname) ||
+		errors.As(err, &invalid) || errors.As(err, &verification)
+}
@@ -0,0 +1,115 @@
+package preloadcheck
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// checker returns a Checker sending requests for any host to servers with
+// the given handlers, on HTTPS with a certificate valid for example.com.
+// A nil handler for HTTP means it is not served. The www subdomain exists if
+// www is "up" or "down", and is only served if "up".
+func checker(t *testing.T, https, plain http.Handler, www string) *Checker {
+	tlsServer := httptest.NewTLSServer(https)
+	t.Cleanup(tlsServer.Close)
+	plainAddr := "127.0.0.1:1" // nothing listens
+	if plain != nil {
+		plainServer := httptest.NewServer(plain)
+		t.Cleanup(plainServer.Close)
+		plainAddr = plainServer.Listener.Addr().String()
+	}
+	transport := tlsServer.Client().Transport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, _ := net.SplitHostPort(addr)
+		if host == "www.example.com" && www == "down" {
+			return nil, errors.New("connection refused")
+		}
+		if port == "443" {
+			addr = tlsServer.Listener.Addr().String()
+		} else {
+			addr = plainAddr
+		}
+		var d net.Dialer
+		return d.DialContext(ctx, network, addr)
+	}
+	return &Checker{
+		Client: &http.Client{Transport: transport},
+		LookupHost: func(ctx context.Context, host string) ([]string, error) {
+			if www != "" {
+				return []string{"127.0.0.1"}, nil
+			}
+			return nil, errors.New("no such host")
+		},
+	}
+}
+
+func header(value string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Strict-Transport-Security", value)
+	})
+}
+
+func redirect(to string) http.Handler {
+	return http.RedirectHandler(to, http.StatusMovedPermanently)
+}
+
+func codes(issues []Issue) []string {
+	var codes []string
+	for _, i := range issues {
+		codes = append(codes, i.Code)
+	}
+	return codes
+}
+
+func TestCheck(t *testing.T) {
+	const good = "max-age=63072000; includeSubDomains; preload"
+	for _, tt := range []struct {
+		name          string
+		domain        string
+		https, plain  http.Handler
+		www           string
+		errs, warning []string
+	}{
+		{"eligible", "example.com", header(good), redirect("https://example.com/"), "", nil, nil},
+		{"no http", "Example.COM.", header(good), nil, "", nil, []string{"http.unavailable"}},
+		{"subdomain", "a.example.com", header(good), nil, "", []string{"domain.subdomain"}, nil},
+		{"public suffix", "co.uk", header(good), nil, "", []string{"domain.invalid"}, nil},
+		{"no header", "example.com", http.NotFoundHandler(), redirect("https://example.com/"), "", []string{"header.missing"}, nil},
+		{"weak header", "example.com", header("max-age=3600"), redirect("https://example.com/"), "",
+			[]string{"header.max_age_too_low", "header.no_include_subdomains", "header.no_preload"}, nil},
+		{"sloppy header", "example.com", header(good + "; a = b"), redirect("https://example.com/"), "", nil, []string{"header.syntax"}},
+		{"no redirect", "example.com", header(good), http.NotFoundHandler(), "", []string{"redirect.missing"}, nil},
+		{"redirect to www", "example.com", header(good), redirect("https://www.example.com/"), "", []string{"redirect.not_same_host"}, nil},
+		{"redirect to http", "example.com", header(good), redirect("http://example.com/a"), "", []string{"redirect.not_same_host"}, nil},
+		{"www", "example.com", header(good), redirect("https://example.com/"), "up", nil, nil},
+		{"www without https", "example.com", header(good), redirect("https://example.com/"), "down", []string{"www.no_https"}, nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := checker(t, tt.https, tt.plain, tt.www).Check(context.Background(), tt.domain)
+			if got := codes(r.Errors); !reflect.DeepEqual(got, tt.errs) {
+				t.Errorf("got errors %v; want %v", r.Errors, tt.errs)
+			}
+			if got := codes(r.Warnings); !reflect.DeepEqual(got, tt.warning) {
+				t.Errorf("got warnings %v; want %v", r.Warnings, tt.warning)
+			}
+			if r.Eligible() != (len(tt.errs) == 0) {
+				t.Errorf("got eligible %v with errors %v", r.Eligible(), r.Errors)
+			}
+		})
+	}
+}
+
+func TestCheckCertificate(t *testing.T) {
+	c := checker(t, header("max-age=63072000; includeSubDomains; preload"), nil, "")
+	c.Client.Transport.(*http.Transport).TLSClientConfig = &tls.Config{} // test CA not trusted
+	r := c.Check(context.Background(), "example.com")
+	if got := codes(r.Errors); !reflect.DeepEqual(got, []string{"tls.invalid_certificate"}) {
+		t.Errorf("got errors %v; want invalid certificate", r.Errors)
+	}
+}
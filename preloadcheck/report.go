@@ -0,0 +1,209 @@
+package preloadcheck
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// defaultConcurrency is how many subdomains are crawled at once by default.
+const defaultConcurrency = 4
+
+// DefaultSubdomains are common subdomains crawled by Report, which must serve
+// HTTPS once the domain is preloaded with includeSubDomains.
+// The www subdomain is always checked by Check.
+var DefaultSubdomains = []string{"mail", "webmail", "api", "app", "blog", "shop", "dev", "staging", "m", "cdn", "static", "admin", "vpn", "remote"}
+
+// fixes tell what to change for each issue code.
+var fixes = map[string]string{
+	"domain.invalid":               "Submit a registrable domain, such as example.com.",
+	"domain.subdomain":             "Submit the registrable domain instead, its subdomains are covered by includeSubDomains.",
+	"tls.invalid_certificate":      "Serve a certificate valid for the domain, trusted by browsers and with its full chain.",
+	"https.unavailable":            "Serve the domain over HTTPS on port 443.",
+	"header.missing":               "Send the header Strict-Transport-Security: max-age=63072000; includeSubDomains; preload on HTTPS responses.",
+	"header.multiple":              "Send a single Strict-Transport-Security header, e.g. set it either in the application or in the proxy.",
+	"header.syntax":                "Fix the header syntax, e.g. max-age=63072000; includeSubDomains; preload.",
+	"header.invalid":               "Send a valid header, e.g. max-age=63072000; includeSubDomains; preload.",
+	"header.max_age_too_low":       "Raise max-age to at least 31536000 (one year), 63072000 (two years) is recommended.",
+	"header.no_include_subdomains": "Add includeSubDomains to the header, once all subdomains serve HTTPS.",
+	"header.no_preload":            "Add preload to the header.",
+	"http.unavailable":             "If the domain is served over HTTP (port 80), redirect it to HTTPS.",
+	"redirect.missing":             "Redirect HTTP to HTTPS on the same host, e.g. with a 301 to https://domain/.",
+	"redirect.not_same_host":       "Redirect HTTP to HTTPS on the same host first, then to other hosts like www.",
+	"www.no_https":                 "Serve www over HTTPS with a valid certificate, or remove its DNS records.",
+	"subdomain.no_https":           "Serve the subdomain over HTTPS with a valid certificate, or remove its DNS records: preloading forces HTTPS on all subdomains.",
+}
+
+// An Action is an issue with what to change to fix it.
+type Action struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Fix     string `json:"fix"`
+}
+
+func newAction(i Issue) Action {
+	return Action{Code: i.Code, Message: i.Message, Fix: fixes[i.Code]}
+}
+
+// A Subdomain is a crawled subdomain which exists.
+type Subdomain struct {
+	Host  string `json:"host"`
+	HTTPS bool   `json:"https"`
+	Error string `json:"error,omitempty"`
+}
+
+// A Report tells what must change before submitting a domain to the preload
+// list. It is stricter than Result.Eligible: existing subdomains which do not
+// serve HTTPS are also required to change, since they would break once preloaded.
+type Report struct {
+	Domain      string      `json:"domain"`
+	Ready       bool        `json:"ready"`
+	Required    []Action    `json:"required"`
+	Recommended []Action    `json:"recommended"`
+	Subdomains  []Subdomain `json:"subdomains"` // existing crawled subdomains
+}
+
+// Report checks a domain, crawls its common subdomains, and reports what
+// must change before submitting it to the preload list.
+func (c *Checker) Report(ctx context.Context, domain string) *Report {
+	r := c.Check(ctx, domain)
+	report := &Report{
+		Domain:      r.Domain,
+		Required:    []Action{},
+		Recommended: []Action{},
+		Subdomains:  []Subdomain{},
+	}
+	for _, i := range r.Errors {
+		report.Required = append(report.Required, newAction(i))
+	}
+	for _, i := range r.Warnings {
+		report.Recommended = append(report.Recommended, newAction(i))
+	}
+	if !invalidDomain(r) {
+		for _, s := range c.crawl(ctx, r.Domain) {
+			report.Subdomains = append(report.Subdomains, s)
+			if !s.HTTPS {
+				report.Required = append(report.Required, newAction(Issue{
+					Code:    "subdomain.no_https",
+					Message: fmt.Sprintf("%v exists but cannot be reached over HTTPS: %v", s.Host, s.Error),
+				}))
+			}
+		}
+	}
+	report.Ready = len(report.Required) == 0
+	return report
+}
+
+// invalidDomain returns whether a domain cannot be submitted at all, in which
+// case its subdomains are irrelevant.
+func invalidDomain(r *Result) bool {
+	for _, i := range r.Errors {
+		if strings.HasPrefix(i.Code, "domain.") {
+			return true
+		}
+	}
+	return false
+}
+
+// crawl returns the existing subdomains of a domain and whether they serve
+// HTTPS, crawling at most Concurrency at once.
+func (c *Checker) crawl(ctx context.Context, domain string) []Subdomain {
+	names := DefaultSubdomains
+	if c.Subdomains != nil {
+		names = c.Subdomains
+	}
+	lookupHost := net.DefaultResolver.LookupHost
+	if c.LookupHost != nil {
+		lookupHost = c.LookupHost
+	}
+	concurrency := c.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultConcurrency
+	}
+	crawled := make([]*Subdomain, len(names))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for n := 0; n < concurrency; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				host := names[i] + "." + domain
+				if _, err := lookupHost(ctx, host); err != nil {
+					continue // does not exist
+				}
+				s := &Subdomain{Host: host, HTTPS: true}
+				if _, err := c.get(ctx, (&url.URL{Scheme: "https", Host: host, Path: "/"}).String()); err != nil {
+					s.HTTPS = false
+					s.Error = err.Error()
+				}
+				crawled[i] = s
+			}
+		}()
+	}
+	for i := range names {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	// In the order of the names, whichever finished first.
+	var subdomains []Subdomain
+	for _, s := range crawled {
+		if s != nil {
+			subdomains = append(subdomains, *s)
+		}
+	}
+	return subdomains
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteMarkdown writes the report as Markdown for humans.
+func (r *Report) WriteMarkdown(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# HSTS preload report for %v\n\n", r.Domain)
+	if r.Ready {
+		b.WriteString("**Ready** to be submitted at https://hstspreload.org.\n")
+	} else {
+		fmt.Fprintf(&b, "**Not ready**: %d required changes before submitting at https://hstspreload.org.\n", len(r.Required))
+	}
+	writeActions(&b, "Required changes", r.Required)
+	writeActions(&b, "Recommended changes", r.Recommended)
+	if len(r.Subdomains) > 0 {
+		b.WriteString("\n## Subdomains\n\n")
+		b.WriteString("| Subdomain | HTTPS |\n")
+		b.WriteString("| --- | --- |\n")
+		for _, s := range r.Subdomains {
+			status := "yes"
+			if !s.HTTPS {
+				status = "no: " + s.Error
+			}
+			fmt.Fprintf(&b, "| %v | %v |\n", s.Host, strings.ReplaceAll(status, "|", `\|`))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeActions(b *strings.Builder, title string, actions []Action) {
+	if len(actions) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "\n## %v\n\n", title)
+	for i, a := range actions {
+		fmt.Fprintf(b, "%d. **%v**: %v\n", i+1, a.Code, a.Message)
+		if a.Fix != "" {
+			fmt.Fprintf(b, "   Fix: %v\n", a.Fix)
+		}
+	}
+}
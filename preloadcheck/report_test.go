@@ -0,0 +1,129 @@
+package preloadcheck
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReport(t *testing.T) {
+	c := checker(t, header("max-age=3600; includeSubDomains; preload"), redirect("https://example.com/"), "up")
+	c.Subdomains = []string{"mail", "api", "gone"}
+	c.LookupHost = func(ctx context.Context, host string) ([]string, error) {
+		if host == "gone.example.com" {
+			return nil, errors.New("no such host")
+		}
+		return []string{"127.0.0.1"}, nil
+	}
+	transport := c.Client.Transport.(*http.Transport)
+	dial := transport.DialContext
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if strings.HasPrefix(addr, "api.example.com:") {
+			return nil, errors.New("connection refused")
+		}
+		return dial(ctx, network, addr)
+	}
+
+	r := c.Report(context.Background(), "example.com")
+	if r.Ready {
+		t.Errorf("got ready; want not ready")
+	}
+	var got []string
+	for _, a := range r.Required {
+		got = append(got, a.Code)
+		if a.Fix == "" {
+			t.Errorf("action %v has no fix", a.Code)
+		}
+	}
+	if want := []string{"header.max_age_too_low", "subdomain.no_https"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got required %v; want %v", got, want)
+	}
+	wantSubdomains := []Subdomain{
+		{Host: "mail.example.com", HTTPS: true},
+		{Host: "api.example.com", Error: r.Subdomains[1].Error},
+	}
+	if !reflect.DeepEqual(r.Subdomains, wantSubdomains) || r.Subdomains[1].Error == "" {
+		t.Errorf("got subdomains %+v; want %+v with an error", r.Subdomains, wantSubdomains)
+	}
+
+	var b strings.Builder
+	if err := r.WriteMarkdown(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"# HSTS preload report for example.com\n",
+		"**Not ready**: 2 required changes",
+		"## Required changes\n\n1. **header.max_age_too_low**: max-age is 3600, it must be at least 31536000\n   Fix: Raise max-age",
+		"2. **subdomain.no_https**: api.example.com exists",
+		"| mail.example.com | yes |\n",
+		"| api.example.com | no: ",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("markdown %q missing %q", b.String(), want)
+		}
+	}
+	if strings.Contains(b.String(), "Recommended") {
+		t.Errorf("markdown %q has recommended changes; want none", b.String())
+	}
+
+	b.Reset()
+	if err := r.WriteJSON(&b); err != nil {
+		t.Fatal(err)
+	}
+	var decoded Report
+	if err := json.Unmarshal([]byte(b.String()), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&decoded, r) {
+		t.Errorf("JSON round trip got %+v; want %+v", decoded, r)
+	}
+}
+
+func TestReportReady(t *testing.T) {
+	c := checker(t, header("max-age=63072000; includeSubDomains; preload"), redirect("https://example.com/"), "")
+	r := c.Report(context.Background(), "example.com")
+	if !r.Ready || len(r.Subdomains) != 0 {
+		t.Errorf("got %+v; want ready without subdomains", r)
+	}
+	var b strings.Builder
+	if err := r.WriteMarkdown(&b); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "**Ready**") {
+		t.Errorf("markdown %q not ready", b.String())
+	}
+}
+
+func TestReportConcurrency(t *testing.T) {
+	c := checker(t, header("max-age=63072000; includeSubDomains; preload"), redirect("https://example.com/"), "")
+	c.Subdomains = DefaultSubdomains
+	c.Concurrency = 2
+	var m sync.Mutex
+	active, max := 0, 0
+	c.LookupHost = func(ctx context.Context, host string) ([]string, error) {
+		m.Lock()
+		active++
+		if active > max {
+			max = active
+		}
+		m.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		m.Lock()
+		active--
+		m.Unlock()
+		return nil, errors.New("no such host")
+	}
+	if r := c.Report(context.Background(), "example.com"); !r.Ready {
+		t.Errorf("got %+v; want ready", r)
+	}
+	if max > c.Concurrency {
+		t.Errorf("crawled %v subdomains at once; want at most %v", max, c.Concurrency)
+	}
+}
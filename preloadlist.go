@@ -0,0 +1,119 @@
+package hsts
+
+import (
+	"strings"
+	"sync"
+)
+
+// The preload list is generated as two constants, preloadIncludeSubDomains
+// and preloadHostOnly, holding sorted hosts each preceded and followed by a
+// newline. Hosts are substrings of these single backing strings, searched in
+// place, instead of costing a string header and map bucket each.
+
+// preloadFilterBits is the size of the preload filter, about 14 bits per
+// preloaded host so that few hosts which are not preloaded are searched.
+const preloadFilterBits = 1 << 21
+
+// preloadFilter is a set of hashes of the preloaded hosts, built once for all
+// transports, which tells quickly that most hosts are not preloaded.
+var (
+	preloadFilterOnce sync.Once
+	preloadFilter     []uint64
+)
+
+func buildPreloadFilter() {
+	if len(preloadIncludeSubDomains) == 1 && len(preloadHostOnly) == 1 {
+		return // empty, built with hsts_nopreload
+	}
+	preloadFilter = make([]uint64, preloadFilterBits/64)
+	add := func(host string) {
+		h := hash(host) % preloadFilterBits
+		preloadFilter[h/64] |= 1 << (h % 64)
+	}
+	each(preloadIncludeSubDomains, add)
+	each(preloadHostOnly, add)
+}
+
+// preloadHosts is the number of hosts in the preload list, counted once for
+// all transports as it takes a scan of the whole list.
+var (
+	preloadHostsOnce sync.Once
+	preloadHosts     int
+)
+
+// preloadCount returns the number of hosts in the preload list.
+func preloadCount() int {
+	preloadHostsOnce.Do(func() {
+		// Each host is followed by a newline, and lists start with one.
+		preloadHosts = strings.Count(preloadIncludeSubDomains, "\n") - 1 + strings.Count(preloadHostOnly, "\n") - 1
+	})
+	return preloadHosts
+}
+
+// preloadCount returns the number of hosts in the preload list, if it applies.
+func (t *Transport) preloadCount() int {
+	if t.noPreload {
+		return 0
+	}
+	return preloadCount()
+}
+
+// preloadFind returns the directive of a canonical host in the preload list,
+// if it is preloaded.
+func preloadFind(host string) (directive, bool) {
+	preloadFilterOnce.Do(buildPreloadFilter)
+	if preloadFilter == nil {
+		return directive{}, false
+	}
+	if h := hash(host) % preloadFilterBits; preloadFilter[h/64]&(1<<(h%64)) == 0 {
+		return directive{}, false
+	}
+	if search(preloadIncludeSubDomains, host) {
+		return preloadedIncludeSubDomains, true
+	}
+	if search(preloadHostOnly, host) {
+		return preloadedHostOnly, true
+	}
+	return directive{}, false
+}
+
+// search tells whether host is a line of list, a sorted list of lines each
+// preceded and followed by a newline, with a binary search on its bytes.
+func search(list, host string) bool {
+	// list[lo] and list[hi] are newlines around the lines left to search.
+	lo, hi := 0, len(list)-1
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		i := strings.LastIndexByte(list[:mid+1], '\n') // start of a line at or before mid
+		j := i + 1 + strings.IndexByte(list[i+1:], '\n')
+		switch line := list[i+1 : j]; {
+		case host == line:
+			return true
+		case host < line:
+			hi = i
+		default:
+			lo = j
+		}
+	}
+	return false
+}
+
+// each calls f for each line of list, a list of lines each preceded and
+// followed by a newline.
+func each(list string, f func(line string)) {
+	for i := 1; i < len(list); {
+		j := i + strings.IndexByte(list[i:], '\n')
+		f(list[i:j])
+		i = j + 1
+	}
+}
+
+// hash is the 32-bit FNV-1a hash of a string.
+func hash(s string) uint32 {
+	h := uint32(2166136261)
+	for i := 0; i < len(s); i++ {
+		h ^= uint32(s[i])
+		h *= 16777619
+	}
+	return h
+}
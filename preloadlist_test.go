@@ -0,0 +1,31 @@
+package hsts
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	list := "\na.com\nb.com\nc.b.com\nd\nexample.com\nz\n"
+	var lines []string
+	each(list, func(line string) { lines = append(lines, line) })
+	if got := strings.Join(lines, " "); got != "a.com b.com c.b.com d example.com z" {
+		t.Fatalf("each() got %v", got)
+	}
+	for _, line := range lines {
+		if !search(list, line) {
+			t.Errorf("search(%v) = false; want true", line)
+		}
+	}
+	for _, host := range []string{"", "a", "a.co", "a.comm", "b.co", "com", "e", "example.co", "zz", "0"} {
+		if search(list, host) {
+			t.Errorf("search(%v) = true; want false", host)
+		}
+	}
+	for _, host := range []string{"", "a.com"} {
+		if search("\n", host) {
+			t.Errorf("search(%v) in empty list = true; want false", host)
+		}
+	}
+	each("\n", func(line string) { t.Errorf("each() in empty list got %q", line) })
+}
@@ -0,0 +1,192 @@
+package hsts
+
+import (
+	"sync"
+	"time"
+)
+
+// A StateReader is a read-only view of the state of a Transport, for
+// intercepting proxies to consult per connection whether to force TLS
+// upstream without being able to change it. It is safe for concurrent use.
+type StateReader interface {
+	// Lookup returns the entry applying to a host, if it is a known HSTS host.
+	Lookup(host string) (Entry, bool)
+
+	// Entries returns the dynamic entries which have not expired, sorted by host.
+	Entries() []Entry
+
+	// Subscribe calls f for each change to the dynamic entries until the
+	// returned function is called. It is called synchronously by the
+	// goroutine making the change, after it is made, so it must not block.
+	Subscribe(f func(Change)) (unsubscribe func())
+}
+
+// A Change is a change to the dynamic entries of a Transport.
+type Change struct {
+	Host    string
+	Entry   Entry // the new entry, or only Host and Received when Removed
+	Removed bool  // by max-age=0, expiry or eviction
+	Evicted bool  // removed to make room, see WithMaxEntries
+}
+
+// State returns a read-only view of the state of the Transport.
+func (t *Transport) State() StateReader {
+	return stateReader{t}
+}
+
+// stateReader hides the Transport so that it cannot be asserted back.
+type stateReader struct {
+	t *Transport
+}
+
+func (r stateReader) Lookup(host string) (Entry, bool) {
+	return r.t.Lookup(host)
+}
+
+func (r stateReader) Entries() []Entry {
+	return r.t.entries(r.t.now())
+}
+
+func (r stateReader) Subscribe(f func(Change)) func() {
+	return r.t.store.subscribers.add(f)
+}
+
+// subscribers are the functions to call on changes, see StateReader.Subscribe.
+type subscribers struct {
+	m    sync.RWMutex // protects next and fs
+	next int
+	fs   map[int]func(Change)
+}
+
+func (s *subscribers) add(f func(Change)) func() {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.fs == nil {
+		s.fs = make(map[int]func(Change))
+	}
+	id := s.next
+	s.next++
+	s.fs[id] = f
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.m.Lock()
+			delete(s.fs, id)
+			s.m.Unlock()
+		})
+	}
+}
+
+// any tells whether there are subscribers, to only make changes when needed.
+func (s *subscribers) any() bool {
+	s.m.RLock()
+	defer s.m.RUnlock()
+	return len(s.fs) > 0
+}
+
+func (s *subscribers) notify(c Change) {
+	s.m.RLock()
+	fs := make([]func(Change), 0, len(s.fs))
+	for _, f := range s.fs {
+		fs = append(fs, f)
+	}
+	s.m.RUnlock()
+	for _, f := range fs {
+		f(c)
+	}
+}
+
+// notifyChanged notifies subscribers of the new directive of a host.
+func (t *Transport) notifyChanged(host string, d directive) {
+	if !t.store.subscribers.any() {
+		return
+	}
+	if d.removed() {
+		t.notifyRemoved([]string{host}, t.now())
+		return
+	}
+	t.store.subscribers.notify(Change{Host: host, Entry: newEntry(host, d)})
+}
+
+// notifyRemoved notifies subscribers of the removal of hosts at a time, so
+// that a removal applied late elsewhere does not undo a more recent entry.
+func (t *Transport) notifyRemoved(hosts []string, at time.Time) {
+	if len(hosts) == 0 || !t.store.subscribers.any() {
+		return
+	}
+	at = at.Truncate(time.Second)
+	for _, host := range hosts {
+		t.store.subscribers.notify(Change{Host: host, Entry: Entry{Host: host, Received: at}, Removed: true})
+	}
+}
+
+// Apply applies a change made elsewhere, e.g. by another process learning
+// for the same hosts (see package hstssync), as if the Transport had learned
+// or removed the policy itself. Options restricting learning still apply and
+// an entry is only replaced by a more recent one, so that applying changes
+// in any order converges: a removal older than the entry is dropped too, and
+// one without Received is taken as made now. Preloaded entries are not
+// applied, nor removals of hosts protected WithKnockOutProtection.
+// It returns whether the state changed: subscribers are only notified then,
+// so that changes applied everywhere are not echoed forever.
+func (t *Transport) Apply(c Change) bool {
+	host := canonicalize(c.Host)
+	if host == "" || isIP(host) || !t.mayLearn(host) {
+		return false
+	}
+	cur, ok := t.entry(host)
+	if c.Removed || c.Entry.MaxAge <= 0 {
+		at := c.Entry.Received
+		if at.IsZero() {
+			at = t.now()
+		}
+		if t.protected(host) || (ok && !cur.removed() && cur.received().After(at)) {
+			return false
+		}
+		_, preloaded := preloadFind(host)
+		if preloaded && !isPreloadedTLD(host) {
+			if ok && cur.removed() {
+				return false
+			}
+			t.putTombstone(host, at)
+			t.auditRemoved([]string{host}, "applied")
+			return true
+		}
+		if !ok || cur.removed() {
+			return false
+		}
+		t.remove(host, at)
+		t.auditRemoved([]string{host}, "applied")
+		return true
+	}
+	if c.Entry.Preloaded {
+		return false
+	}
+	d := t.entryDirective(host, c.Entry)
+	if ok && !cur.removed() && (cur.received().After(d.received()) || sameDirective(cur, d)) {
+		return false
+	}
+	t.put(host, d)
+	t.auditChanged(host, "applied", d)
+	return true
+}
+
+// sameDirective tells whether two directives are the same.
+func sameDirective(a, b directive) bool {
+	return a.expires == b.expires && samePolicy(a, b)
+}
+
+// samePolicy tells whether two directives are the same policy, regardless of
+// when they were received.
+func samePolicy(a, b directive) bool {
+	ae, be := a.extensions(), b.extensions()
+	if a.maxAge != b.maxAge || a.flags != b.flags || len(ae) != len(be) {
+		return false
+	}
+	for k, v := range ae {
+		if w, ok := be[k]; !ok || v != w {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,139 @@
+package hsts
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStateReader(t *testing.T) {
+	transport := New(&fakeTransport{}, WithKnockOut(KnockOutSubdomains))
+	state := transport.State()
+
+	var m sync.Mutex
+	var changes []Change
+	unsubscribe := state.Subscribe(func(c Change) {
+		m.Lock()
+		defer m.Unlock()
+		changes = append(changes, c)
+	})
+	gotChanges := func() []Change {
+		m.Lock()
+		defer m.Unlock()
+		c := changes
+		changes = nil
+		return c
+	}
+
+	resp, err := (&http.Client{Transport: transport}).Get("https://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	c := gotChanges()
+	if len(c) != 1 || c[0].Host != "example.com" || c[0].Removed || c[0].Entry.Host != "example.com" || c[0].Entry.MaxAge == 0 {
+		t.Errorf("learning got changes %+v; want example.com", c)
+	}
+	if e, ok := state.Lookup("sub.example.com"); !ok || e.Host != "example.com" {
+		t.Errorf("Lookup(sub.example.com) = %+v, %v; want example.com", e, ok)
+	}
+	if entries := state.Entries(); len(entries) != 1 || entries[0].Host != "example.com" {
+		t.Errorf("Entries() = %+v; want example.com", entries)
+	}
+
+	transport.put("sub.example.com", newDirective(time.Now(), time.Hour, 0))
+	gotChanges()
+	transport.add("example.com", directive{}) // max-age=0
+	var removed []string
+	for _, c := range gotChanges() {
+		if !c.Removed {
+			t.Errorf("knock-out got change %+v; want removal", c)
+		}
+		removed = append(removed, c.Host)
+	}
+	sort.Strings(removed)
+	if want := []string{"example.com", "sub.example.com"}; !reflect.DeepEqual(removed, want) {
+		t.Errorf("knock-out removed %v; want %v", removed, want)
+	}
+	transport.add("unknown.example.com", directive{})
+	if c := gotChanges(); len(c) != 0 {
+		t.Errorf("knock-out of an unknown host got changes %+v; want none", c)
+	}
+
+	transport.put("expired.com", newDirective(time.Now().Add(-2*time.Hour), time.Hour, 0))
+	gotChanges()
+	transport.Lookup("expired.com")
+	if c := gotChanges(); len(c) != 1 || c[0].Host != "expired.com" || !c[0].Removed || c[0].Entry.Received.IsZero() {
+		t.Errorf("expiry got changes %+v; want expired.com removed", c)
+	}
+
+	unsubscribe()
+	unsubscribe()
+	transport.put("other.com", newDirective(time.Now(), time.Hour, 0))
+	if c := gotChanges(); len(c) != 0 {
+		t.Errorf("after unsubscribing got changes %+v; want none", c)
+	}
+}
+
+func TestApply(t *testing.T) {
+	transport := New(nil, WithLearnDeny("denied.com"))
+	var changes []Change
+	transport.State().Subscribe(func(c Change) { changes = append(changes, c) })
+	now := time.Now().Truncate(time.Second)
+	entry := func(host string, received time.Time, maxAge time.Duration) Change {
+		return Change{Host: host, Entry: Entry{Host: host, Received: received, Policy: Policy{MaxAge: maxAge, IncludeSubDomains: true, Extensions: map[string]string{"a": "b"}}}}
+	}
+	for _, tt := range []struct {
+		name    string
+		change  Change
+		changed bool
+	}{
+		{"new", entry("example.com", now, time.Hour), true},
+		{"same", entry("Example.COM", now, time.Hour), false},
+		{"older", entry("example.com", now.Add(-time.Minute), 2*time.Hour), false},
+		{"newer", entry("example.com", now.Add(time.Minute), 2*time.Hour), true},
+		{"denied", entry("denied.com", now, time.Hour), false},
+		{"IP", entry("127.0.0.1", now, time.Hour), false},
+		{"preloaded", Change{Host: "example.net", Entry: Entry{Preloaded: true, Policy: Policy{MaxAge: time.Hour}}}, false},
+		{"removed before", Change{Host: "example.com", Entry: Entry{Received: now}, Removed: true}, false},
+		{"removed", Change{Host: "example.com", Entry: Entry{Received: now.Add(2 * time.Minute)}, Removed: true}, true},
+		{"removed again", Change{Host: "example.com", Removed: true}, false},
+		{"max-age=0", entry("example.org", now, 0), false},
+	} {
+		changes = nil
+		if got := transport.Apply(tt.change); got != tt.changed {
+			t.Errorf("%v: Apply() = %v; want %v", tt.name, got, tt.changed)
+		}
+		if (len(changes) > 0) != tt.changed {
+			t.Errorf("%v: got changes %+v; want changed %v", tt.name, changes, tt.changed)
+		}
+	}
+
+	transport.Apply(entry("example.com", now, time.Hour))
+	e, ok := transport.Lookup("sub.example.com")
+	if !ok || e.Host != "example.com" || !e.Received.Equal(now) || e.MaxAge != time.Hour || e.Extensions["a"] != "b" {
+		t.Errorf("Lookup(sub.example.com) = %+v, %v; want the applied entry", e, ok)
+	}
+}
+
+func TestApplyOutOfOrder(t *testing.T) {
+	transport := New(nil)
+	t1 := time.Now().Add(-time.Minute).Truncate(time.Second)
+	t2 := t1.Add(30 * time.Second)
+	transport.Apply(Change{Host: "example.com", Entry: Entry{Host: "example.com", Received: t2, Policy: Policy{MaxAge: time.Hour}}})
+	if transport.Apply(Change{Host: "example.com", Entry: Entry{Host: "example.com", Received: t1}, Removed: true}) {
+		t.Error("Apply(removal at t1) after learning at t2 = true; want false")
+	}
+	if _, ok := transport.Lookup("example.com"); !ok {
+		t.Error("example.com learned at t2 forgotten by a removal at t1")
+	}
+	if !transport.Apply(Change{Host: "example.com", Removed: true}) {
+		t.Error("Apply(removal without Received) = false; want true, as made now")
+	}
+	if _, ok := transport.Lookup("example.com"); ok {
+		t.Error("example.com still known after a removal made now")
+	}
+}
@@ -0,0 +1,209 @@
+// Package scanner probes domains concurrently and reports their HSTS posture,
+// to audit many domains at once.
+package scanner
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/StalkR/hsts"
+)
+
+// A Posture sums up the HSTS posture of a domain.
+type Posture string
+
+// Postures, from best to worst.
+const (
+	Preloaded     Posture = "preloaded"     // in the preload list
+	Dynamic       Posture = "dynamic"       // serves a valid header
+	None          Posture = "none"          // serves no header, or max-age=0
+	Misconfigured Posture = "misconfigured" // serves an invalid or non-conforming header
+	Unreachable   Posture = "unreachable"   // cannot be reached over HTTPS
+)
+
+// A Result is the HSTS posture of a domain.
+type Result struct {
+	Domain            string  `json:"domain"`
+	Posture           Posture `json:"posture"`
+	Preloaded         bool    `json:"preloaded"`
+	Header            string  `json:"header,omitempty"`  // first Strict-Transport-Security header
+	MaxAge            int64   `json:"max_age,omitempty"` // seconds
+	IncludeSubDomains bool    `json:"include_subdomains,omitempty"`
+	Preload           bool    `json:"preload,omitempty"`
+	Error             string  `json:"error,omitempty"` // why unreachable or misconfigured
+}
+
+// A Scanner probes domains. The zero value is ready to use.
+type Scanner struct {
+	// Client makes requests, http.DefaultClient if nil.
+	// Redirects are never followed by it.
+	Client *http.Client
+
+	// Concurrency is the number of domains probed at once, 10 if zero.
+	Concurrency int
+
+	// Rate is the maximum number of probes started per second, unlimited if zero.
+	Rate float64
+
+	// Timeout bounds each probe, 10 seconds if zero.
+	Timeout time.Duration
+
+	once      sync.Once
+	transport *hsts.Transport // to look up preloaded domains
+}
+
+// Scan probes domains and returns their results in the same order.
+// When the context is done, remaining domains are unreachable.
+func (s *Scanner) Scan(ctx context.Context, domains []string) []Result {
+	results := make([]Result, len(domains))
+	concurrency := s.Concurrency
+	if concurrency <= 0 {
+		concurrency = 10
+	}
+	var tick <-chan time.Time
+	if s.Rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / s.Rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = s.Probe(ctx, domains[i])
+			}
+		}()
+	}
+	for i := range domains {
+		if tick != nil && i > 0 {
+			select {
+			case <-tick:
+			case <-ctx.Done():
+			}
+		}
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return results
+}
+
+// Probe probes a domain.
+func (s *Scanner) Probe(ctx context.Context, domain string) Result {
+	s.once.Do(func() { s.transport = hsts.New(nil) })
+	domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+	r := Result{Domain: domain}
+	if e, ok := s.transport.Lookup(domain); ok && e.Preloaded {
+		r.Preloaded = true
+	}
+	values, err := s.get(ctx, domain)
+	if err != nil {
+		r.Posture = Unreachable
+		r.Error = err.Error()
+		return r
+	}
+	r.Posture = posture(&r, values)
+	if r.Preloaded && r.Posture != Misconfigured {
+		r.Posture = Preloaded
+	}
+	return r
+}
+
+// posture evaluates the Strict-Transport-Security headers of a domain.
+func posture(r *Result, values []string) Posture {
+	if len(values) == 0 {
+		return None
+	}
+	r.Header = values[0]
+	p, err := hsts.ParseHeader(r.Header)
+	if err != nil {
+		r.Error = err.Error()
+		return Misconfigured
+	}
+	r.MaxAge = int64(p.MaxAge / time.Second)
+	r.IncludeSubDomains = p.IncludeSubDomains
+	r.Preload = p.Preload
+	if len(values) > 1 {
+		r.Error = "multiple Strict-Transport-Security headers"
+		return Misconfigured
+	}
+	if err := hsts.ValidateHeader(r.Header); err != nil {
+		r.Error = err.Error()
+		return Misconfigured
+	}
+	if p.MaxAge == 0 {
+		return None
+	}
+	return Dynamic
+}
+
+// get gets the HTTPS root of a domain without following redirects and returns
+// its Strict-Transport-Security headers.
+func (s *Scanner) get(ctx context.Context, domain string) ([]string, error) {
+	timeout := s.Timeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", "https://"+domain+"/", nil)
+	if err != nil {
+		return nil, err
+	}
+	client := http.DefaultClient
+	if s.Client != nil {
+		client = s.Client
+	}
+	noRedirect := *client
+	noRedirect.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	resp, err := noRedirect.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return resp.Header.Values("Strict-Transport-Security"), nil
+}
+
+// WriteJSON writes results as JSON Lines, one object per line.
+func WriteJSON(w io.Writer, results []Result) error {
+	enc := json.NewEncoder(w)
+	for _, r := range results {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteCSV writes results as CSV with a header row.
+func WriteCSV(w io.Writer, results []Result) error {
+	c := csv.NewWriter(w)
+	c.Write([]string{"domain", "posture", "preloaded", "header", "max_age", "include_subdomains", "preload", "error"})
+	for _, r := range results {
+		c.Write([]string{
+			r.Domain,
+			string(r.Posture),
+			strconv.FormatBool(r.Preloaded),
+			r.Header,
+			strconv.FormatInt(r.MaxAge, 10),
+			strconv.FormatBool(r.IncludeSubDomains),
+			strconv.FormatBool(r.Preload),
+			r.Error,
+		})
+	}
+	c.Flush()
+	return c.Error()
+}
@@ -0,0 +1,123 @@
+package scanner
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/StalkR/hsts"
+)
+
+func TestScan(t *testing.T) {
+	headers := map[string][]string{
+		"dynamic.example.com":     {"max-age=3600; includeSubDomains"},
+		"none.example.com":        nil,
+		"removed.example.com":     {"max-age=0"},
+		"invalid.example.com":     {"max-age=forever"},
+		"sloppy.example.com":      {"max-age=3600; a = b"},
+		"multiple.example.com":    {"max-age=3600", "max-age=60"},
+		"preloaded.dev":           {"max-age=31536000; includeSubDomains; preload"},
+		"preloaded-none.dev":      nil,
+		"preloaded-invalid.dev":   {"max-age=-1"},
+		"unreachable.example.com": nil,
+		"redirected.example.com":  {"max-age=600"},
+	}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, v := range headers[r.Host] {
+			w.Header().Add("Strict-Transport-Security", v)
+		}
+		if strings.HasPrefix(r.Host, "redirected.") {
+			http.Redirect(w, r, "https://elsewhere.example.com/", http.StatusMovedPermanently)
+		}
+	}))
+	defer server.Close()
+
+	s := &Scanner{
+		Client: &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				if strings.HasPrefix(addr, "unreachable.") {
+					return nil, errors.New("connection refused")
+				}
+				var d net.Dialer
+				return d.DialContext(ctx, network, server.Listener.Addr().String())
+			},
+		}},
+		Concurrency: 3,
+		Rate:        1000,
+	}
+	var domains []string
+	// Without the preload list (hsts_nopreload), .dev is not preloaded.
+	preloadList := len(hsts.PreloadedTLDs()) > 0
+	for d := range headers {
+		if preloadList || !strings.HasSuffix(d, ".dev") {
+			domains = append(domains, d)
+		}
+	}
+	domains = append(domains, "Dynamic.Example.COM.")
+	results := s.Scan(context.Background(), domains)
+	want := map[string]Posture{
+		"dynamic.example.com":     Dynamic,
+		"none.example.com":        None,
+		"removed.example.com":     None,
+		"invalid.example.com":     Misconfigured,
+		"sloppy.example.com":      Misconfigured,
+		"multiple.example.com":    Misconfigured,
+		"preloaded.dev":           Preloaded,
+		"preloaded-none.dev":      Preloaded,
+		"preloaded-invalid.dev":   Misconfigured,
+		"unreachable.example.com": Unreachable,
+		"redirected.example.com":  Dynamic,
+	}
+	if len(results) != len(domains) {
+		t.Fatalf("got %d results; want %d", len(results), len(domains))
+	}
+	for i, r := range results {
+		if !strings.EqualFold(r.Domain, strings.TrimSuffix(domains[i], ".")) {
+			t.Errorf("result %d is for %v; want %v", i, r.Domain, domains[i])
+		}
+		if r.Posture != want[r.Domain] {
+			t.Errorf("%v: got posture %v (%v); want %v", r.Domain, r.Posture, r.Error, want[r.Domain])
+		}
+		if r.Preloaded != strings.HasSuffix(r.Domain, ".dev") {
+			t.Errorf("%v: got preloaded %v", r.Domain, r.Preloaded)
+		}
+		if r.Domain == "dynamic.example.com" && (r.MaxAge != 3600 || !r.IncludeSubDomains || r.Preload) {
+			t.Errorf("%v: got %+v", r.Domain, r)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	results := []Result{
+		{Domain: "example.com", Posture: Dynamic, Header: `max-age=60; a="b, c"`, MaxAge: 60},
+		{Domain: "example.org", Posture: Unreachable, Error: "timeout"},
+	}
+	var b strings.Builder
+	if err := WriteJSON(&b, results); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"domain":"example.com","posture":"dynamic","preloaded":false,"header":"max-age=60; a=\"b, c\"","max_age":60}
+{"domain":"example.org","posture":"unreachable","preloaded":false,"error":"timeout"}
+`
+	if b.String() != want {
+		t.Errorf("WriteJSON got\n%s\nwant\n%s", b.String(), want)
+	}
+
+	b.Reset()
+	if err := WriteCSV(&b, results); err != nil {
+		t.Fatal(err)
+	}
+	want = `domain,posture,preloaded,header,max_age,include_subdomains,preload,error
+example.com,dynamic,false,"max-age=60; a=""b, c""",60,false,false,
+example.org,unreachable,false,,0,false,false,timeout
+`
+	if b.String() != want {
+		t.Errorf("WriteCSV got\n%s\nwant\n%s", b.String(), want)
+	}
+}
@@ -0,0 +1,330 @@
+package hsts
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// MinSCTs is the number of valid signed certificate timestamps from distinct
+// logs required by WithRequireSCTs.
+const MinSCTs = 2
+
+// A CTLog is a Certificate Transparency log trusted for its signed
+// certificate timestamps (SCTs, RFC 6962).
+type CTLog struct {
+	Description string
+	Key         crypto.PublicKey // *ecdsa.PublicKey or *rsa.PublicKey
+}
+
+// An SCTError is returned by a Transport requiring SCTs when a response from
+// an HSTS host came over a connection without enough valid SCTs.
+type SCTError struct {
+	Host  string // the host the request was sent to
+	Valid int    // number of valid SCTs from distinct logs
+	Err   error  // why SCTs were invalid, if any
+}
+
+func (e *SCTError) Error() string {
+	msg := fmt.Sprintf("hsts: %v: %d valid SCTs, want at least %d", e.Host, e.Valid, MinSCTs)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *SCTError) Unwrap() error {
+	return e.Err
+}
+
+// WithRequireSCTs requires connections to HSTS hosts to present at least
+// MinSCTs valid signed certificate timestamps from distinct trusted logs,
+// embedded in the certificate or sent in the TLS handshake, otherwise the
+// response is discarded and RoundTrip fails with an *SCTError.
+// Logs are those embedded from the list of logs trusted by Chrome if nil
+// (see go generate). New panics with fewer than MinSCTs distinct logs, as
+// no connection could then pass.
+// The request was already sent when the response is checked, before it or
+// its body are returned and its header noted: to refuse the connection
+// before sending it, also set VerifySCTs as the tls.Config.VerifyConnection
+// of the wrapped transport.
+func WithRequireSCTs(logs []CTLog) Option {
+	return func(t *Transport) {
+		t.requireSCTs, t.sctLogs = true, logs
+	}
+}
+
+// ctLogs are trusted logs by ID, the SHA-256 hash of their public key.
+type ctLogs map[[sha256.Size]byte]crypto.PublicKey
+
+// newCTLogs returns the trusted logs: those given, else the embedded ones.
+// Fewer than MinSCTs is an error.
+func newCTLogs(logs []CTLog) (ctLogs, error) {
+	byID := make(ctLogs)
+	if logs == nil {
+		for _, der := range embeddedCTLogs {
+			key, err := x509.ParsePKIXPublicKey([]byte(der))
+			if err != nil {
+				return nil, fmt.Errorf("hsts: embedded CT log: %v", err)
+			}
+			byID[sha256.Sum256([]byte(der))] = key
+		}
+	}
+	for _, log := range logs {
+		der, err := x509.MarshalPKIXPublicKey(log.Key)
+		if err != nil {
+			return nil, fmt.Errorf("hsts: CT log %v: %v", log.Description, err)
+		}
+		byID[sha256.Sum256(der)] = log.Key
+	}
+	if len(byID) < MinSCTs {
+		return nil, fmt.Errorf("hsts: %d distinct CT logs, want at least %d", len(byID), MinSCTs)
+	}
+	return byID, nil
+}
+
+// VerifySCTs checks the SCTs of a TLS connection to an HSTS host as
+// WithRequireSCTs does on responses. Set as the tls.Config.VerifyConnection
+// of the wrapped transport, connections failing it are refused before any
+// request is sent. It does nothing without WithRequireSCTs.
+func (t *Transport) VerifySCTs(cs tls.ConnectionState) error {
+	if t.ctLogs == nil {
+		return nil
+	}
+	host := canonicalize(cs.ServerName)
+	if !t.known(context.Background(), host, t.now()) {
+		return nil
+	}
+	return t.verifyConnectionSCTs(host, &cs)
+}
+
+// checkSCTs checks the SCTs of the connection of a response to an HSTS host,
+// if required.
+func (t *Transport) checkSCTs(req *http.Request, resp *http.Response) error {
+	if t.ctLogs == nil || req.URL.Scheme != "https" {
+		return nil
+	}
+	host := canonicalize(req.URL.Host)
+	if !t.known(req.Context(), host, t.now()) {
+		return nil
+	}
+	return t.verifyConnectionSCTs(host, resp.TLS)
+}
+
+// verifyConnectionSCTs checks the SCTs of a connection to an HSTS host.
+func (t *Transport) verifyConnectionSCTs(host string, cs *tls.ConnectionState) error {
+	if cs == nil || len(cs.VerifiedChains) == 0 || len(cs.VerifiedChains[0]) < 2 {
+		return &SCTError{Host: host, Err: errors.New("no verified certificate chain")}
+	}
+	chain := cs.VerifiedChains[0]
+	valid, err := verifySCTs(t.ctLogs, chain[0], chain[1], cs.SignedCertificateTimestamps, t.now())
+	if valid < MinSCTs {
+		return &SCTError{Host: host, Valid: valid, Err: err}
+	}
+	return nil
+}
+
+// oidSCTList is the certificate extension of embedded SCTs (RFC 6962 3.3).
+var oidSCTList = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+
+// verifySCTs returns the number of distinct logs with a valid SCT for a leaf
+// certificate, embedded or given, and the last error with an invalid one.
+func verifySCTs(logs map[[sha256.Size]byte]crypto.PublicKey, leaf, issuer *x509.Certificate, scts [][]byte, now time.Time) (int, error) {
+	var lastErr error
+	valid := make(map[[sha256.Size]byte]bool)
+	verify := func(sct []byte, entry []byte) {
+		id, err := verifySCT(logs, sct, entry, now)
+		if err != nil {
+			lastErr = err
+			return
+		}
+		valid[id] = true
+	}
+
+	// Given SCTs are over the certificate itself (x509_entry).
+	if len(scts) > 0 {
+		entry := make([]byte, 2, 5+len(leaf.Raw))
+		entry = appendUint24(entry, len(leaf.Raw))
+		entry = append(entry, leaf.Raw...)
+		for _, sct := range scts {
+			verify(sct, entry)
+		}
+	}
+
+	// Embedded SCTs are over the precertificate (precert_entry): the issuer
+	// key hash and the TBSCertificate without the SCT list extension.
+	for _, ext := range leaf.Extensions {
+		if !ext.Id.Equal(oidSCTList) {
+			continue
+		}
+		list, err := parseSCTList(ext.Value)
+		if err != nil {
+			lastErr = err
+			break
+		}
+		tbs, err := removeExtension(leaf.RawTBSCertificate, oidSCTList)
+		if err != nil {
+			lastErr = err
+			break
+		}
+		keyHash := sha256.Sum256(issuer.RawSubjectPublicKeyInfo)
+		entry := []byte{0, 1} // precert_entry
+		entry = append(entry, keyHash[:]...)
+		entry = appendUint24(entry, len(tbs))
+		entry = append(entry, tbs...)
+		for _, sct := range list {
+			verify(sct, entry)
+		}
+	}
+	return len(valid), lastErr
+}
+
+// verifySCT verifies an SCT over an entry (type and signed entry) and
+// returns the ID of its log.
+func verifySCT(logs map[[sha256.Size]byte]crypto.PublicKey, sct, entry []byte, now time.Time) ([sha256.Size]byte, error) {
+	var id [sha256.Size]byte
+	// version(1) log_id(32) timestamp(8) extensions(2+n) hash(1) sig(1) signature(2+n)
+	if len(sct) < 1+32+8+2 || sct[0] != 0 {
+		return id, errors.New("hsts: invalid SCT")
+	}
+	copy(id[:], sct[1:33])
+	timestamp := binary.BigEndian.Uint64(sct[33:41])
+	n := int(binary.BigEndian.Uint16(sct[41:43]))
+	if len(sct) < 43+n+4 {
+		return id, errors.New("hsts: invalid SCT")
+	}
+	extensions := sct[41 : 43+n]
+	hashAlg, sigAlg := sct[43+n], sct[44+n]
+	m := int(binary.BigEndian.Uint16(sct[45+n : 47+n]))
+	if len(sct) != 47+n+m {
+		return id, errors.New("hsts: invalid SCT")
+	}
+	sig := sct[47+n:]
+
+	key, ok := logs[id]
+	if !ok {
+		return id, errors.New("hsts: SCT from an unknown log")
+	}
+	if time.UnixMilli(int64(timestamp)).After(now) {
+		return id, errors.New("hsts: SCT from the future")
+	}
+	if hashAlg != 4 { // sha256
+		return id, errors.New("hsts: SCT not hashed with SHA-256")
+	}
+	var signed bytes.Buffer
+	signed.Write([]byte{0, 0}) // v1, certificate_timestamp
+	signed.Write(sct[33:41])
+	signed.Write(entry)
+	signed.Write(extensions)
+	digest := sha256.Sum256(signed.Bytes())
+
+	switch key := key.(type) {
+	case *ecdsa.PublicKey:
+		if sigAlg != 3 || !ecdsa.VerifyASN1(key, digest[:], sig) {
+			return id, errors.New("hsts: invalid SCT signature")
+		}
+	case *rsa.PublicKey:
+		if sigAlg != 1 || rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig) != nil {
+			return id, errors.New("hsts: invalid SCT signature")
+		}
+	default:
+		return id, errors.New("hsts: unsupported CT log key")
+	}
+	return id, nil
+}
+
+// parseSCTList parses the value of an SCT list extension: an OCTET STRING
+// of a SignedCertificateTimestampList, a list of SCTs with lengths.
+func parseSCTList(value []byte) ([][]byte, error) {
+	var b []byte
+	if rest, err := asn1.Unmarshal(value, &b); err != nil || len(rest) > 0 {
+		return nil, errors.New("hsts: invalid SCT list")
+	}
+	if len(b) < 2 || int(binary.BigEndian.Uint16(b)) != len(b)-2 {
+		return nil, errors.New("hsts: invalid SCT list")
+	}
+	var list [][]byte
+	for b = b[2:]; len(b) > 0; {
+		if len(b) < 2 {
+			return nil, errors.New("hsts: invalid SCT list")
+		}
+		n := int(binary.BigEndian.Uint16(b))
+		if len(b) < 2+n {
+			return nil, errors.New("hsts: invalid SCT list")
+		}
+		list = append(list, b[2:2+n])
+		b = b[2+n:]
+	}
+	return list, nil
+}
+
+// removeExtension returns a DER TBSCertificate without an extension.
+func removeExtension(tbs []byte, oid asn1.ObjectIdentifier) ([]byte, error) {
+	invalid := errors.New("hsts: invalid TBSCertificate")
+	var seq asn1.RawValue
+	if rest, err := asn1.Unmarshal(tbs, &seq); err != nil || len(rest) > 0 {
+		return nil, invalid
+	}
+	var fields []byte
+	for rest := seq.Bytes; len(rest) > 0; {
+		var field asn1.RawValue
+		var err error
+		if rest, err = asn1.Unmarshal(rest, &field); err != nil {
+			return nil, invalid
+		}
+		if field.Class != asn1.ClassContextSpecific || field.Tag != 3 {
+			fields = append(fields, field.FullBytes...)
+			continue
+		}
+		// extensions [3] EXPLICIT SEQUENCE OF Extension
+		var list asn1.RawValue
+		if r, err := asn1.Unmarshal(field.Bytes, &list); err != nil || len(r) > 0 {
+			return nil, invalid
+		}
+		var kept []byte
+		for r := list.Bytes; len(r) > 0; {
+			var e asn1.RawValue
+			if r, err = asn1.Unmarshal(r, &e); err != nil {
+				return nil, invalid
+			}
+			var ext pkix.Extension
+			if _, err := asn1.Unmarshal(e.FullBytes, &ext); err != nil {
+				return nil, invalid
+			}
+			if !ext.Id.Equal(oid) {
+				kept = append(kept, e.FullBytes...)
+			}
+		}
+		if len(kept) == 0 {
+			continue // no extensions left
+		}
+		list.Bytes, list.FullBytes = kept, nil
+		b, err := asn1.Marshal(list)
+		if err != nil {
+			return nil, invalid
+		}
+		field.Bytes, field.FullBytes = b, nil
+		if b, err = asn1.Marshal(field); err != nil {
+			return nil, invalid
+		}
+		fields = append(fields, b...)
+	}
+	seq.Bytes, seq.FullBytes = fields, nil
+	return asn1.Marshal(seq)
+}
+
+func appendUint24(b []byte, n int) []byte {
+	return append(b, byte(n>>16), byte(n>>8), byte(n))
+}
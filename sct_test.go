@@ -0,0 +1,315 @@
+package hsts
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustKey(t *testing.T) *ecdsa.PrivateKey {
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+// signSCT returns an SCT by a log over an entry (type and signed entry).
+func signSCT(t *testing.T, log *ecdsa.PrivateKey, timestamp time.Time, entry []byte) []byte {
+	der, err := x509.MarshalPKIXPublicKey(&log.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := sha256.Sum256(der)
+	ts := binary.BigEndian.AppendUint64(nil, uint64(timestamp.UnixMilli()))
+	signed := append(append(append([]byte{0, 0}, ts...), entry...), 0, 0)
+	digest := sha256.Sum256(signed)
+	sig, err := ecdsa.SignASN1(rand.Reader, log, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sct := append([]byte{0}, id[:]...)
+	sct = append(sct, ts...)
+	sct = append(sct, 0, 0, 4, 3)
+	sct = binary.BigEndian.AppendUint16(sct, uint16(len(sig)))
+	return append(sct, sig...)
+}
+
+// sctList returns the value of an SCT list extension.
+func sctList(scts ...[]byte) []byte {
+	var list []byte
+	for _, sct := range scts {
+		list = binary.BigEndian.AppendUint16(list, uint16(len(sct)))
+		list = append(list, sct...)
+	}
+	b, _ := asn1.Marshal(append(binary.BigEndian.AppendUint16(nil, uint16(len(list))), list...))
+	return b
+}
+
+// ctChain is a certificate authority and a key for leaf certificates.
+type ctChain struct {
+	t      *testing.T
+	caKey  *ecdsa.PrivateKey
+	ca     *x509.Certificate
+	key    *ecdsa.PrivateKey
+	serial int64
+}
+
+func newCTChain(t *testing.T) *ctChain {
+	c := &ctChain{t: t, caKey: mustKey(t), key: mustKey(t)}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &c.caKey.PublicKey, c.caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.ca, err = x509.ParseCertificate(der); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// leaf returns a leaf certificate, with embedded SCTs by the given logs.
+func (c *ctChain) leaf(logs ...*ecdsa.PrivateKey) *x509.Certificate {
+	c.serial++
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(c.serial),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		DNSNames:     []string{"example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	create := func() *x509.Certificate {
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, c.ca, &c.key.PublicKey, c.caKey)
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		return cert
+	}
+	if len(logs) == 0 {
+		return create()
+	}
+	// The precertificate is the same without the extension.
+	tbs := create().RawTBSCertificate
+	keyHash := sha256.Sum256(c.ca.RawSubjectPublicKeyInfo)
+	entry := append([]byte{0, 1}, keyHash[:]...)
+	entry = append(appendUint24(entry, len(tbs)), tbs...)
+	var scts [][]byte
+	for _, log := range logs {
+		scts = append(scts, signSCT(c.t, log, time.Now().Add(-time.Minute), entry))
+	}
+	tmpl.ExtraExtensions = []pkix.Extension{{Id: oidSCTList, Value: sctList(scts...)}}
+	return create()
+}
+
+// x509Entry returns the entry of SCTs over a certificate.
+func x509Entry(cert *x509.Certificate) []byte {
+	return append(appendUint24([]byte{0, 0}, len(cert.Raw)), cert.Raw...)
+}
+
+func ctLogsOf(t *testing.T, keys ...*ecdsa.PrivateKey) map[[sha256.Size]byte]crypto.PublicKey {
+	var logs []CTLog
+	for _, k := range keys {
+		logs = append(logs, CTLog{Description: "test", Key: &k.PublicKey})
+	}
+	byID, err := newCTLogs(logs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return byID
+}
+
+func TestVerifySCTs(t *testing.T) {
+	log1, log2, unknown := mustKey(t), mustKey(t), mustKey(t)
+	logs := ctLogsOf(t, log1, log2)
+	c := newCTChain(t)
+	now := time.Now()
+	plain := c.leaf()
+
+	for _, tt := range []struct {
+		name  string
+		leaf  *x509.Certificate
+		scts  [][]byte
+		valid int
+	}{
+		{"none", plain, nil, 0},
+		{"handshake", plain, [][]byte{
+			signSCT(t, log1, now, x509Entry(plain)),
+			signSCT(t, log2, now, x509Entry(plain)),
+		}, 2},
+		{"handshake same log", plain, [][]byte{
+			signSCT(t, log1, now, x509Entry(plain)),
+			signSCT(t, log1, now, x509Entry(plain)),
+		}, 1},
+		{"handshake unknown log", plain, [][]byte{signSCT(t, unknown, now, x509Entry(plain))}, 0},
+		{"handshake future", plain, [][]byte{signSCT(t, log1, now.Add(time.Hour), x509Entry(plain))}, 0},
+		{"handshake other certificate", plain, [][]byte{signSCT(t, log1, now, x509Entry(c.leaf()))}, 0},
+		{"handshake garbage", plain, [][]byte{[]byte("garbage")}, 0},
+		{"embedded", c.leaf(log1, log2), nil, 2},
+		{"embedded unknown log", c.leaf(log1, unknown), nil, 1},
+		{"both", c.leaf(log1), [][]byte{signSCT(t, log2, now, x509Entry(plain))}, 1}, // handshake SCT for another certificate
+	} {
+		valid, err := verifySCTs(logs, tt.leaf, c.ca, tt.scts, now)
+		if valid != tt.valid {
+			t.Errorf("%v: got %d valid SCTs (%v); want %d", tt.name, valid, err, tt.valid)
+		}
+	}
+
+	// A certificate changed after the SCTs were issued does not verify.
+	leaf := c.leaf(log1)
+	tbs := []byte(strings.Replace(string(leaf.RawTBSCertificate), "example.com", "examplf.com", 1))
+	tampered := *leaf
+	tampered.RawTBSCertificate = tbs
+	if valid, _ := verifySCTs(logs, &tampered, c.ca, nil, now); valid != 0 {
+		t.Errorf("tampered: got %d valid SCTs; want 0", valid)
+	}
+}
+
+func TestRemoveExtension(t *testing.T) {
+	// Embedded SCTs verify only if it is removed, see TestVerifySCTs.
+	leaf := newCTChain(t).leaf()
+	tbs, err := removeExtension(leaf.RawTBSCertificate, oidSCTList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(tbs) != string(leaf.RawTBSCertificate) {
+		t.Error("removeExtension() changed a TBSCertificate without the extension")
+	}
+	if _, err := removeExtension([]byte("garbage"), oidSCTList); err == nil {
+		t.Error("removeExtension(garbage) got no error")
+	}
+}
+
+// sctTransport replies over TLS with a certificate chain and SCTs.
+type sctTransport struct {
+	chain []*x509.Certificate
+	scts  [][]byte
+}
+
+func (f *sctTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := reply(req, "HTTP/1.1 200 OK\r\n\r\n")
+	if err != nil {
+		return nil, err
+	}
+	resp.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{f.chain}, SignedCertificateTimestamps: f.scts}
+	return resp, nil
+}
+
+func TestRequireSCTs(t *testing.T) {
+	log1, log2 := mustKey(t), mustKey(t)
+	c := newCTChain(t)
+	for _, tt := range []struct {
+		url   string
+		leaf  *x509.Certificate
+		valid bool
+	}{
+		{"https://example.com/", c.leaf(log1, log2), true},
+		{"https://example.com/", c.leaf(log1), false},
+		{"http://example.com/", c.leaf(), true},  // upgraded when followed
+		{"https://example.org/", c.leaf(), true}, // not an HSTS host
+	} {
+		transport := New(&sctTransport{chain: []*x509.Certificate{tt.leaf, c.ca}},
+			WithRequireSCTs([]CTLog{{Key: &log1.PublicKey}, {Key: &log2.PublicKey}}))
+		transport.put("example.com", newDirective(time.Now(), time.Hour, 0))
+		req, err := http.NewRequest("GET", tt.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := transport.RoundTrip(req)
+		if got := transport.Stats(); req.URL.Scheme == "https" && (got.LookupHits != 0 || got.LookupMisses != 0) {
+			t.Errorf("%v: got %v hits and %v misses; want checking SCTs not counted", tt.url, got.LookupHits, got.LookupMisses)
+		}
+		if tt.valid {
+			if err != nil {
+				t.Errorf("%v: got error %v", tt.url, err)
+				continue
+			}
+			ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			continue
+		}
+		var sctErr *SCTError
+		if !errors.As(err, &sctErr) || sctErr.Host != "example.com" || sctErr.Valid != 1 {
+			t.Errorf("%v: got error %v; want an SCTError with 1 valid SCT", tt.url, err)
+		}
+	}
+}
+
+func TestRequireSCTsLogs(t *testing.T) {
+	log1, log2 := mustKey(t), mustKey(t)
+	for _, tt := range []struct {
+		name   string
+		logs   []CTLog
+		panics bool
+	}{
+		{"two logs", []CTLog{{Key: &log1.PublicKey}, {Key: &log2.PublicKey}}, false},
+		{"one log", []CTLog{{Key: &log1.PublicKey}}, true},
+		{"the same log twice", []CTLog{{Key: &log1.PublicKey}, {Key: &log1.PublicKey}}, true},
+		{"empty", []CTLog{}, true},
+		{"embedded", nil, len(embeddedCTLogs) < MinSCTs},
+	} {
+		func() {
+			defer func() {
+				if r := recover(); (r != nil) != tt.panics {
+					t.Errorf("%v: New() panicked with %v; want panic %v", tt.name, r, tt.panics)
+				}
+			}()
+			New(nil, WithRequireSCTs(tt.logs))
+		}()
+	}
+}
+
+func TestVerifySCTsConnection(t *testing.T) {
+	log1, log2 := mustKey(t), mustKey(t)
+	c := newCTChain(t)
+	transport := New(nil, WithRequireSCTs([]CTLog{{Key: &log1.PublicKey}, {Key: &log2.PublicKey}}))
+	transport.put("example.com", newDirective(time.Now(), time.Hour, 0))
+	for _, tt := range []struct {
+		host  string
+		leaf  *x509.Certificate
+		valid bool
+	}{
+		{"example.com", c.leaf(log1, log2), true},
+		{"example.com", c.leaf(log1), false},
+		{"example.org", c.leaf(), true}, // not an HSTS host
+	} {
+		cs := tls.ConnectionState{ServerName: tt.host, VerifiedChains: [][]*x509.Certificate{{tt.leaf, c.ca}}}
+		err := transport.VerifySCTs(cs)
+		var sctErr *SCTError
+		if valid := !errors.As(err, &sctErr); valid != tt.valid {
+			t.Errorf("%v: VerifySCTs() = %v; want valid %v", tt.host, err, tt.valid)
+		}
+	}
+	if got := transport.Stats(); got.LookupHits != 0 || got.LookupMisses != 0 {
+		t.Errorf("got %v hits and %v misses; want verifying SCTs not counted", got.LookupHits, got.LookupMisses)
+	}
+	cs := tls.ConnectionState{ServerName: "example.com"}
+	if err := New(nil).VerifySCTs(cs); err != nil {
+		t.Errorf("VerifySCTs() without WithRequireSCTs = %v; want nil", err)
+	}
+}
@@ -0,0 +1,191 @@
+package hsts
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// A ServerOption changes the default behavior of server middleware, see
+// Middleware and Redirect.
+type ServerOption func(*server)
+
+// WithForwardedHeaders trusts the Forwarded (RFC 7239) and X-Forwarded-Proto
+// headers set by a reverse proxy terminating TLS, to tell whether requests
+// were received over TLS, only from the given proxies: any client can set
+// them, so from none if none are given. To trust any remote address, give
+// 0.0.0.0/0 and ::/0, only if clients cannot reach the server directly.
+// Forwarded is used if present, and the last value of a list is used, as the
+// one appended by the nearest proxy. It is disabled by default.
+func WithForwardedHeaders(proxies ...netip.Prefix) ServerOption {
+	return func(s *server) {
+		s.forwarded = true
+		s.proxies = proxies
+	}
+}
+
+// server holds the configuration of server middleware.
+type server struct {
+	header    string
+	forwarded bool
+	proxies   []netip.Prefix
+}
+
+func newServer(policy Policy, opts []ServerOption) *server {
+	header, err := policy.Header()
+	if err != nil {
+		panic(err)
+	}
+	s := &server{header: header}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Middleware returns server middleware setting a Strict-Transport-Security
+// header with the policy on responses to requests received over TLS.
+// It is never set over plaintext, where clients must ignore it (RFC 6797 7.2).
+// It panics if the policy is invalid, see Policy.Header.
+func Middleware(policy Policy, opts ...ServerOption) func(http.Handler) http.Handler {
+	s := newServer(policy, opts)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if s.secure(r) {
+				w.Header().Set("Strict-Transport-Security", s.header)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Redirect returns server middleware like Middleware, which also redirects
+// requests received over plaintext to HTTPS on the default port (RFC 6797 7.2)
+// instead of handling them: 301 Moved Permanently for GET and HEAD, 308
+// Permanent Redirect for other methods so that they are not changed to GET.
+func Redirect(policy Policy, opts ...ServerOption) func(http.Handler) http.Handler {
+	s := newServer(policy, opts)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !s.secure(r) {
+				code := http.StatusPermanentRedirect
+				if r.Method == http.MethodGet || r.Method == http.MethodHead {
+					code = http.StatusMovedPermanently
+				}
+				redirectHTTPS(w, r, code)
+				return
+			}
+			w.Header().Set("Strict-Transport-Security", s.header)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RedirectHandler returns a handler redirecting requests for known HSTS hosts
+// to HTTPS on the default port with 308 Permanent Redirect, and passing other
+// requests to next, or replying 404 Not Found if nil. Use it in front of
+// plaintext handlers such as port 80 shims and captive frontends, so that
+// plaintext content is never served for HSTS hosts. For the preload list only,
+// use a Transport from New(nil). Requests with a tenant (see WithTenant) are
+// redirected for its hosts.
+func (t *Transport) RedirectHandler(next http.Handler) http.Handler {
+	if next == nil {
+		next = http.NotFoundHandler()
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := t.Tenant(ContextTenant(r.Context())).Lookup(r.Host); ok {
+			redirectHTTPS(w, r, http.StatusPermanentRedirect)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// redirectHTTPS redirects a request to HTTPS on the default port.
+func redirectHTTPS(w http.ResponseWriter, r *http.Request, code int) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+	}
+	if host == "" {
+		http.Error(w, "missing host", http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), code)
+}
+
+// secure returns whether a request was received over TLS, directly or through
+// a trusted proxy.
+func (s *server) secure(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	if !s.forwarded || !s.trusted(r.RemoteAddr) {
+		return false
+	}
+	if values := r.Header.Values("Forwarded"); len(values) > 0 {
+		return strings.EqualFold(forwardedProto(last(values)), "https")
+	}
+	if values := r.Header.Values("X-Forwarded-Proto"); len(values) > 0 {
+		return strings.EqualFold(strings.TrimSpace(last(values)), "https")
+	}
+	return false
+}
+
+// trusted returns whether forwarded headers are trusted from a remote address.
+func (s *server) trusted(remoteAddr string) bool {
+	addr, err := netip.ParseAddrPort(remoteAddr)
+	if err != nil {
+		return false
+	}
+	for _, p := range s.proxies {
+		if p.Contains(addr.Addr().Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+// last returns the last element of comma-separated header values.
+func last(values []string) string {
+	elements := splitQuoted(values[len(values)-1], ',')
+	return elements[len(elements)-1]
+}
+
+// forwardedProto returns the proto parameter of a Forwarded element.
+func forwardedProto(element string) string {
+	for _, pair := range splitQuoted(element, ';') {
+		name, value, _ := strings.Cut(strings.TrimSpace(pair), "=")
+		if strings.EqualFold(name, "proto") {
+			if v, ok := unquote(value); ok {
+				return v
+			}
+			return value
+		}
+	}
+	return ""
+}
+
+// splitQuoted splits a header value around a separator outside of quoted
+// strings (section 3.2.6 of RFC 7230), which Forwarded values may be (RFC
+// 7239 section 4) and which may contain it.
+func splitQuoted(v string, sep byte) []string {
+	var parts []string
+	quoted, start := false, 0
+	for i := 0; i < len(v); i++ {
+		switch c := v[i]; {
+		case quoted && c == '\\':
+			i++ // quoted-pair
+		case c == '"':
+			quoted = !quoted
+		case !quoted && c == sep:
+			parts = append(parts, v[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, v[start:])
+}
@@ -0,0 +1,148 @@
+package hsts
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestMiddleware(t *testing.T) {
+	policy := Policy{MaxAge: MinPreloadMaxAge, IncludeSubDomains: true, Preload: true}
+	handler := Middleware(policy)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+
+	for _, tt := range []struct {
+		tls  bool
+		want string
+	}{
+		{false, ""},
+		{true, "max-age=31536000; includeSubDomains; preload"},
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		if tt.tls {
+			req.TLS = &tls.ConnectionState{}
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if got := rec.Header().Get("Strict-Transport-Security"); got != tt.want {
+			t.Errorf("over TLS %v got header %q; want %q", tt.tls, got, tt.want)
+		}
+	}
+}
+
+func TestMiddlewareInvalid(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("invalid policy did not panic")
+		}
+	}()
+	Middleware(Policy{MaxAge: time.Hour, Preload: true})
+}
+
+func TestRedirectMiddleware(t *testing.T) {
+	policy := Policy{MaxAge: time.Hour}
+	handler := Redirect(policy)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+
+	for _, tt := range []struct {
+		method, url string
+		code        int
+		location    string
+	}{
+		{"GET", "http://example.com/a?b=c", http.StatusMovedPermanently, "https://example.com/a?b=c"},
+		{"HEAD", "http://example.com:8080/", http.StatusMovedPermanently, "https://example.com/"},
+		{"POST", "http://[::1]:80/form", http.StatusPermanentRedirect, "https://[::1]/form"},
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.url, nil))
+		if rec.Code != tt.code || rec.Header().Get("Location") != tt.location {
+			t.Errorf("%v %v got %v to %q; want %v to %q", tt.method, tt.url, rec.Code, rec.Header().Get("Location"), tt.code, tt.location)
+		}
+		if rec.Header().Get("Strict-Transport-Security") != "" {
+			t.Errorf("%v %v got header over plaintext", tt.method, tt.url)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "https://example.com/", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Header().Get("Strict-Transport-Security") != "max-age=3600" {
+		t.Errorf("over TLS got %v with header %q", rec.Code, rec.Header().Get("Strict-Transport-Security"))
+	}
+}
+
+func TestForwardedHeaders(t *testing.T) {
+	proxy := netip.MustParsePrefix("10.0.0.0/8")
+	all := netip.MustParsePrefix("0.0.0.0/0")
+	for _, tt := range []struct {
+		opts       []ServerOption
+		remoteAddr string
+		header     http.Header
+		secure     bool
+	}{
+		{nil, "10.0.0.1:1234", http.Header{"X-Forwarded-Proto": {"https"}}, false},                                     // not trusted
+		{[]ServerOption{WithForwardedHeaders()}, "192.0.2.1:1234", http.Header{"X-Forwarded-Proto": {"https"}}, false}, // no proxies
+		{[]ServerOption{WithForwardedHeaders(all)}, "192.0.2.1:1234", http.Header{"X-Forwarded-Proto": {"https"}}, true},
+		{[]ServerOption{WithForwardedHeaders(all)}, "192.0.2.1:1234", http.Header{"X-Forwarded-Proto": {"http"}}, false},
+		{[]ServerOption{WithForwardedHeaders(all)}, "192.0.2.1:1234", http.Header{"X-Forwarded-Proto": {"https, http"}}, false},
+		{[]ServerOption{WithForwardedHeaders(all)}, "192.0.2.1:1234", http.Header{"X-Forwarded-Proto": {"http", "HTTPS"}}, true},
+		{[]ServerOption{WithForwardedHeaders(all)}, "192.0.2.1:1234", http.Header{"Forwarded": {`for=192.0.2.2;proto=https`}}, true},
+		{[]ServerOption{WithForwardedHeaders(all)}, "192.0.2.1:1234", http.Header{"Forwarded": {`proto=https, for=192.0.2.2;proto="http"`}}, false},
+		{[]ServerOption{WithForwardedHeaders(all)}, "192.0.2.1:1234", http.Header{"Forwarded": {`for=x`}, "X-Forwarded-Proto": {"https"}}, false},
+		{[]ServerOption{WithForwardedHeaders(all)}, "192.0.2.1:1234", http.Header{"Forwarded": {`proto=http, proto=https;by="a, b"`}}, true},
+		{[]ServerOption{WithForwardedHeaders(all)}, "192.0.2.1:1234", http.Header{"Forwarded": {`proto=https, proto=http;by="a\", b"`}}, false},
+		{[]ServerOption{WithForwardedHeaders(all)}, "192.0.2.1:1234", http.Header{"Forwarded": {`by="a;proto=https";proto=http`}}, false},
+		{[]ServerOption{WithForwardedHeaders(all)}, "192.0.2.1:1234", http.Header{"Forwarded": {`proto="ht\tps"`}}, true},
+		{[]ServerOption{WithForwardedHeaders(proxy)}, "10.0.0.1:1234", http.Header{"X-Forwarded-Proto": {"https"}}, true},
+		{[]ServerOption{WithForwardedHeaders(proxy)}, "[::ffff:10.0.0.1]:1234", http.Header{"X-Forwarded-Proto": {"https"}}, true},
+		{[]ServerOption{WithForwardedHeaders(proxy)}, "192.0.2.1:1234", http.Header{"X-Forwarded-Proto": {"https"}}, false},
+	} {
+		s := newServer(Policy{MaxAge: time.Hour}, tt.opts)
+		req := httptest.NewRequest("GET", "http://example.com/", nil)
+		req.RemoteAddr = tt.remoteAddr
+		req.Header = tt.header
+		if got := s.secure(req); got != tt.secure {
+			t.Errorf("from %v with %v got secure %v; want %v", tt.remoteAddr, tt.header, got, tt.secure)
+		}
+	}
+}
+
+func TestRedirectHandler(t *testing.T) {
+	transport := New(&fakeTransport{})
+	transport.put("example.com", newDirective(time.Now(), time.Hour, flagIncludeSubDomains))
+	handler := transport.RedirectHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("plaintext"))
+	}))
+
+	for _, tt := range []struct {
+		method, url string
+		location    string
+	}{
+		{"GET", "http://example.com/a?b", "https://example.com/a?b"},
+		{"POST", "http://sub.example.com:80/", "https://sub.example.com/"},
+		{"GET", "http://example.org/", ""},
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.url, nil))
+		if tt.location == "" {
+			if rec.Code != http.StatusOK || rec.Body.String() != "plaintext" {
+				t.Errorf("%v %v got %v %q; want passed to next", tt.method, tt.url, rec.Code, rec.Body.String())
+			}
+			continue
+		}
+		if rec.Code != http.StatusPermanentRedirect || rec.Header().Get("Location") != tt.location {
+			t.Errorf("%v %v got %v to %q; want 308 to %q", tt.method, tt.url, rec.Code, rec.Header().Get("Location"), tt.location)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	transport.RedirectHandler(nil).ServeHTTP(rec, httptest.NewRequest("GET", "http://example.org/", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("without next got %v; want 404", rec.Code)
+	}
+}
@@ -0,0 +1,247 @@
+package hsts
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A shard is a part of the state with its own lock, so that writes to
+// different shards do not contend.
+type shard struct {
+	m     sync.RWMutex         // protects state and uses
+	state map[string]directive // key is canonical host without port (RFC section 8.3)
+	uses  map[string]*usage    // of dynamic entries, nil unless bounded (see WithMaxEntries)
+}
+
+// delete deletes the entry of a host, whose lock must be held.
+func (s *shard) delete(host string) {
+	delete(s.state, host)
+	delete(s.uses, host)
+}
+
+// newShards creates n empty shards.
+// The preload list is shared and not copied, see get.
+func newShards(n int) []*shard {
+	if n < 1 {
+		n = 1
+	}
+	shards := make([]*shard, n)
+	for i := range shards {
+		shards[i] = &shard{state: make(map[string]directive)}
+	}
+	return shards
+}
+
+// Directives of preloaded hosts, shared by all of them.
+var (
+	preloadedIncludeSubDomains = directive{flags: flagIncludeSubDomains}
+	preloadedHostOnly          = directive{}
+)
+
+// tombstone is the entry of a preloaded host removed with max-age=0, which
+// hides it from the shared preload list.
+var tombstone = directive{flags: flagTombstone}
+
+// removed tells whether a directive is a tombstone.
+func (d directive) removed() bool {
+	return d.flags&flagTombstone != 0
+}
+
+func shardIndex(host string, n int) int {
+	if n == 1 {
+		return 0
+	}
+	return int(hash(host) % uint32(n))
+}
+
+// shard returns the shard of a host.
+func (t *Transport) shard(host string) *shard {
+	return t.shards[shardIndex(host, len(t.shards))]
+}
+
+// entry returns the entry of a host as is, even if expired.
+func (t *Transport) entry(host string) (directive, bool) {
+	s := t.shard(host)
+	s.m.RLock()
+	defer s.m.RUnlock()
+	d, ok := s.state[host]
+	return d, ok
+}
+
+// put sets the entry of a host.
+func (t *Transport) put(host string, d directive) {
+	t.set(host, d)
+	t.store.invalidate(host)
+	t.notifyChanged(host, d)
+}
+
+// set sets the entry of a host, evicting others if the state is full,
+// without notifying subscribers.
+func (t *Transport) set(host string, d directive) {
+	s := t.shard(host)
+	s.m.Lock()
+	evicted := t.setLocked(s, host, d, t.now())
+	s.m.Unlock()
+	t.evicted(evicted)
+}
+
+// setLocked sets the entry of a host in its shard, whose lock must be held,
+// and returns the entries evicted to make room.
+func (t *Transport) setLocked(s *shard, host string, d directive, now time.Time) []Entry {
+	var evicted []Entry
+	if s.uses != nil {
+		if d.removed() {
+			delete(s.uses, host)
+		} else if _, ok := s.uses[host]; !ok { // renewals keep their usage
+			if _, ok := s.state[host]; !ok {
+				evicted = t.store.evict(s, now)
+			}
+			s.uses[host] = newUsage(now)
+		}
+	}
+	s.state[host] = d
+	return evicted
+}
+
+// putTombstone hides a preloaded host removed at a time.
+func (t *Transport) putTombstone(host string, at time.Time) {
+	t.set(host, tombstone)
+	t.store.invalidate(host)
+	t.notifyRemoved([]string{host}, at)
+}
+
+// remove removes the entry of a host, removed at a time.
+func (t *Transport) remove(host string, at time.Time) {
+	s := t.shard(host)
+	s.m.Lock()
+	d, ok := s.state[host]
+	s.delete(host)
+	s.m.Unlock()
+	if ok && !d.removed() {
+		t.notifyRemoved([]string{host}, at)
+	}
+}
+
+// forget removes the entry of a host, unless a tombstone, without notifying
+// subscribers.
+func (t *Transport) forget(host string) {
+	s := t.shard(host)
+	s.m.Lock()
+	defer s.m.Unlock()
+	if d, ok := s.state[host]; ok && !d.removed() {
+		s.delete(host)
+	}
+}
+
+// entries returns the dynamic entries which have not expired, sorted by host.
+func (t *Transport) entries(now time.Time) []Entry {
+	var entries []Entry
+	for _, s := range t.shards {
+		s.m.RLock()
+		for host, d := range s.state {
+			if !d.removed() && !d.expired(now) {
+				entries = append(entries, newEntry(host, d))
+			}
+		}
+		s.m.RUnlock()
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Host < entries[j].Host })
+	return entries
+}
+
+// size returns the number of dynamic entries, not counting tombstones.
+func (t *Transport) size() int {
+	n := 0
+	for _, s := range t.shards {
+		s.m.RLock()
+		for _, d := range s.state {
+			if !d.removed() {
+				n++
+			}
+		}
+		s.m.RUnlock()
+	}
+	return n
+}
+
+// defaultNegativeCacheSize is the default size of the negative cache.
+const defaultNegativeCacheSize = 1024
+
+// A negativeCache remembers recent hosts for which no policy was found, so
+// that hot hosts without HSTS are not looked up again on every request.
+// A nil cache is disabled.
+type negativeCache struct {
+	m          sync.RWMutex        // protects all below
+	size       int                 // maximum number of hosts
+	generation uint64              // incremented on invalidation
+	hosts      map[string]struct{} // canonical hosts without a policy
+}
+
+func newNegativeCache(size int) *negativeCache {
+	if size <= 0 {
+		return nil
+	}
+	return &negativeCache{size: size, hosts: make(map[string]struct{})}
+}
+
+// has tells whether a host is known to have no policy, or else returns the
+// generation to give to add after looking it up.
+func (c *negativeCache) has(host string) (bool, uint64) {
+	if c == nil {
+		return false, 0
+	}
+	c.m.RLock()
+	defer c.m.RUnlock()
+	_, ok := c.hosts[host]
+	return ok, c.generation
+}
+
+// add remembers that a host has no policy, unless the cache was invalidated
+// since the generation returned by has, as the lookup may then be stale.
+// When full, an arbitrary host is evicted.
+func (c *negativeCache) add(host string, generation uint64) {
+	if c == nil {
+		return
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+	if generation != c.generation {
+		return
+	}
+	if len(c.hosts) >= c.size {
+		for h := range c.hosts {
+			delete(c.hosts, h)
+			break
+		}
+	}
+	c.hosts[host] = struct{}{}
+}
+
+// clear forgets all hosts, when many now may have a policy.
+func (c *negativeCache) clear() {
+	if c == nil {
+		return
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.generation++
+	c.hosts = make(map[string]struct{})
+}
+
+// invalidate forgets a host and its subdomains, which now may have a policy.
+func (c *negativeCache) invalidate(host string) {
+	if c == nil {
+		return
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.generation++
+	suffix := "." + host
+	for h := range c.hosts {
+		if h == host || strings.HasSuffix(h, suffix) {
+			delete(c.hosts, h)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package hsts
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// stateFileDelay is how long a change waits before the state file is
+// written, so that learning many hosts at once writes it once.
+const stateFileDelay = time.Second
+
+// OpenStateFile opens a Storage keeping learned policies in a file, as a
+// JSON StateSnapshot, so that they survive restarts (see WithStorage). The
+// file is created when first written if it does not exist, and replaced
+// atomically a second after changes, all at once: it suits the policies of
+// one process, not a fleet sharing them. Expired policies are dropped when
+// it is written. The caller should call Close when finished, to write the
+// last changes.
+func OpenStateFile(path string) (*StateFile, error) {
+	f := &StateFile{path: path, delay: stateFileDelay, entries: make(map[string]Entry)}
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s StateSnapshot
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("hsts: state file %v: %w", path, err)
+	}
+	for _, e := range s.Entries {
+		f.entries[e.Host] = e
+	}
+	return f, nil
+}
+
+// A StateFile is a Storage in a file, see OpenStateFile.
+type StateFile struct {
+	path    string
+	delay   time.Duration
+	writing sync.Mutex // serializes writing the file
+	m       sync.Mutex // protects all below
+	entries map[string]Entry
+	dirty   bool        // changed since written
+	timer   *time.Timer // to write the changes, if dirty
+	err     error       // failure to write in the background
+	closed  bool
+}
+
+func (f *StateFile) Get(ctx context.Context, host string) (Entry, bool, error) {
+	f.m.Lock()
+	defer f.m.Unlock()
+	e, ok := f.entries[host]
+	return e, ok, nil
+}
+
+func (f *StateFile) Put(ctx context.Context, e Entry) error {
+	return f.PutBatch(ctx, []Entry{e})
+}
+
+// PutBatch puts entries, to be written with other changes. It returns a
+// failure to write earlier changes, if any.
+func (f *StateFile) PutBatch(ctx context.Context, entries []Entry) error {
+	f.m.Lock()
+	for _, e := range entries {
+		f.entries[e.Host] = e
+	}
+	return f.changed()
+}
+
+// Delete deletes the entry of a host, to be written with other changes. It
+// returns a failure to write earlier changes, if any.
+func (f *StateFile) Delete(ctx context.Context, host string) error {
+	f.m.Lock()
+	if _, ok := f.entries[host]; !ok {
+		f.m.Unlock()
+		return nil
+	}
+	delete(f.entries, host)
+	return f.changed()
+}
+
+// changed notes a change, whose lock must be held and which it releases, and
+// has it written later, unless closed then right away.
+func (f *StateFile) changed() error {
+	f.dirty = true
+	if f.closed {
+		f.m.Unlock()
+		return f.flush()
+	}
+	if f.timer == nil {
+		f.timer = time.AfterFunc(f.delay, func() {
+			if err := f.flush(); err != nil {
+				f.m.Lock()
+				f.err = err
+				f.m.Unlock()
+			}
+		})
+	}
+	err := f.err
+	f.err = nil
+	f.m.Unlock()
+	return err
+}
+
+// Flush writes the changes not written yet, if any.
+func (f *StateFile) Flush() error {
+	err := f.flush()
+	f.m.Lock()
+	f.err = nil
+	f.m.Unlock()
+	return err
+}
+
+// Close writes the changes not written yet, if any. Changes after it are
+// written right away.
+func (f *StateFile) Close() error {
+	f.m.Lock()
+	f.closed = true
+	f.m.Unlock()
+	return f.Flush()
+}
+
+// flush writes the file if it changed since written.
+func (f *StateFile) flush() error {
+	f.writing.Lock()
+	defer f.writing.Unlock()
+	f.m.Lock()
+	if f.timer != nil {
+		f.timer.Stop()
+		f.timer = nil
+	}
+	if !f.dirty {
+		f.m.Unlock()
+		return nil
+	}
+	f.dirty = false
+	s := f.snapshot()
+	f.m.Unlock()
+	if err := f.write(s); err != nil {
+		f.m.Lock()
+		f.dirty = true // tried again with the next change, or Flush
+		f.m.Unlock()
+		return err
+	}
+	return nil
+}
+
+// snapshot returns the entries which have not expired, whose lock must be
+// held, dropping the others.
+func (f *StateFile) snapshot() StateSnapshot {
+	now := time.Now()
+	s := StateSnapshot{Time: now, Entries: make([]Entry, 0, len(f.entries))}
+	for host, e := range f.entries {
+		if !e.LongLived && e.Expires().Before(now) {
+			delete(f.entries, host)
+			continue
+		}
+		s.Entries = append(s.Entries, e)
+	}
+	sort.Slice(s.Entries, func(i, j int) bool { return s.Entries[i].Host < s.Entries[j].Host })
+	return s
+}
+
+// write writes a snapshot to the file through a temporary file renamed over
+// it so that it is never left half written.
+func (f *StateFile) write(s StateSnapshot) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), filepath.Base(f.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // once renamed, fails harmlessly
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path)
+}
@@ -0,0 +1,92 @@
+package hsts
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestStateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	f, err := OpenStateFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.delay = time.Hour // only written by Flush and Close
+	ctx := context.Background()
+	received := time.Now().Truncate(time.Second)
+	for _, host := range []string{"a.example.com", "b.example.com", "c.example.com"} {
+		if err := f.Put(ctx, Entry{Host: host, Received: received, Policy: Policy{MaxAge: time.Hour}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("state file written on Put: %v", err)
+	}
+	if err := f.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got := entriesOf(t, path); len(got) != 3 {
+		t.Errorf("flushed %v; want 3 entries", got)
+	}
+
+	if err := f.Delete(ctx, "a.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if got := entriesOf(t, path); len(got) != 3 {
+		t.Errorf("wrote %v on Delete; want it written later", got)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := entriesOf(t, path); len(got) != 2 {
+		t.Errorf("closed with %v; want 2 entries", got)
+	}
+	if err := f.Delete(ctx, "b.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if got := entriesOf(t, path); len(got) != 1 || got[0] != "c.example.com" {
+		t.Errorf("after Close wrote %v; want c.example.com right away", got)
+	}
+}
+
+func TestStateFileDelay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	f, err := OpenStateFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.delay = 10 * time.Millisecond
+	if err := f.Put(context.Background(), Entry{Host: "example.com", Received: time.Now(), Policy: Policy{MaxAge: time.Hour}}); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("state file not written after the delay")
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// entriesOf returns the hosts of the entries in a state file.
+func entriesOf(t *testing.T, path string) []string {
+	t.Helper()
+	f, err := OpenStateFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hosts []string
+	for host := range f.entries {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
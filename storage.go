@@ -0,0 +1,187 @@
+package hsts
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// A Storage durably stores learned policies outside of the process, e.g. in
+// Redis or SQL, so that a fleet of Transports shares them and they survive
+// restarts, see WithStorage. It must be safe for concurrent use.
+type Storage interface {
+	// Get returns the entry of a host, or false if there is none.
+	Get(ctx context.Context, host string) (Entry, bool, error)
+
+	// Put stores the entry of a host, replacing any.
+	Put(ctx context.Context, e Entry) error
+
+	// Delete deletes the entry of a host, if any.
+	Delete(ctx context.Context, host string) error
+}
+
+// Defaults for the cache of a Storage, see WithStorageCache.
+const (
+	defaultStorageCacheSize = 10000
+	defaultStorageCacheTTL  = time.Minute
+)
+
+// storageTimeout bounds each call to a Storage.
+const storageTimeout = time.Second
+
+// WithStorage makes the Transport read and write learned policies through a
+// Storage, caching them in its state so that hot hosts do not hit it on every
+// request (see WithStorageCache). Learned policies are written as they are
+// noted, and knock-outs (max-age=0) delete them, but not those of subdomains
+// (see WithKnockOut) which the Storage cannot list. Entries read from the
+// Storage are cached, not learned: subscribers (see State) are not notified.
+// The negative cache is disabled, as the Storage cache remembers hosts without
+// a policy for as long. Failures are logged and counted in Stats, and the
+// state is used as is. It is ignored WithStore.
+func WithStorage(s Storage) Option {
+	return func(t *Transport) {
+		t.storage = s
+	}
+}
+
+// WithStorageCache sets how many hosts are remembered as read from the
+// Storage, with or without a policy, and for how long before reading them
+// again, to see what other Transports learned or removed. Hosts and their
+// superdomains are each read once for that long. Unless set WithMaxEntries,
+// the state is bounded to as many entries. It is 10000 hosts for a minute by
+// default, and ignored WithStore.
+func WithStorageCache(size int, ttl time.Duration) Option {
+	return func(t *Transport) {
+		t.storageCacheSize = size
+		t.storageCacheTTL = ttl
+	}
+}
+
+// A storageCache remembers when hosts were last read from the Storage.
+type storageCache struct {
+	m     sync.Mutex // protects hosts
+	size  int        // maximum number of hosts
+	ttl   time.Duration
+	hosts map[string]storageRead
+}
+
+// A storageRead is when a host was read from the Storage, and what was found.
+type storageRead struct {
+	at     int64 // Unix time in nanoseconds
+	stored bool  // the Storage has a policy for the host
+}
+
+// useStorage makes the store use a Storage, see WithStorage.
+func (s *Store) useStorage(storage Storage, size int, ttl time.Duration) {
+	if size <= 0 {
+		size = defaultStorageCacheSize
+	}
+	if ttl <= 0 {
+		ttl = defaultStorageCacheTTL
+	}
+	s.storage = storage
+	s.cache = &storageCache{size: size, ttl: ttl, hosts: make(map[string]storageRead)}
+}
+
+// fresh tells whether a host was read recently enough, and whether the Storage
+// had a policy for it then, even if not fresh.
+func (c *storageCache) fresh(host string, now time.Time) (fresh, stored bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	r, ok := c.hosts[host]
+	return ok && now.UnixNano()-r.at < int64(c.ttl), r.stored
+}
+
+// note notes that a host was read from the Storage, or written to it.
+// When full, an arbitrary host is evicted.
+func (c *storageCache) note(host string, now time.Time, stored bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if _, ok := c.hosts[host]; !ok && len(c.hosts) >= c.size {
+		for h := range c.hosts {
+			delete(c.hosts, h)
+			break
+		}
+	}
+	c.hosts[host] = storageRead{at: now.UnixNano(), stored: stored}
+}
+
+// forget forgets a host, to read it again, e.g. once evicted from the state.
+func (c *storageCache) forget(host string) {
+	if c == nil {
+		return
+	}
+	c.m.Lock()
+	defer c.m.Unlock()
+	delete(c.hosts, host)
+}
+
+// readThrough caches the policy of a host from the Storage, unless read
+// recently. A policy it no longer has, e.g. removed by another Transport,
+// is removed, unlike one it never had, e.g. if writing it failed.
+// Reading stops when the context of the request is done, and is retried.
+func (t *Transport) readThrough(ctx context.Context, host string, now time.Time) {
+	c := t.store.cache
+	fresh, stored := c.fresh(host, now)
+	if fresh {
+		return
+	}
+	getCtx, cancel := context.WithTimeout(ctx, storageTimeout)
+	defer cancel()
+	e, ok, err := t.store.storage.Get(getCtx, host)
+	if err != nil {
+		if ctx.Err() != nil {
+			return // the request is done, the Storage did not fail
+		}
+		t.storageFailed("get", host, err)
+		c.note(host, now, stored) // do not retry on every request
+		return
+	}
+	if ok && !e.Preloaded && t.mayLearn(host) {
+		if d := t.entryDirective(host, e); !d.expired(now) {
+			cur, ok := t.entry(host)
+			if !ok || cur.removed() || !(cur.received().After(d.received()) || sameDirective(cur, d)) {
+				t.set(host, d)
+				t.store.invalidate(host)
+			}
+			c.note(host, now, true)
+			return
+		}
+	}
+	if stored {
+		t.forget(host)
+	}
+	c.note(host, now, false)
+}
+
+// writeThrough writes a policy learned for a host to the Storage, or deletes
+// it for max-age=0.
+func (t *Transport) writeThrough(host string, d directive) {
+	if t.store.storage == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), storageTimeout)
+	defer cancel()
+	if d.maxAge == 0 {
+		if err := t.store.storage.Delete(ctx, host); err != nil {
+			t.storageFailed("delete", host, err)
+			return
+		}
+		t.store.cache.note(host, t.now(), false)
+		return
+	}
+	if err := t.store.storage.Put(ctx, newEntry(host, d)); err != nil {
+		t.storageFailed("put", host, err)
+		return
+	}
+	t.store.cache.note(host, t.now(), true)
+}
+
+// storageFailed counts and logs a failure of the Storage, and returns it.
+func (t *Transport) storageFailed(op, host string, err error) error {
+	t.count(&t.counters.storageErrors)
+	if t.logger != nil {
+		t.logger.Warn("hsts: storage failed", "op", op, "host", host, "error", err)
+	}
+	return &StorageError{Op: op, Host: host, Err: err}
+}
@@ -0,0 +1,181 @@
+package hsts
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeStorage is a Storage in memory, counting reads.
+type fakeStorage struct {
+	m       sync.Mutex
+	entries map[string]Entry
+	gets    int
+	err     error // returned by all if set
+}
+
+func (s *fakeStorage) Get(ctx context.Context, host string) (Entry, bool, error) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.gets++
+	if s.err != nil {
+		return Entry{}, false, s.err
+	}
+	if err := ctx.Err(); err != nil {
+		return Entry{}, false, err
+	}
+	e, ok := s.entries[host]
+	return e, ok, nil
+}
+
+func (s *fakeStorage) Put(ctx context.Context, e Entry) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	if s.entries == nil {
+		s.entries = make(map[string]Entry)
+	}
+	s.entries[e.Host] = e
+	return nil
+}
+
+func (s *fakeStorage) Delete(ctx context.Context, host string) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	delete(s.entries, host)
+	return nil
+}
+
+func (s *fakeStorage) reads() int {
+	s.m.Lock()
+	defer s.m.Unlock()
+	n := s.gets
+	s.gets = 0
+	return n
+}
+
+func TestStorage(t *testing.T) {
+	storage := &fakeStorage{}
+	now := time.Now()
+	clock := WithClock(func() time.Time { return now })
+	a := New(&fakeTransport{}, WithStorage(storage), clock)
+	b := New(nil, WithStorage(storage), WithStorageCache(10, time.Minute), WithMatch(Exact), clock)
+
+	resp, err := (&http.Client{Transport: a}).Get("https://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if e, ok := storage.entries["example.com"]; !ok || e.MaxAge == 0 {
+		t.Fatalf("storage has %+v, %v; want example.com written through", e, ok)
+	}
+
+	// b reads it through once, then from its cache.
+	storage.reads()
+	for i := 0; i < 3; i++ {
+		if _, d, ok := b.lookup("example.com", now); !ok || d.maxAge == 0 {
+			t.Errorf("lookup %v: example.com not found through the storage", i)
+		}
+	}
+	if n := storage.reads(); n != 1 {
+		t.Errorf("read the storage %v times; want 1", n)
+	}
+	if _, _, ok := b.lookup("unknown.com", now); ok {
+		t.Error("unknown.com found")
+	}
+	b.lookup("unknown.com", now)
+	if n := storage.reads(); n != 1 {
+		t.Errorf("read the storage %v times for a host without policy; want 1", n)
+	}
+	if entries := b.entries(now); len(entries) != 1 {
+		t.Errorf("b has entries %+v; want example.com cached", entries)
+	}
+
+	// a knocks it out, which b sees once its cache expired.
+	a.add("example.com", directive{})
+	if _, ok := storage.entries["example.com"]; ok {
+		t.Error("knock-out not written through")
+	}
+	if _, _, ok := b.lookup("example.com", now.Add(30*time.Second)); !ok {
+		t.Error("b did not cache example.com")
+	}
+	if _, _, ok := b.lookup("example.com", now.Add(2*time.Minute)); ok {
+		t.Error("b did not forget example.com removed from the storage")
+	}
+}
+
+func TestStorageFailure(t *testing.T) {
+	storage := &fakeStorage{err: errors.New("down")}
+	transport := New(&fakeTransport{}, WithStorage(storage))
+	resp, err := (&http.Client{Transport: transport}).Get("https://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	// The write failed, but the policy is still noted.
+	for i := 0; i < 3; i++ {
+		if _, _, ok := transport.lookup("example.com", time.Now()); !ok {
+			t.Error("policy lost when the storage failed")
+		}
+	}
+	// One failed write, then one failed read not retried.
+	if got := transport.Stats().StorageErrors; got != 2 {
+		t.Errorf("storage errors = %v; want 2", got)
+	}
+}
+
+func TestStorageCanceled(t *testing.T) {
+	storage := &fakeStorage{}
+	now := time.Now()
+	storage.Put(context.Background(), newEntry("example.com", newDirective(now, time.Hour, 0)))
+	transport := New(&fakeTransport{}, WithStorage(storage), WithStorageCache(10, time.Minute), WithClock(func() time.Time { return now }))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", "http://example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := transport.needsUpgrade(req); ok {
+		t.Error("example.com upgraded; want the read through canceled")
+	}
+	if got := transport.Stats().StorageErrors; got != 0 {
+		t.Errorf("storage errors = %v; want a canceled request not counted", got)
+	}
+	// Not noted as read, so it is read again.
+	storage.reads()
+	if _, ok := transport.needsUpgrade(req.WithContext(context.Background())); !ok {
+		t.Error("example.com not upgraded after the canceled read through")
+	}
+	if n := storage.reads(); n != 1 {
+		t.Errorf("read the storage %v times; want 1", n)
+	}
+}
+
+func TestStorageEviction(t *testing.T) {
+	storage := &fakeStorage{}
+	now := time.Now()
+	transport := New(nil, WithStorage(storage), WithStorageCache(1, time.Hour), WithMatch(Exact))
+	for _, host := range []string{"a.com", "b.com"} {
+		storage.Put(context.Background(), newEntry(host, newDirective(now, time.Hour, 0)))
+	}
+	for _, host := range []string{"a.com", "b.com", "a.com"} {
+		if _, _, ok := transport.lookup(host, now); !ok {
+			t.Errorf("%v not found", host)
+		}
+	}
+	if n := transport.size(); n != 1 {
+		t.Errorf("state has %v entries; want it bounded to 1", n)
+	}
+	if got := transport.Stats().Evicted; got != 2 {
+		t.Errorf("evicted %v; want 2", got)
+	}
+}
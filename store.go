@@ -0,0 +1,88 @@
+package hsts
+
+import "sync"
+
+// A Store holds the dynamic state of Transports: the policies they learned.
+// Each Transport has its own unless created WithStore, so that Transports
+// wrapping different transports (e.g. one per tenant or proxy listener)
+// learn together. Create one with NewStore, or share that of a Transport (see
+// Transport.Store); the zero value is not usable. It is safe for concurrent
+// use.
+type Store struct {
+	shards      []*shard      // see shard
+	subscribers subscribers   // see StateReader.Subscribe
+	shardLimit  int           // maximum entries per shard if not 0, see WithMaxEntries
+	eviction    Eviction      // see WithEviction
+	storage     Storage       // see WithStorage
+	cache       *storageCache // of storage if set
+
+	m        sync.Mutex                     // protects negative
+	negative map[negativeKey]*negativeCache // hosts without a policy depend on the match algorithm and preload list
+}
+
+// A negativeKey is what hosts without a policy in a negative cache depend on.
+type negativeKey struct {
+	match     Match
+	noPreload bool // see WithPreloadList
+}
+
+// NewStore returns an empty store with a number of shards, see WithShards.
+// It is unbounded and without Storage: for those, share the store of a
+// Transport created WithMaxEntries, WithEviction or WithStorage instead.
+func NewStore(shards int) *Store {
+	return &Store{
+		shards:   newShards(shards),
+		negative: make(map[negativeKey]*negativeCache),
+	}
+}
+
+// Store returns the store of the Transport, to share it WithStore.
+func (t *Transport) Store() *Store {
+	return t.store
+}
+
+// WithStore makes the Transport use a store shared with other Transports,
+// instead of its own. WithShards is then ignored, and negative caches are
+// shared by Transports with the same match algorithm and preload list (see
+// WithPreloadList), with the size of the first one. Likewise WithMaxEntries,
+// WithEviction and WithStorage are ignored. Other options, like those
+// restricting learning, still apply to each Transport.
+func WithStore(s *Store) Option {
+	return func(t *Transport) {
+		t.store = s
+	}
+}
+
+// negativeCache returns the negative cache for a match algorithm and preload
+// list, created with size if it does not exist yet, or nil if disabled.
+func (s *Store) negativeCache(key negativeKey, size int) *negativeCache {
+	if size <= 0 {
+		return nil
+	}
+	s.m.Lock()
+	defer s.m.Unlock()
+	c, ok := s.negative[key]
+	if !ok {
+		c = newNegativeCache(size)
+		s.negative[key] = c
+	}
+	return c
+}
+
+// invalidate forgets a host and its subdomains in all negative caches.
+func (s *Store) invalidate(host string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	for _, c := range s.negative {
+		c.invalidate(host)
+	}
+}
+
+// invalidateAll forgets all hosts in all negative caches.
+func (s *Store) invalidateAll() {
+	s.m.Lock()
+	defer s.m.Unlock()
+	for _, c := range s.negative {
+		c.clear()
+	}
+}
@@ -0,0 +1,66 @@
+package hsts
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	a := New(&fakeTransport{})
+	b := New(&fakeTransport{}, WithStore(a.Store()), WithMatch(Exact))
+	c := New(&fakeTransport{}, WithStore(a.Store()))
+	other := New(&fakeTransport{})
+	if b.Store() != a.Store() || other.Store() == a.Store() {
+		t.Fatal("stores not shared as configured")
+	}
+
+	// Cache misses first, then learn through a.
+	for _, transport := range []*Transport{a, b, c} {
+		if _, ok := transport.Lookup("example.com"); ok {
+			t.Fatal("example.com known before learning")
+		}
+	}
+	if a.negative != c.negative || a.negative == b.negative {
+		t.Error("negative caches not shared by match algorithm")
+	}
+	resp, err := (&http.Client{Transport: a}).Get("https://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	for _, transport := range []*Transport{a, b, c} {
+		if _, ok := transport.Lookup("example.com"); !ok {
+			t.Errorf("example.com not known by all sharing the store")
+		}
+	}
+	if _, ok := other.Lookup("example.com"); ok {
+		t.Error("example.com known by a transport not sharing the store")
+	}
+
+	// Changes through any transport are seen by all subscribers.
+	var changes []Change
+	unsubscribe := a.State().Subscribe(func(c Change) { changes = append(changes, c) })
+	defer unsubscribe()
+	b.add("example.com", directive{}) // max-age=0
+	if len(changes) != 1 || !changes[0].Removed {
+		t.Errorf("got changes %+v; want example.com removed", changes)
+	}
+	if _, ok := c.Lookup("example.com"); ok {
+		t.Error("example.com still known after knock-out through another transport")
+	}
+}
+
+func TestNewStore(t *testing.T) {
+	s := NewStore(4)
+	a := New(&fakeTransport{}, WithStore(s))
+	b := New(&fakeTransport{}, WithStore(s))
+	resp, err := (&http.Client{Transport: a}).Get("https://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if _, ok := b.Lookup("example.com"); !ok || a.Store() != s {
+		t.Error("example.com not known by transports sharing a new store")
+	}
+}
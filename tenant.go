@@ -0,0 +1,114 @@
+package hsts
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+type tenantKey struct{}
+
+// WithTenant returns a context based on ctx with a tenant attached, e.g. a
+// customer or browser profile, to use as request context so that a Transport
+// learns and applies policies for that tenant only. Each tenant has its own
+// dynamic state, isolated from the others and from requests without a tenant,
+// while they all share the preload list. An empty tenant is no tenant.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// ContextTenant returns the tenant attached to ctx, or "" if none.
+func ContextTenant(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// WithTenantQuota bounds the number of dynamic entries of each tenant (see
+// WithTenant): when full, learning a new host evicts another one of the same
+// tenant, chosen WithEviction. It is 0 by default, which bounds tenants like
+// the Transport itself, see WithMaxEntries.
+func WithTenantQuota(n int) Option {
+	return func(t *Transport) {
+		t.tenantQuota = n
+	}
+}
+
+// Tenant returns the Transport sending requests of a tenant (see WithTenant),
+// created with the same options on first use, to look up, list or subscribe
+// to its dynamic state. Its Stats only count requests of the tenant, and
+// those of the Transport do not. It is the Transport itself for tenant "".
+func (t *Transport) Tenant(tenant string) *Transport {
+	if tenant == "" || t.tenant != "" {
+		return t
+	}
+	t.tenantsMu.Lock()
+	defer t.tenantsMu.Unlock()
+	if tt, ok := t.tenants[tenant]; ok {
+		return tt
+	}
+	if t.tenants == nil {
+		t.tenants = make(map[string]*Transport)
+	}
+	opts := append(t.opts[:len(t.opts):len(t.opts)], t.tenantOption(tenant))
+	tt := New(t.wrap, opts...)
+	t.tenants[tenant] = tt
+	return tt
+}
+
+// tenantOption makes a Transport that of a tenant, after the options of its
+// parent: it has its own store, bounded by quota, and does not publish.
+func (t *Transport) tenantOption(tenant string) Option {
+	return func(tt *Transport) {
+		tt.tenant = tenant
+		tt.store = nil
+		tt.expvarName = ""
+		if t.tenantQuota > 0 {
+			tt.maxEntries = t.tenantQuota
+		}
+		if tt.storage != nil {
+			tt.storage = &tenantStorage{Storage: tt.storage, prefix: tenant + "/"}
+		}
+	}
+}
+
+// Tenants returns the tenants which sent requests, sorted.
+func (t *Transport) Tenants() []string {
+	t.tenantsMu.Lock()
+	defer t.tenantsMu.Unlock()
+	tenants := make([]string, 0, len(t.tenants))
+	for tenant := range t.tenants {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+	return tenants
+}
+
+// RemoveTenant forgets the dynamic state of a tenant, e.g. once deleted.
+// Policies it stored WithStorage are kept.
+func (t *Transport) RemoveTenant(tenant string) {
+	t.tenantsMu.Lock()
+	defer t.tenantsMu.Unlock()
+	delete(t.tenants, tenant)
+}
+
+// A tenantStorage isolates the policies of a tenant in a shared Storage, by
+// prefixing hosts with the tenant, which hosts cannot contain.
+type tenantStorage struct {
+	Storage
+	prefix string // tenant followed by a slash
+}
+
+func (s *tenantStorage) Get(ctx context.Context, host string) (Entry, bool, error) {
+	e, ok, err := s.Storage.Get(ctx, s.prefix+host)
+	e.Host = strings.TrimPrefix(e.Host, s.prefix)
+	return e, ok, err
+}
+
+func (s *tenantStorage) Put(ctx context.Context, e Entry) error {
+	e.Host = s.prefix + e.Host
+	return s.Storage.Put(ctx, e)
+}
+
+func (s *tenantStorage) Delete(ctx context.Context, host string) error {
+	return s.Storage.Delete(ctx, s.prefix+host)
+}
@@ -0,0 +1,99 @@
+package hsts
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestTenant(t *testing.T) {
+	transport := New(&fakeTransport{})
+	get := func(tenant, url string) *http.Response {
+		req, err := http.NewRequestWithContext(WithTenant(context.Background(), tenant), "GET", url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	get("a", "https://example.com")
+	if resp := get("a", "http://example.com"); resp.StatusCode != http.StatusTemporaryRedirect {
+		t.Errorf("tenant a got %v; want upgraded", resp.Status)
+	}
+	for _, tenant := range []string{"b", ""} {
+		if resp := get(tenant, "http://example.com"); resp.StatusCode != http.StatusOK {
+			t.Errorf("tenant %q got %v; want not upgraded", tenant, resp.Status)
+		}
+	}
+	if _, ok := transport.Tenant("a").Lookup("example.com"); !ok {
+		t.Error("example.com not known to tenant a")
+	}
+	if _, ok := transport.Lookup("example.com"); ok {
+		t.Error("example.com known without a tenant")
+	}
+	if got, want := transport.Tenants(), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got tenants %v; want %v", got, want)
+	}
+	if transport.Tenant("") != transport || transport.Tenant("a").Tenant("b") != transport.Tenant("a") {
+		t.Error("Tenant does not nest")
+	}
+
+	transport.RemoveTenant("a")
+	if resp := get("a", "http://example.com"); resp.StatusCode != http.StatusOK {
+		t.Errorf("removed tenant a got %v; want not upgraded", resp.Status)
+	}
+}
+
+func TestTenantQuota(t *testing.T) {
+	transport := New(&fakeTransport{}, WithTenantQuota(1))
+	for _, host := range []string{"a.example", "b.example"} {
+		req, err := http.NewRequestWithContext(WithTenant(context.Background(), "a"), "GET", "https://"+host, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	tenant := transport.Tenant("a")
+	if n := len(tenant.entries(tenant.now())); n != 1 {
+		t.Errorf("tenant has %v entries; want 1", n)
+	}
+	if n := tenant.Stats().Evicted; n != 1 {
+		t.Errorf("tenant evicted %v entries; want 1", n)
+	}
+}
+
+func TestTenantStorage(t *testing.T) {
+	storage := &fakeStorage{}
+	transport := New(&fakeTransport{}, WithStorage(storage))
+	req, err := http.NewRequestWithContext(WithTenant(context.Background(), "a"), "GET", "https://example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if _, ok := storage.entries["a/example.com"]; !ok || len(storage.entries) != 1 {
+		t.Errorf("got stored %v; want a/example.com", storage.entries)
+	}
+
+	// Another Transport sharing the storage reads it for the same tenant only.
+	other := New(&fakeTransport{}, WithStorage(storage))
+	if e, ok := other.Tenant("a").Lookup("example.com"); !ok || e.Host != "example.com" {
+		t.Errorf("tenant a got %+v, %v; want example.com", e, ok)
+	}
+	if _, ok := other.Lookup("example.com"); ok {
+		t.Error("example.com known without a tenant")
+	}
+}
@@ -0,0 +1,46 @@
+package hsts
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// preloadedTLDs is the set of top-level domains preloaded with includeSubDomains,
+// built once for all transports as it takes a scan of the preload list.
+// They cannot be removed with max-age=0, see add.
+var (
+	preloadedTLDsOnce sync.Once
+	preloadedTLDs     map[string]struct{}
+)
+
+func buildPreloadedTLDs() {
+	if len(preloadIncludeSubDomains) == 1 {
+		return // empty, built with hsts_nopreload
+	}
+	preloadedTLDs = make(map[string]struct{})
+	each(preloadIncludeSubDomains, func(host string) {
+		if !strings.Contains(host, ".") {
+			preloadedTLDs[host] = struct{}{}
+		}
+	})
+}
+
+// isPreloadedTLD tells whether a canonical host is a preloaded top-level domain.
+func isPreloadedTLD(host string) bool {
+	preloadedTLDsOnce.Do(buildPreloadedTLDs)
+	_, ok := preloadedTLDs[host]
+	return ok
+}
+
+// PreloadedTLDs returns the top-level domains preloaded as a whole (e.g. dev, app),
+// meaning that every domain under them is forced to HTTPS.
+func PreloadedTLDs() []string {
+	preloadedTLDsOnce.Do(buildPreloadedTLDs)
+	var tlds []string
+	for tld := range preloadedTLDs {
+		tlds = append(tlds, tld)
+	}
+	sort.Strings(tlds)
+	return tlds
+}
@@ -0,0 +1,61 @@
+package hsts
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+)
+
+// A TLSError is returned by a Transport with a minimum TLS version when a
+// response from an HSTS host came over a connection below it, or with an
+// insecure cipher suite.
+type TLSError struct {
+	Host        string // the host the request was sent to
+	Version     uint16 // negotiated, see tls.VersionName
+	CipherSuite uint16 // negotiated, see tls.CipherSuiteName
+	MinVersion  uint16
+}
+
+func (e *TLSError) Error() string {
+	if e.Version < e.MinVersion {
+		return fmt.Sprintf("hsts: %v: %v below minimum %v", e.Host, tls.VersionName(e.Version), tls.VersionName(e.MinVersion))
+	}
+	return fmt.Sprintf("hsts: %v: insecure cipher suite %v", e.Host, tls.CipherSuiteName(e.CipherSuite))
+}
+
+// WithMinTLSVersion requires connections to HSTS hosts to use at least a TLS
+// version (e.g. tls.VersionTLS12) and no cipher suite of
+// tls.InsecureCipherSuites, otherwise the response is discarded and RoundTrip
+// fails with a *TLSError. Other hosts are not affected.
+// The request was already sent when the response is checked: to refuse the
+// connection before, also set tls.Config.MinVersion and CipherSuites.
+func WithMinTLSVersion(version uint16) Option {
+	return func(t *Transport) {
+		t.minTLSVersion = version
+	}
+}
+
+// checkTLSVersion checks the connection of a response to an HSTS host, if
+// a minimum TLS version is set.
+func (t *Transport) checkTLSVersion(req *http.Request, resp *http.Response) error {
+	if t.minTLSVersion == 0 || req.URL.Scheme != "https" {
+		return nil
+	}
+	host := canonicalize(req.URL.Host)
+	if !t.known(req.Context(), host, t.now()) {
+		return nil
+	}
+	if resp.TLS == nil {
+		return &TLSError{Host: host, MinVersion: t.minTLSVersion}
+	}
+	err := &TLSError{Host: host, Version: resp.TLS.Version, CipherSuite: resp.TLS.CipherSuite, MinVersion: t.minTLSVersion}
+	if resp.TLS.Version < t.minTLSVersion {
+		return err
+	}
+	for _, c := range tls.InsecureCipherSuites() {
+		if c.ID == resp.TLS.CipherSuite {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package hsts
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// tlsTransport answers as if over TLS with a version and cipher suite.
+type tlsTransport struct {
+	version, cipherSuite uint16
+}
+
+func (f *tlsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := secureReply(req, "HTTP/1.1 200 OK\r\n\r\n")
+	if err != nil {
+		return nil, err
+	}
+	resp.TLS.Version = f.version
+	resp.TLS.CipherSuite = f.cipherSuite
+	return resp, nil
+}
+
+func TestMinTLSVersion(t *testing.T) {
+	for _, tt := range []struct {
+		host                 string
+		version, cipherSuite uint16
+		refused              bool
+	}{
+		{"example.com", tls.VersionTLS13, tls.TLS_AES_128_GCM_SHA256, false},
+		{"example.com", tls.VersionTLS12, tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, false},
+		{"example.com", tls.VersionTLS11, tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA, true},
+		{"example.com", tls.VersionTLS12, tls.TLS_RSA_WITH_RC4_128_SHA, true},
+		{"sub.example.com", tls.VersionTLS10, tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA, true},
+		{"example.net", tls.VersionTLS10, tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA, false}, // unknown host
+	} {
+		transport := New(&tlsTransport{tt.version, tt.cipherSuite}, WithMinTLSVersion(tls.VersionTLS12))
+		transport.put("example.com", newDirective(time.Now(), time.Hour, flagIncludeSubDomains))
+		req, err := http.NewRequest("GET", "https://"+tt.host, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := transport.RoundTrip(req)
+		var tlsErr *TLSError
+		if refused := errors.As(err, &tlsErr); refused != tt.refused {
+			t.Errorf("%v over %v %v got error %v; want refused %v", tt.host, tls.VersionName(tt.version), tls.CipherSuiteName(tt.cipherSuite), err, tt.refused)
+		}
+		if err == nil {
+			resp.Body.Close()
+		}
+		// HTTPS requests need no upgrade: checking them is not a lookup.
+		if got := transport.Stats(); got.LookupHits != 0 || got.LookupMisses != 0 {
+			t.Errorf("%v: got %v hits and %v misses; want none", tt.host, got.LookupHits, got.LookupMisses)
+		}
+	}
+
+	err := &TLSError{Host: "example.com", Version: tls.VersionTLS10, MinVersion: tls.VersionTLS12}
+	if got, want := err.Error(), "hsts: example.com: TLS 1.0 below minimum TLS 1.2"; got != want {
+		t.Errorf("Error() = %q; want %q", got, want)
+	}
+}
@@ -0,0 +1,25 @@
+package hsts
+
+import "context"
+
+// A ClientTrace is a set of hooks called on HSTS events of a request, like
+// httptrace.ClientTrace which has no hook for them. It lets per-request
+// tracing see that the URL asked for is not the URL that went on the wire.
+type ClientTrace struct {
+	// Upgraded is called when the request is upgraded to HTTPS, or fails to be.
+	Upgraded func(Upgrade)
+}
+
+type clientTraceKey struct{}
+
+// WithClientTrace returns a context based on ctx with trace attached, to use
+// as request context so that a Transport calls its hooks.
+func WithClientTrace(ctx context.Context, trace *ClientTrace) context.Context {
+	return context.WithValue(ctx, clientTraceKey{}, trace)
+}
+
+// ContextClientTrace returns the ClientTrace attached to ctx, or nil if none.
+func ContextClientTrace(ctx context.Context) *ClientTrace {
+	trace, _ := ctx.Value(clientTraceKey{}).(*ClientTrace)
+	return trace
+}
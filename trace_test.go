@@ -0,0 +1,57 @@
+package hsts
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientTrace(t *testing.T) {
+	transport := New(&echoTransport{})
+	transport.put("example.com", newDirective(time.Now(), time.Hour, 0))
+	for _, tt := range []struct {
+		url     string
+		body    bool
+		upgrade bool
+	}{
+		{"http://example.com/a", false, true},
+		{"http://example.com/b", true, true},
+		{"https://example.com/c", false, false},
+		{"http://example.org/d", false, false},
+	} {
+		var got []Upgrade
+		ctx := WithClientTrace(context.Background(), &ClientTrace{
+			Upgraded: func(u Upgrade) { got = append(got, u) },
+		})
+		req, err := http.NewRequestWithContext(ctx, "POST", tt.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.body {
+			req.Body = ioutil.NopCloser(strings.NewReader("data"))
+		}
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if !tt.upgrade {
+			if len(got) != 0 {
+				t.Errorf("%v: got %+v; want no upgrade", tt.url, got)
+			}
+			continue
+		}
+		if len(got) != 1 {
+			t.Fatalf("%v: got %v upgrades; want 1", tt.url, len(got))
+		}
+		if u := got[0]; u.Request != req || u.URL.String() != "https"+strings.TrimPrefix(tt.url, "http") || u.InPlace != tt.body {
+			t.Errorf("%v: got %+v", tt.url, u)
+		}
+	}
+	if ContextClientTrace(context.Background()) != nil {
+		t.Error("got a trace from an empty context")
+	}
+}
@@ -3,146 +3,881 @@ Package hsts implements a RoundTripper that supports HTTP Strict Transport Secur
 
 It comes preloaded with sites from Chromium (https://www.chromium.org/hsts),
 updated with go generate.
+
+For servers, Middleware sets the Strict-Transport-Security header and Redirect
+also redirects plaintext requests to HTTPS.
+
+Building with the hsts_nopreload tag leaves the preload list out, for programs
+that care about binary size.
 */
 package hsts
 
-//go:generate go run generate/preload.go -p hsts -v preload -o preload.go
+//go:generate go run ./generate -p hsts -v preload -o preload.go -b !hsts_nopreload
 //go:generate gofmt -w preload.go
+//go:generate go run ./generate -ctlogs -p hsts -v embedded -o ctlogs.go
+//go:generate gofmt -w ctlogs.go
 
 import (
-	"bufio"
-	"fmt"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"log/slog"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"golang.org/x/net/http2"
 )
 
 // Transport implements a RoundTripper adding HSTS to an existing RoundTripper.
 type Transport struct {
-	wrap  http.RoundTripper
-	m     sync.Mutex            // protects state
-	state map[string]*directive // key is host (RFC section 8.3)
+	counters counters // first for 64-bit alignment of atomic operations on 32-bit platforms
+
+	wrap         http.RoundTripper
+	match        Match
+	excludeLocal bool
+	proxyCheck   bool
+
+	headerHook        func(host string, values []string)
+	upgradeHook       func(Upgrade)
+	evictionHook      func(Entry)
+	logger            *slog.Logger
+	rejectConflicting bool
+	knockOut          KnockOut
+	knockOutProtected []string // see WithKnockOutProtection
+	publicSuffix      PublicSuffixPolicy
+	publicSuffixHook  func(host string, p Policy)
+	learnAllow        []string // if set, only learn for these domains
+	learnDeny         []string // never learn for these domains
+	longLivedPreload  bool
+	noPreload         bool // see WithPreloadList
+	inPlace           bool // see WithInPlaceUpgrades
+	observer          func(Observation)
+	observeOnly       bool // see WithObserveOnly
+	httpFallback      bool // see WithHTTPFallback
+	fallbackHook      func(Upgrade)
+	minUpdateInterval time.Duration  // see WithMinUpdateInterval
+	serverDate        bool           // see WithServerDate
+	maxDateSkew       time.Duration  // see WithMaxDateSkew
+	originAddrs       bool           // see WithOriginAddrs
+	testRoots         *x509.CertPool // see WithTestCertificates
+
+	store           *Store   // see WithStore
+	shards          []*shard // state of the store, see shard
+	maxEntries      int      // see WithMaxEntries
+	eviction        Eviction // see WithEviction
+	negativeSize    int      // see WithNegativeCache
+	negative        *negativeCache
+	expvarName      string // see WithExpvar
+	topSize         int    // see WithTopUpgraded
+	topUpgraded     *topHosts
+	decisionLogSize int // see WithDecisionLog
+	decisionLog     *decisionLog
+	auditLog        *AuditLog // see WithAuditLog
+	requireSCTs     bool      // see WithRequireSCTs
+	sctLogs         []CTLog   // given to WithRequireSCTs
+	ctLogs          ctLogs    // SCTs required if set
+
+	minTLSVersion uint16 // see WithMinTLSVersion
+
+	storage          Storage       // see WithStorage
+	storageCacheSize int           // see WithStorageCache
+	storageCacheTTL  time.Duration // see WithStorageCache
+
+	httpsRecords     func(ctx context.Context, host string) (bool, error)
+	noteHTTPSRecords bool
+
+	opts        []Option // to create tenants
+	tenant      string   // if the Transport of a tenant, see WithTenant
+	tenantQuota int      // see WithTenantQuota
+	tenantsMu   sync.Mutex
+	tenants     map[string]*Transport
+
+	now func() time.Time // see WithClock
 }
 
 // New wraps around a RoundTripper transport to add HTTP Strict Transport Security (HSTS).
 // It starts preloaded with Chromium's list (https://www.chromium.org/hsts).
 // Just like an http.Client if transport is nil, http.DefaultTransport is used.
-func New(transport http.RoundTripper) *Transport {
+// It must wrap the innermost transport, the one sending each request as is:
+// HSTS is noted for the host a request is sent to, so responses which are
+// not obviously for it (e.g. after redirects) are ignored.
+// Options can change the default behavior.
+//
+// Wrapping a Transport again does not add another one: it is returned as is
+// without options, otherwise the new one wraps the same transport and shares
+// its store (see WithStore). A Transport found further down, by calling
+// Unwrap on transport, also shares its store.
+func New(transport http.RoundTripper, opts ...Option) *Transport {
 	if transport == nil {
 		transport = http.DefaultTransport
 	}
-	state := make(map[string]*directive)
-	for host, includeSubDomains := range preload {
-		state[host] = &directive{includeSubDomains: includeSubDomains}
+	if inner, ok := transport.(*Transport); ok {
+		if len(opts) == 0 {
+			return inner
+		}
+		transport = inner.wrap
+		opts = append([]Option{WithStore(inner.store)}, opts...)
+	} else if inner := unwrapTransport(transport); inner != nil {
+		opts = append([]Option{WithStore(inner.store)}, opts...)
+	}
+	t := &Transport{
+		wrap:         transport,
+		excludeLocal: true,
+		shards:       []*shard{nil}, // see WithShards
+		negativeSize: defaultNegativeCacheSize,
+		topSize:      defaultTopUpgraded,
+		maxDateSkew:  defaultMaxDateSkew,
+		now:          time.Now,
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	t.opts = opts
+	if t.requireSCTs {
+		logs, err := newCTLogs(t.sctLogs)
+		if err != nil {
+			panic(err)
+		}
+		t.ctLogs = logs
+	}
+	if t.store == nil {
+		t.store = NewStore(len(t.shards))
+		if t.storage != nil {
+			t.store.useStorage(t.storage, t.storageCacheSize, t.storageCacheTTL)
+			if t.maxEntries == 0 {
+				t.maxEntries = t.store.cache.size
+			}
+		}
+		t.store.bound(t.maxEntries, t.eviction)
+	}
+	t.shards = t.store.shards
+	if t.store.storage == nil {
+		t.negative = t.store.negativeCache(negativeKey{t.match, t.noPreload}, t.negativeSize)
 	}
-	return &Transport{
-		wrap:  transport,
-		state: state,
+	t.topUpgraded = newTopHosts(t.topSize)
+	t.decisionLog = newDecisionLog(t.decisionLogSize)
+	if t.expvarName != "" {
+		t.publish(t.expvarName)
 	}
+	return t
+}
+
+// maxUnwrap bounds how many transports are unwrapped looking for a Transport,
+// in case of cycles.
+const maxUnwrap = 32
+
+// unwrapTransport returns the first Transport found by calling Unwrap on
+// a transport and the transports it returns, or nil.
+func unwrapTransport(transport http.RoundTripper) *Transport {
+	for i := 0; i < maxUnwrap; i++ {
+		u, ok := transport.(interface{ Unwrap() http.RoundTripper })
+		if !ok {
+			return nil
+		}
+		transport = u.Unwrap()
+		if t, ok := transport.(*Transport); ok {
+			return t
+		}
+	}
+	return nil
+}
+
+// Unwrap returns the wrapped transport.
+func (t *Transport) Unwrap() http.RoundTripper {
+	return t.wrap
 }
 
 // RoundTrip executes a single HTTP transaction and adds support for HSTS.
+// Requests to upgrade are answered with a 307 redirect to HTTPS for clients
+// to follow, or sent upgraded if their body cannot be sent again or
+// WithInPlaceUpgrades is set. ResponseUpgrade tells which responses result
+// from upgrades.
 // It is safe for concurrent use by multiple goroutines.
 func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
-	if u, ok := t.needsUpgrade(req); ok {
-		code := http.StatusTemporaryRedirect
-		return reply(req, fmt.Sprintf("HTTP/1.1 %d %s\r\nLocation: %s\r\n\r\n",
-			code, http.StatusText(code), u.String()))
+	if tenant := ContextTenant(req.Context()); tenant != "" && t.tenant == "" {
+		return t.Tenant(tenant).RoundTrip(req)
+	}
+	if t.observeOnly {
+		return t.roundTripObserved(req)
+	}
+	if up, ok := t.needsUpgrade(req); ok {
+		if t.proxyCheck {
+			if err := t.checkProxy(req, up.URL); err != nil {
+				up.Err = err
+				t.notify(up)
+				return nil, err
+			}
+		}
+		// Clients follow a 307 by sending the body again, which they can only
+		// do with GetBody: without it, upgrade in place before it is consumed.
+		up.InPlace = t.inPlace || req.GetBody == nil && req.Body != nil && req.Body != http.NoBody
+		fallback := t.mayFallBack(up)
+		up.InPlace = up.InPlace || fallback
+		t.notify(up)
+		if fallback {
+			return t.roundTripFallback(req, up)
+		}
+		if up.InPlace {
+			return t.roundTripUpgraded(req, up)
+		}
+		return t.redirect(req, up), nil
+	}
+	return t.roundTrip(req)
+}
+
+// roundTrip sends a request with the wrapped transport and processes the response.
+func (t *Transport) roundTrip(req *http.Request) (*http.Response, error) {
+	if t.originAddrs {
+		req = traceRemote(req)
 	}
 	resp, err := t.wrap.RoundTrip(req)
 	if err != nil {
 		return resp, err
 	}
-	t.processResponse(resp)
+	if err := t.checkTLSVersion(req, resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if err := t.checkSCTs(req, resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	t.processResponse(req, resp)
 	return resp, nil
 }
 
-func reply(req *http.Request, s string) (*http.Response, error) {
-	return http.ReadResponse(bufio.NewReader(strings.NewReader(s)), req)
+// notify counts an upgrade or its failure, and tells the upgrade hook,
+// the client trace in the request context and the logger about it.
+func (t *Transport) notify(up Upgrade) {
+	ctx := up.Request.Context()
+	if up.Err == nil {
+		if up.Preloaded {
+			t.count(&t.counters.upgradesPreloaded)
+		} else {
+			t.count(&t.counters.upgradesDynamic)
+		}
+		if int(up.Source) < len(t.counters.upgradesBySource) {
+			t.count(&t.counters.upgradesBySource[up.Source])
+		}
+		t.topUpgraded.add(canonicalize(up.Request.URL.Host))
+		t.decide(up.Request, canonicalize(up.Request.URL.Host), ActionUpgrade, upgradeReason(up))
+	} else {
+		t.decide(up.Request, canonicalize(up.Request.URL.Host), ActionFail, up.Err.Error())
+	}
+	if t.upgradeHook != nil {
+		t.upgradeHook(up)
+	}
+	if trace := ContextClientTrace(ctx); trace != nil && trace.Upgraded != nil {
+		trace.Upgraded(up)
+	}
+	if t.logger != nil {
+		if up.Err != nil {
+			t.logger.InfoContext(ctx, "hsts: upgrade failed", "url", up.Request.URL.String(), "error", up.Err)
+		} else {
+			t.logger.DebugContext(ctx, "hsts: request upgraded", "url", up.Request.URL.String(), "to", up.URL.String(), "host", up.Host, "preloaded", up.Preloaded, "source", up.Source.String())
+		}
+	}
+}
+
+// roundTripUpgraded sends a request upgraded, in place of a redirect.
+func (t *Transport) roundTripUpgraded(req *http.Request, up Upgrade) (*http.Response, error) {
+	upgraded := req.Clone(withUpgrade(req.Context(), up))
+	upgraded.URL = up.URL
+	if req.Host == req.URL.Host {
+		upgraded.Host = up.URL.Host // port may have been mapped
+	}
+	resp, err := t.roundTrip(upgraded)
+	if resp != nil && resp.Request == nil {
+		resp.Request = upgraded // for ResponseUpgrade
+	}
+	return resp, err
+}
+
+// proto returns the protocol version a response to a request would have had
+// from the wrapped transport: HTTP/2 for an http2.Transport, otherwise that
+// of the request, which a server forwarding requests has set to its own.
+func (t *Transport) proto(req *http.Request) (major, minor int) {
+	if _, ok := t.wrap.(*http2.Transport); ok {
+		return 2, 0
+	}
+	if req.ProtoMajor == 0 { // zero value of a request built by hand
+		return 1, 1
+	}
+	return req.ProtoMajor, req.ProtoMinor
+}
+
+// checkProxy consults the wrapped transport's Proxy function, if any, for a
+// request upgraded to a URL. Upgraded requests are sent to the proxy with
+// CONNECT to port 443, not in plaintext, but the proxy may be another one.
+func (t *Transport) checkProxy(req *http.Request, u *url.URL) error {
+	tr, ok := t.wrap.(*http.Transport)
+	if !ok || tr.Proxy == nil {
+		return nil
+	}
+	upgraded := *req // shallow copy is enough to only change the URL
+	upgraded.URL = u
+	if _, err := tr.Proxy(&upgraded); err != nil {
+		return &ProxyError{URL: u.String(), Err: err}
+	}
+	return nil
+}
+
+// redirect synthesizes a temporary redirect of a request to its upgraded URL.
+// A 307 is used so that clients keep the method and body.
+// The response is built directly rather than parsed, which would be slower.
+func (t *Transport) redirect(req *http.Request, up Upgrade) *http.Response {
+	major, minor := t.proto(req)
+	code := http.StatusTemporaryRedirect
+	return &http.Response{
+		Status:     strconv.Itoa(code) + " " + http.StatusText(code),
+		StatusCode: code,
+		Proto:      "HTTP/" + strconv.Itoa(major) + "." + strconv.Itoa(minor),
+		ProtoMajor: major,
+		ProtoMinor: minor,
+		Header:     http.Header{"Location": {up.URL.String()}},
+		Body:       http.NoBody,
+		Request:    req.WithContext(withUpgrade(req.Context(), up)), // for ResponseUpgrade
+	}
 }
 
 // needsUpgrade tells whether a request is HTTP and needs upgrading to HTTPS.
+// WebSocket (ws) is upgraded to secure WebSocket (wss) like browsers do.
 // If it needs upgrading, the destination URL to redirect to is returned.
-func (t *Transport) needsUpgrade(req *http.Request) (*url.URL, bool) {
-	if req.URL.Scheme != "http" {
-		return nil, false
+func (t *Transport) needsUpgrade(req *http.Request) (Upgrade, bool) {
+	if req.URL.Scheme != "http" && req.URL.Scheme != "ws" {
+		return Upgrade{}, false
 	}
 
-	t.m.Lock()
-	defer t.m.Unlock()
+	// The port does not matter, only the host: ports are mapped on upgrade.
+	host := canonicalize(req.URL.Host)
 
-	// TODO(StalkR): check host isn't an IP-literal or IPv4 (section 8.3.3).
-
-	host := req.URL.Host
-	d := t.find(host, true)
-	if d == nil { // not found
-		return nil, false
+	// Section 8.3 says IP-literal or IPv4 hosts are not upgraded.
+	if isIP(host) {
+		t.count(&t.counters.bypassed)
+		t.decide(req, host, ActionSkip, "IP literal")
+		return Upgrade{}, false
+	}
+	if t.excludeLocal && isLocal(host) {
+		t.count(&t.counters.bypassed)
+		t.decide(req, host, ActionSkip, "local host excluded")
+		return Upgrade{}, false
 	}
 
-	// Preloaded sites do not expire; dynamic entries do.
-	preloaded := d.received.IsZero()
-	if !preloaded && time.Now().After(d.received.Add(d.maxAge)) {
-		delete(t.state, host)
-		return nil, false
+	known, d, ok, expired := t.lookupExpired(req.Context(), host, t.now())
+	if !ok {
+		if t.hasHTTPSRecord(req, host) {
+			return Upgrade{Request: req, URL: upgrade(req.URL), Host: host, HTTPSRecord: true, Source: SourceHTTPSRecord}, true
+		}
+		if expired {
+			t.decide(req, host, ActionSkip, "expired")
+		} else {
+			t.decide(req, host, ActionSkip, "no policy")
+		}
+		return Upgrade{}, false
 	}
 
-	u := *req.URL // copy to avoid modifying the request URL
+	return Upgrade{
+		Request:   req,
+		URL:       upgrade(req.URL),
+		Host:      known,
+		Preloaded: d.preloaded(),
+		Source:    d.origin().Source,
+	}, true
+}
+
+// upgrade returns a copy of an HTTP URL upgraded to HTTPS, or ws to wss.
+func upgrade(orig *url.URL) *url.URL {
+	u := *orig // copy to avoid modifying the request URL
 
 	// Section 8.3 step 5a says to replace the http scheme with https.
-	if u.Scheme == "http" {
+	switch u.Scheme {
+	case "http":
 		u.Scheme = "https"
+	case "ws":
+		u.Scheme = "wss"
 	}
 	// Section 8.3 step 5b says to replace explicit 80 with 443.
-	if strings.Contains(u.Host, ":") {
-		hp := strings.SplitN(u.Host, ":", 2)
-		if port, err := strconv.Atoi(hp[1]); err == nil {
-			if port == 80 {
-				port = 443
+	// SplitHostPort fails without a port, and handles bracketed IPv6.
+	// It is only called with a colon, since failing allocates the error.
+	// Only the port is replaced, which keeps the host as is and avoids
+	// formatting it again.
+	if strings.IndexByte(u.Host, ':') >= 0 {
+		if _, port, err := net.SplitHostPort(u.Host); err == nil {
+			if p, err := strconv.Atoi(port); err == nil && p == 80 {
+				u.Host = u.Host[:len(u.Host)-len(port)] + "443"
 			}
-			u.Host = fmt.Sprintf("%s:%d", hp[0], port)
 		}
 	}
-	// Section 8.3 step 5c and 5d says to preserve otherwise.
+	// Section 8.3 step 5c and 5d says to preserve otherwise: userinfo, host,
+	// other ports, path, query and fragment are copied as is, raw forms included.
+
+	return &u
+}
+
+// UpgradeURL returns a copy of an HTTP URL upgraded to HTTPS, or ws to wss,
+// as a Transport upgrades requests to known HSTS hosts (section 8.3): an
+// explicit port 80 becomes 443 and other ports are kept. It is for code
+// upgrading requests itself, e.g. a proxy.
+func UpgradeURL(u *url.URL) *url.URL {
+	return upgrade(u)
+}
+
+// Lookup returns the entry applying to a host, if it is a known HSTS host.
+func (t *Transport) Lookup(host string) (Entry, bool) {
+	known, d, ok := t.lookup(canonicalize(host), t.now())
+	if !ok {
+		return Entry{}, false
+	}
+	return newEntry(known, d), true
+}
 
-	return &u, true
+// newEntry returns the entry of a known HSTS host with its directive.
+func newEntry(host string, d directive) Entry {
+	return Entry{
+		Host:      host,
+		Preloaded: d.preloaded(),
+		LongLived: d.longLived(),
+		Received:  d.received(),
+		Origin:    d.origin(),
+		Policy: Policy{
+			MaxAge:            d.age(),
+			IncludeSubDomains: d.includeSubDomains(),
+			Preload:           d.preload(),
+			Extensions:        copyExtensions(d.extensions()),
+		},
+	}
 }
 
-// find finds a host including subdomains. Lock must be taken already.
-func (t *Transport) find(host string, exact bool) *directive {
-	d, ok := t.state[host]
-	if ok && (exact || d.includeSubDomains) {
-		return d
+// entryDirective returns the directive of a dynamic entry for a host.
+func (t *Transport) entryDirective(host string, e Entry) directive {
+	var flags uint8
+	if e.IncludeSubDomains && t.mayIncludeSubDomains(host) {
+		flags |= flagIncludeSubDomains
 	}
-	i := strings.Index(host, ".")
-	if i == -1 {
+	if e.Preload {
+		flags |= flagPreload
+	}
+	if e.LongLived {
+		flags |= flagLongLived
+	}
+	return newDirective(e.Received, e.MaxAge, flags).withMeta(copyExtensions(e.Extensions), e.Origin)
+}
+
+// copyExtensions copies extensions so that callers cannot modify the state.
+func copyExtensions(extensions map[string]string) map[string]string {
+	if extensions == nil {
 		return nil
 	}
-	return t.find(host[i+1:], false)
+	c := make(map[string]string, len(extensions))
+	for k, v := range extensions {
+		c[k] = v
+	}
+	return c
+}
+
+// lookup finds a known HSTS host with only read locks, so that lookups do
+// not serialize, then takes write locks to remove expired entries if any.
+// Hosts without a policy are remembered in the negative cache.
+// It is for lookups outside of a request, see lookupExpired.
+func (t *Transport) lookup(host string, now time.Time) (string, directive, bool) {
+	known, d, ok, _ := t.lookupExpired(context.Background(), host, now)
+	return known, d, ok
+}
+
+// lookupExpired is lookup also telling whether expired entries were met,
+// reading through the Storage within the context of a request.
+func (t *Transport) lookupExpired(ctx context.Context, host string, now time.Time) (string, directive, bool, bool) {
+	cached, generation := t.negative.has(host)
+	if cached {
+		t.count(&t.counters.misses)
+		return "", directive{}, false, false
+	}
+	var expired []string
+	known, d, ok := t.find(ctx, host, now, &expired)
+	if len(expired) > 0 {
+		t.removeExpired(expired, now)
+	}
+	if ok {
+		t.count(&t.counters.hits)
+		t.use(known, now)
+	} else {
+		t.count(&t.counters.misses)
+		t.negative.add(host, generation)
+	}
+	return known, d, ok, len(expired) > 0
+}
+
+// known tells whether a host is a known HSTS host as lookup does, but
+// without counting it in the stats nor noting a use: it is for checks of
+// responses to requests whose lookup was already counted.
+func (t *Transport) known(ctx context.Context, host string, now time.Time) bool {
+	if cached, _ := t.negative.has(host); cached {
+		return false
+	}
+	var expired []string
+	_, _, ok := t.find(ctx, host, now, &expired)
+	return ok
+}
+
+// removeExpired removes entries of hosts if they are still expired.
+func (t *Transport) removeExpired(hosts []string, now time.Time) {
+	var removed []string
+	for _, host := range hosts {
+		s := t.shard(host)
+		s.m.Lock()
+		if d, ok := s.state[host]; ok && d.expired(now) {
+			s.delete(host)
+			removed = append(removed, host)
+			t.count(&t.counters.expired)
+			if t.logger != nil {
+				t.logger.Debug("hsts: policy expired", "host", host)
+			}
+		}
+		s.m.Unlock()
+	}
+	t.notifyRemoved(removed, now)
+	t.auditRemoved(removed, "expired")
+}
+
+// find finds the known HSTS host matching a host (section 8.2) according to
+// the match algorithm, and returns it with its directive.
+// Expired entries met are skipped and added to expired.
+func (t *Transport) find(ctx context.Context, host string, now time.Time, expired *[]string) (string, directive, bool) {
+	switch t.match {
+	case Exact:
+		if d, ok := t.get(ctx, host, now, expired); ok {
+			return host, d, true
+		}
+		return "", directive{}, false
+	case NearestSuperdomain:
+		if known, d, ok := t.findSuperdomain(ctx, host, now, expired); ok {
+			return known, d, true
+		}
+		if d, ok := t.get(ctx, host, now, expired); ok {
+			return host, d, true
+		}
+		return "", directive{}, false
+	}
+	if d, ok := t.get(ctx, host, now, expired); ok {
+		return host, d, true
+	}
+	return t.findSuperdomain(ctx, host, now, expired)
+}
+
+// findSuperdomain finds the nearest superdomain of a host including subdomains.
+// Superdomains are slices of the host so walking up its labels does not allocate.
+func (t *Transport) findSuperdomain(ctx context.Context, host string, now time.Time, expired *[]string) (string, directive, bool) {
+	for i := strings.IndexByte(host, '.'); i != -1; i = strings.IndexByte(host, '.') {
+		host = host[i+1:]
+		if d, ok := t.get(ctx, host, now, expired); ok && d.includeSubDomains() {
+			return host, d, true
+		}
+	}
+	return "", directive{}, false
+}
+
+// get gets the directive of a known HSTS host, if any.
+// An expired entry is skipped so that it does not hide superdomains, and
+// added to expired for removal.
+// The preload list is shared by all transports and not in the state: it is
+// checked when nothing is there, and a tombstone hides a removed host.
+func (t *Transport) get(ctx context.Context, host string, now time.Time, expired *[]string) (directive, bool) {
+	if t.store.storage != nil {
+		t.readThrough(ctx, host, now)
+	}
+	d, ok := t.entry(host)
+	if ok && d.removed() {
+		return directive{}, false
+	}
+	if ok && d.expired(now) {
+		*expired = append(*expired, host)
+		ok = false
+	}
+	if ok || t.noPreload {
+		return d, ok
+	}
+	return preloadFind(host)
 }
 
-// processResponse looks into an HTTP response to see if HSTS state needs to be updated.
-func (t *Transport) processResponse(resp *http.Response) {
-	header := resp.Header.Get("Strict-Transport-Security")
-	if header == "" {
+// processResponse looks into the HTTP response to a request to see if HSTS
+// state needs to be updated.
+func (t *Transport) processResponse(req *http.Request, resp *http.Response) {
+	values := resp.Header.Values("Strict-Transport-Security")
+	if len(values) == 0 {
 		return // missing
 	}
-	d := parse(header)
-	if d == nil {
-		return // invalid
+	// Section 8.1 says the host is noted, regardless of the port.
+	// It is the host we sent the request to, provided the response is for it.
+	host := canonicalize(req.URL.Host)
+	reason := t.processHeader(req, resp, host, values)
+	if reason != "" {
+		t.ignored(req, host, reason)
+		t.decide(req, host, ActionIgnore, reason)
 	}
-	t.add(resp.Request.URL.Host, d)
+	t.observe(req, resp, host, values, reason)
 }
 
-// Add adds a host in the Strict-Transport-Security state.
-func (t *Transport) add(host string, d *directive) {
-	t.m.Lock()
-	defer t.m.Unlock()
+// processHeader notes the Strict-Transport-Security header values of
+// a response for a host, and returns why they were ignored, if they were.
+func (t *Transport) processHeader(req *http.Request, resp *http.Response, host string, values []string) string {
+	// Section 8.1 says to ignore the header unless received over secure transport.
+	if !t.secure(req, resp) {
+		return "not received over a verified secure transport"
+	}
+	if !attributable(host, resp) {
+		return "response not attributable to the host"
+	}
+	if t.headerHook != nil {
+		t.headerHook(host, values)
+	}
+	// Section 8.1 says to process only the first header field.
+	header := values[0]
+	if t.rejectConflicting && conflicting(values) {
+		return "conflicting headers"
+	}
+	// Section 8.1.1 says IP-literal or IPv4 hosts are not noted.
+	if isIP(host) {
+		return "IP address"
+	}
+	if t.excludeLocal && isLocal(host) {
+		return "local host"
+	}
+	if !t.mayLearn(host) {
+		return "learning not allowed for the host"
+	}
+	p, err := parse(header, nil)
+	if err != nil {
+		if t.logger != nil {
+			t.logger.InfoContext(req.Context(), "hsts: invalid header", "host", host, "error", err)
+		}
+		t.decide(req, host, ActionIgnore, err.Error())
+		return ""
+	}
+	if p.IncludeSubDomains && p.MaxAge > 0 && isPublicSuffix(host) {
+		if t.publicSuffixHook != nil {
+			t.publicSuffixHook(host, p)
+		}
+		if t.logger != nil {
+			t.logger.WarnContext(req.Context(), "hsts: includeSubDomains from a public suffix", "host", host, "policy", p.String())
+		}
+		if t.publicSuffix == PublicSuffixRefuse {
+			return "includeSubDomains from a public suffix"
+		}
+	}
+	if p.MaxAge == 0 && t.protected(host) {
+		if t.logger != nil {
+			t.logger.WarnContext(req.Context(), "hsts: knock-out of a protected host ignored", "host", host)
+		}
+		return "knock-out of a protected host"
+	}
+	d := t.policyDirective(host, p, t.received(resp), Origin{Source: SourceHeader, URL: originURL(req.URL), Addr: remoteAddr(req)})
+	action, outcome := t.add(host, d)
+	t.decide(req, host, action, outcome)
+	if t.logger != nil {
+		if d.maxAge == 0 {
+			t.logger.InfoContext(req.Context(), "hsts: policy removed", "host", host)
+		} else {
+			t.logger.InfoContext(req.Context(), "hsts: policy learned", "host", host, "policy", p.String())
+		}
+	}
+	return ""
+}
+
+// policyDirective returns the directive of a policy received for a host.
+func (t *Transport) policyDirective(host string, p Policy, received time.Time, origin Origin) directive {
+	var flags uint8
+	if p.IncludeSubDomains && t.mayIncludeSubDomains(host) {
+		flags |= flagIncludeSubDomains
+	}
+	if p.Preload {
+		flags |= flagPreload
+	}
+	if t.longLivedPreload && flags&flagIncludeSubDomains != 0 && p.Preload && p.MaxAge >= MinPreloadMaxAge {
+		flags |= flagLongLived
+	}
+	return newDirective(received, p.MaxAge, flags).withMeta(p.Extensions, origin)
+}
+
+// ignored logs why a header was ignored, if logging.
+func (t *Transport) ignored(req *http.Request, host, reason string) {
+	if t.logger != nil {
+		t.logger.DebugContext(req.Context(), "hsts: header ignored", "host", host, "reason", reason)
+	}
+}
+
+// secure tells whether a response was received over a secure transport
+// "with no underlying secure transport errors or warnings" (section 8.1),
+// i.e. over TLS with a verified certificate chain.
+func (t *Transport) secure(req *http.Request, resp *http.Response) bool {
+	if s := req.URL.Scheme; (s != "https" && s != "wss") || resp.TLS == nil {
+		return false
+	}
+	if t.testVerified(req, resp.TLS) {
+		return true
+	}
+	if len(resp.TLS.VerifiedChains) == 0 {
+		return false
+	}
+	// Custom verification could yield chains despite skipping the standard one.
+	if tr, ok := t.wrap.(*http.Transport); ok && tr.TLSClientConfig != nil &&
+		tr.TLSClientConfig.InsecureSkipVerify {
+		return false
+	}
+	return true
+}
+
+// testVerified tells whether the certificate chain of a connection verifies
+// for the host of the request against the test roots, see
+// WithTestCertificates.
+func (t *Transport) testVerified(req *http.Request, cs *tls.ConnectionState) bool {
+	if t.testRoots == nil || len(cs.PeerCertificates) == 0 {
+		return false
+	}
+	opts := x509.VerifyOptions{
+		Roots:         t.testRoots,
+		Intermediates: x509.NewCertPool(),
+		DNSName:       req.URL.Hostname(),
+		CurrentTime:   t.now(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err := cs.PeerCertificates[0].Verify(opts)
+	return err == nil
+}
+
+// attributable tells whether a response is obviously for the host we sent
+// the request to. It is not if the wrapped transport followed redirects,
+// or if the TLS connection was for another server name.
+func attributable(host string, resp *http.Response) bool {
+	if resp.Request != nil && canonicalize(resp.Request.URL.Host) != host {
+		return false
+	}
+	if resp.TLS != nil && resp.TLS.ServerName != "" && canonicalize(resp.TLS.ServerName) != host {
+		return false
+	}
+	return true
+}
+
+// mayLearn tells whether dynamic policies may be learned for a host.
+func (t *Transport) mayLearn(host string) bool {
+	if t.learnAllow != nil && !inDomains(host, t.learnAllow) {
+		return false
+	}
+	return !inDomains(host, t.learnDeny)
+}
+
+// mayIncludeSubDomains tells whether a dynamic policy of a host may include
+// its subdomains, see PublicSuffixPolicy.
+func (t *Transport) mayIncludeSubDomains(host string) bool {
+	return t.publicSuffix == PublicSuffixAllow || !isPublicSuffix(host)
+}
+
+// protected tells whether the entry of a host is protected from knock-outs,
+// see WithKnockOutProtection.
+func (t *Transport) protected(host string) bool {
+	return inDomains(host, t.knockOutProtected)
+}
+
+// conflicting tells whether header values differ.
+func conflicting(values []string) bool {
+	for _, v := range values[1:] {
+		if strings.TrimSpace(v) != strings.TrimSpace(values[0]) {
+			return true
+		}
+	}
+	return false
+}
+
+// isIP tells whether a host (without port) is an IP-literal or an IPv4 address.
+func isIP(host string) bool {
+	return parseIP(host) != nil
+}
+
+// Add adds a host in the Strict-Transport-Security state, and tells the
+// outcome as a decision (see WithDecisionLog).
+func (t *Transport) add(host string, d directive) (Action, string) {
 	if d.maxAge == 0 { // Section 6.1.1 says 0 signals the UA to forget about it.
-		delete(t.state, host)
-		return
+		t.count(&t.counters.knockOuts)
+		cur, ok := t.entry(host)
+		changed := ok && !cur.removed()
+		_, preloaded := preloadFind(host)
+		if preloaded && !isPreloadedTLD(host) {
+			t.putTombstone(host, d.received())
+			changed = changed || !ok // hidden from the preload list
+		} else {
+			t.remove(host, d.received())
+		}
+		if changed {
+			t.auditRemoved([]string{host}, "knocked out")
+		}
+		t.writeThrough(host, d)
+		if t.knockOut == KnockOutSubdomains {
+			t.knockOutSubdomains(host, d.received())
+		}
+		return ActionLearn, "knocked out"
+	}
+	outcome := "learned new"
+	if cur, ok := t.entry(host); ok && !cur.removed() {
+		if t.coalesce(cur, d) {
+			t.count(&t.counters.coalesced)
+			return ActionIgnore, "coalesced"
+		}
+		outcome = "updated"
+		if samePolicy(cur, d) {
+			outcome = "renewed"
+		}
+	}
+	t.put(host, d)
+	t.count(&t.counters.learned)
+	t.writeThrough(host, d)
+	t.auditChanged(host, outcome, d)
+	return ActionLearn, outcome
+}
+
+// renewInterval is the minimum interval between renewals of a policy received
+// again the same, unless half its max-age is shorter so that it does not
+// expire while still advertised.
+const renewInterval = time.Minute
+
+// coalesce tells whether a directive received for a host is ignored instead
+// of replacing the noted one, see WithMinUpdateInterval.
+func (t *Transport) coalesce(cur, d directive) bool {
+	elapsed := d.received().Sub(cur.received())
+	if !samePolicy(cur, d) {
+		return elapsed < t.minUpdateInterval
+	}
+	renew := renewInterval
+	if t.minUpdateInterval > renew {
+		renew = t.minUpdateInterval
+	}
+	if half := cur.age() / 2; half < renew {
+		renew = half
+	}
+	return elapsed < renew
+}
+
+// knockOutSubdomains removes the dynamic entries of subdomains of a host,
+// knocked out at a time. It goes through the whole state but knock-outs are
+// rare.
+func (t *Transport) knockOutSubdomains(host string, at time.Time) {
+	suffix := "." + host
+	var removed []string
+	for _, s := range t.shards {
+		s.m.Lock()
+		for h, d := range s.state {
+			if !d.removed() && strings.HasSuffix(h, suffix) && !t.protected(h) {
+				s.delete(h)
+				removed = append(removed, h)
+			}
+		}
+		s.m.Unlock()
 	}
-	t.state[host] = d
+	t.notifyRemoved(removed, at)
+	t.auditRemoved(removed, "knocked out with "+host)
 }
@@ -0,0 +1,37 @@
+package hsts
+
+import (
+	"context"
+	"net/http"
+)
+
+type upgradeKey struct{}
+
+// withUpgrade returns a context based on ctx with an upgrade attached.
+func withUpgrade(ctx context.Context, up Upgrade) context.Context {
+	return context.WithValue(ctx, upgradeKey{}, up)
+}
+
+// ContextUpgrade returns the upgrade attached to the context of a request
+// sent upgraded in place (see WithInPlaceUpgrades), e.g. for the wrapped
+// transport to know of it, or of the request of a synthesized redirect.
+func ContextUpgrade(ctx context.Context) (Upgrade, bool) {
+	up, ok := ctx.Value(upgradeKey{}).(Upgrade)
+	return up, ok
+}
+
+// ResponseUpgrade returns the upgrade from which a response results, with the
+// original request and the upgraded URL, for callers logging or caching by
+// URL to know of the substitution: that of a redirect synthesized by a
+// Transport, of a response to a request upgraded in place, or of an earlier
+// response in the redirects an http.Client followed to get it (see
+// http.Request.Response), the latest if several.
+func ResponseUpgrade(resp *http.Response) (Upgrade, bool) {
+	for resp != nil && resp.Request != nil {
+		if up, ok := ContextUpgrade(resp.Request.Context()); ok {
+			return up, true
+		}
+		resp = resp.Request.Response
+	}
+	return Upgrade{}, false
+}
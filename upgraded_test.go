@@ -0,0 +1,81 @@
+package hsts
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// contextTransport records the upgrade in the context of requests.
+type contextTransport struct {
+	fakeTransport
+	up Upgrade
+	ok bool
+}
+
+func (c *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c.up, c.ok = ContextUpgrade(req.Context())
+	return c.fakeTransport.RoundTrip(req)
+}
+
+func TestResponseUpgrade(t *testing.T) {
+	for _, tt := range []struct {
+		inPlace bool
+		timeout time.Duration // wraps bodies
+	}{
+		{false, 0},
+		{true, 0},
+		{false, time.Minute},
+		{true, time.Minute},
+	} {
+		wrapped := &contextTransport{}
+		transport := New(wrapped, WithInPlaceUpgrades(tt.inPlace))
+		transport.put("example.com", newDirective(time.Now(), time.Hour, 0))
+		client := &http.Client{Transport: transport, Timeout: tt.timeout}
+
+		resp, err := client.Get("http://example.com/path")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		up, ok := ResponseUpgrade(resp)
+		if !ok {
+			t.Fatalf("%+v: no upgrade", tt)
+		}
+		if up.Request.URL.String() != "http://example.com/path" || up.URL.String() != "https://example.com/path" || up.InPlace != tt.inPlace {
+			t.Errorf("%+v: got upgrade of %v to %v (in place %v)", tt, up.Request.URL, up.URL, up.InPlace)
+		}
+		if wrapped.ok != tt.inPlace {
+			t.Errorf("%+v: wrapped transport got upgrade %v", tt, wrapped.ok)
+		}
+
+		// Not upgraded.
+		resp, err = client.Get("https://example.com/path")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if _, ok := ResponseUpgrade(resp); ok {
+			t.Errorf("%+v: got upgrade of a request sent as is", tt)
+		}
+	}
+
+	// The synthesized redirect itself.
+	transport := New(&fakeTransport{})
+	transport.put("example.com", newDirective(time.Now(), time.Hour, 0))
+	req, err := http.NewRequest("GET", "http://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if up, ok := ResponseUpgrade(resp); !ok || up.Request != req {
+		t.Errorf("got upgrade %+v, %v; want of the request", up, ok)
+	}
+	if _, ok := ResponseUpgrade(nil); ok {
+		t.Error("got upgrade of no response")
+	}
+}